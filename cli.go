@@ -1,14 +1,20 @@
 package cli
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"io"
 	"os"
-	"regexp"
+	"path"
+	"reflect"
+	"runtime"
+	"runtime/debug"
 	"sort"
 	"strings"
 	"sync"
 	"text/template"
+	"time"
 
 	"mlib.com/mrun/containers/tree/radix"
 	"mlib.com/mrun/sprig"
@@ -83,6 +89,46 @@ type CLI struct {
 	// pertain to a specific command.
 	HelpFunc HelpFunc
 
+	// HelpEpilogue is text appended after the output of HelpFunc for the
+	// root help, such as "Run 'app <command> --help' for more information
+	// on a command." It is omitted if there are no commands to list.
+	HelpEpilogue string
+
+	// CollapseSingleChildren lists chains of nested commands in which each
+	// level has exactly one subcommand under the deepest command in the
+	// help listing, such as "a b c" instead of just "a". Only parents that
+	// were created automatically for nested subcommands are collapsed,
+	// commands registered in Commands are always listed themselves.
+	CollapseSingleChildren bool
+
+	// HelpShowVersion adds a header such as "app v1.2.3" with the Name and
+	// Version of the CLI before the output of HelpFunc for the root help.
+	// The header is omitted if Version is empty.
+	HelpShowVersion bool
+
+	// HelpCommand and VersionCommand name registered commands that are run
+	// instead of printing the built-in help or version when the help or
+	// version flag is given without a subcommand. If empty, the built-in
+	// output is used. The command is run without arguments, otherwise just
+	// like one given on the command line, including the hooks and the
+	// handling of its exit code and panics.
+	HelpCommand    string
+	VersionCommand string
+
+	// SuggestDistance is the maximum edit distance between an unknown
+	// command and a registered one for Run to print "Did you mean 'X'?"
+	// before the help text. Nested commands are compared by their full
+	// name, such as "remote add". 0 disables suggestions. NewCLI sets it
+	// to 2. Suggestions aren't printed if NotFoundFunc is set.
+	SuggestDistance int
+
+	// NotFoundFunc, if set, generates the message that is written to
+	// ErrorWriter instead of the help text when the requested command
+	// doesn't exist, such as a short error with suggestions. It is given
+	// the command that was attempted and the commands available at that
+	// level, excluding hidden ones.
+	NotFoundFunc func(attempted string, available map[string]CommandFactory) string
+
 	// HelpWriter is used to print help text and version when requested.
 	// Defaults to os.Stderr for backwards compatibility.
 	// It is recommended that you set HelpWriter to os.Stdout, and
@@ -95,13 +141,210 @@ type CLI struct {
 	// ErrorWriter to os.Stderr.
 	ErrorWriter io.Writer
 
+	// Aliases maps alternative names of commands to the commands they stand
+	// for, such as "ls" to "list" or "img ls" to "image list". Aliases are
+	// resolved when the arguments are parsed and only appear in the help
+	// with ShowAliasesInHelp. An alias that has the same name as a
+	// command, or that refers to a command that doesn't exist, is an error
+	// returned by Run.
+	Aliases map[string]string
+
+	// ShowAliasesInHelp lists the aliases of each command after its name
+	// in the help the CLI sets up when HelpFunc is nil, such as "status,
+	// st". Aliases listed in HiddenCommands are left out.
+	ShowAliasesInHelp bool
+
+	// CommandHelpWriter is used to print the help of a command that
+	// returned RunResultHelp from Run. Defaults to the value of ErrorWriter
+	// for backwards compatibility. Set it to HelpWriter to print that
+	// help on standard output like any other requested help.
+	CommandHelpWriter io.Writer
+
+	// StrictGlobalFlags rejects any unknown flags before the subcommand
+	// as soon as the arguments are parsed. Run then lists the flags on
+	// ErrorWriter and returns 2 without instantiating the command. By
+	// default the command is resolved first so that its help can be
+	// shown along with the error.
+	StrictGlobalFlags bool
+
+	// YesFlag enables the global "-yes" flag, also spelled "-force",
+	// which skips the confirmation of commands that implement
+	// CommandDestructive. Like the other global flags it is only
+	// recognized before the subcommand and isn't passed to the command.
+	// It is off by default so that the flag is left to the commands,
+	// including the default command.
+	YesFlag bool
+
+	// ChdirFlag enables the global "-C" flag, also spelled "-chdir",
+	// which changes to the given working directory while the command
+	// runs and back afterwards. It is off by default.
+	ChdirFlag bool
+
+	// OutputFileFlag enables the global "-output-file" flag, which writes
+	// the output of commands that implement CommandStdout to the given
+	// file, truncating it first. It is off by default.
+	OutputFileFlag bool
+
+	// QuietFlag enables the global "-q" flag, also spelled "-quiet",
+	// which discards the CLI's own output such as help and errors while
+	// keeping the output of the command. It is off by default.
+	QuietFlag bool
+
+	// AllowPrefixMatch accepts any unambiguous prefix of a command name in
+	// place of the name, like "co" for "checkout" if no other command
+	// starts with "co". Only the first word of the subcommand is matched
+	// this way and hidden commands never are. If the prefix matches more
+	// than one command, Run lists them on ErrorWriter and returns 127.
+	AllowPrefixMatch bool
+
+	// ForwardGlobalFlags passes the enabled global flags the CLI handles
+	// itself, such as -C or -yes, on to the command as well. They are prepended to
+	// the arguments of the command in a normalized form, "--name=value"
+	// for flags with a value and "--name" for the others, sorted by name,
+	// so that the command can parse them again if it wants to.
+	ForwardGlobalFlags bool
+
+	// SuggestSubcommandHelp shows the help of a command instead of running
+	// it when its first argument looks like a mistyped subcommand. For
+	// example, if "foo" has subcommands and "cli foo baz" is executed
+	// where "foo baz" doesn't exist, the help for "foo" is shown listing
+	// its subcommands rather than running "foo" with the arg "baz".
+	SuggestSubcommandHelp bool
+
+	// SetTitle sets the title of the terminal to the name of the running
+	// command, such as "app foo - running", while it runs. The previous
+	// title is restored afterwards. This only has an effect if stdout is
+	// a terminal. See SetTerminalTitle.
+	SetTitle bool
+
+	// DiagnosticsCommand is the name of an opt-in built-in command, such
+	// as "env", that prints the version of the CLI, the Go version, the
+	// OS and architecture, the detected terminal and color support and
+	// the relevant environment variables, for users to include in bug
+	// reports. Values of variables that look like secrets are redacted.
+	// A command registered under the same name in Commands takes
+	// precedence.
+	DiagnosticsCommand string
+
+	// CommandsCommand is the name of an opt-in built-in command, such as
+	// "commands", that lists all commands including nested ones with
+	// their synopsis. With --grep=term it only lists the commands whose
+	// name or synopsis contains term, ignoring case, and highlights the
+	// matches. Hidden commands are never listed. A command registered
+	// under the same name in Commands takes precedence.
+	//
+	// The same filter is always available through the help flag: a term
+	// that isn't a command, as in "app --help net", lists the matching
+	// commands. If none match, it is reported like an unknown command.
+	CommandsCommand string
+
+	// ValidateCommand registers the built-in hidden command "__validate",
+	// which runs Validate and prints any problems found, exiting with 1 if
+	// there are any. The findings of Lint are printed as warnings. This
+	// lets CI smoke-test the wired up CLI without running any real
+	// command. A command registered under the same name in Commands takes
+	// precedence.
+	ValidateCommand bool
+
+	// Autocomplete registers the built-in hidden command "__complete" and
+	// makes the scripts generated by BashCompletion, ZshCompletion and
+	// FishCompletion call it to complete the arguments and flags of
+	// commands that implement CommandAutocomplete. The command takes the
+	// words on the command line up to and including the one being
+	// completed and prints the matching candidates one per line, none
+	// after a "--" argument. A command registered under the same name in
+	// Commands takes precedence.
+	Autocomplete bool
+
+	// Stdin is the standard input given to commands that implement
+	// CommandStdin and read by the default Ui. Defaults to os.Stdin. Tests
+	// can replace it to feed input to commands.
+	Stdin io.Reader
+
+	// PanicHandler, if set, is called with the recovered value when a
+	// command panics, and Run then returns 2 instead of crashing the
+	// process. It is called while the panic is recovered, so
+	// runtime/debug.Stack returns the stack of the panic, for example to
+	// print it with FormatPanic. If nil, panics aren't recovered.
+	PanicHandler func(recovered interface{})
+
+	// ShutdownGrace is how long RunContext waits for a command to return
+	// once its context is done, for example because it was cancelled by
+	// signal.NotifyContext on SIGINT. If the command is still running
+	// after that, the process is force-exited with 130 by calling
+	// ExitFunc, without running any of the CLI's own cleanups. Zero, the
+	// default, waits for the command forever.
+	//
+	// If set, the command runs on its own goroutine. A panic in it is
+	// re-raised by RunContext as a *PanicError that keeps the original
+	// stack, and runtime.Goexit in it exits the calling goroutine too.
+	ShutdownGrace time.Duration
+
+	// ExitCodeMapper, if set, maps the exit code Run returns, for example
+	// to follow the conventions of sysexits.h by mapping 127 for an
+	// unknown command to 64. It is applied to every exit code, including
+	// the ones of the CLI itself. Defaults to returning the code as is.
+	ExitCodeMapper func(code int) int
+
+	// ExitFunc is called by Main with the exit status of the CLI, and
+	// with 130 when a command doesn't stop within ShutdownGrace. Defaults
+	// to os.Exit. Tests can replace it to run Main without exiting. If it
+	// returns after a missed ShutdownGrace, RunContext waits for the
+	// command to return and then returns 130.
+	ExitFunc func(int)
+
+	// ForceColor, if set, turns color on or off for the output of the CLI
+	// itself during Run, regardless of NoColor and NoColorError, so that
+	// the same CLI can be run with and without color, for example to
+	// render to different destinations. It applies to what is written to
+	// HelpWriter, ErrorWriter and CommandHelpWriter, from which escape
+	// sequences are stripped if it is false, and to the colors of the
+	// built-in help, commands and summary. The globals aren't changed, so
+	// runs with different settings can overlap. Commands can follow it
+	// with FprintCtx.
+	ForceColor *bool
+
+	// BeforeRun and AfterRun, if set, are called around running a command,
+	// for example to record telemetry, with the name of the command and
+	// its arguments. BeforeRun is called once the command has been
+	// instantiated, right before it runs. If it returns an error, the
+	// command isn't run and Run writes the error and returns 1. AfterRun
+	// is called after the command with the final exit code, including
+	// when the command requested its help with RunResultHelp or
+	// RunResultUsage.
+	BeforeRun func(command string, args []string) error
+	AfterRun  func(command string, args []string, exitCode int)
+
+	// Ui is used by the CLI itself to interact with the user, for example
+	// to ask for confirmation before running a command that implements
+	// CommandDestructive. Defaults to a BasicUi on stdin and stdout.
+	Ui Ui
+
+	// WarnAsError makes Run return 1 if the command wrote any warnings,
+	// even if it returned 0, for example to fail CI runs on warnings. It
+	// only has an effect if Ui is a CountingUi that the commands also use
+	// to write their warnings. Commands that return a non-zero exit code
+	// keep it.
+	WarnAsError bool
+
+	// PrintSummary writes the Summary of the errors and warnings to Ui
+	// after the command has run, such as "2 errors, 1 warning". Like
+	// WarnAsError it only has an effect if Ui is a CountingUi, and it
+	// only counts what was written during this run, even if the
+	// CountingUi is shared with earlier runs.
+	PrintSummary bool
+
 	//---------------------------------------------------------------
 	// Internal fields set automatically
 
 	once           sync.Once
+	initialized    bool
+	ownHelpFunc    bool
+	initErr        error
 	commandTree    *radix.Tree
 	commandNested  bool
 	commandHidden  map[string]struct{}
+	commandParents map[string]struct{}
 	subcommand     string
 	subcommandArgs []string
 	topFlags       []string
@@ -110,16 +353,112 @@ type CLI struct {
 	// probably use a bitset for this one day.
 	isHelp    bool
 	isVersion bool
+
+	// after is used instead of time.After to wait for ShutdownGrace, so
+	// that tests can control the clock.
+	after func(time.Duration) <-chan time.Time
+
+	// ambiguousCommands are the commands that the subcommand is a prefix
+	// of if AllowPrefixMatch is set and it matches more than one.
+	ambiguousCommands []string
+
+	// globalFlags are the CLI's own global flags that were given, keyed
+	// by their canonical name with their value. See cliGlobalFlags.
+	globalFlags map[string]string
+}
+
+// cliGlobalFlag is a flag that the CLI handles itself.
+type cliGlobalFlag struct {
+	// name is the canonical name of the flag.
+	name string
+
+	// value is true if the flag takes a value, either as the next
+	// argument or after an equals sign.
+	value bool
+
+	// enabled returns whether the CLI handles the flag. Each global flag
+	// is opt-in; flags that aren't enabled are left to the command like
+	// any other flag.
+	enabled func(c *CLI) bool
+}
+
+// yesFlagEnabled returns whether the CLI handles -yes and -force.
+func yesFlagEnabled(c *CLI) bool {
+	return c.YesFlag
+}
+
+// chdirFlagEnabled returns whether the CLI handles -C and -chdir.
+func chdirFlagEnabled(c *CLI) bool {
+	return c.ChdirFlag
+}
+
+// outputFileFlagEnabled returns whether the CLI handles -output-file.
+func outputFileFlagEnabled(c *CLI) bool {
+	return c.OutputFileFlag
+}
+
+// quietFlagEnabled returns whether the CLI handles -q and -quiet.
+func quietFlagEnabled(c *CLI) bool {
+	return c.QuietFlag
+}
+
+// cliGlobalFlags maps each spelling of the flags that the CLI handles
+// itself when they appear before the subcommand to the flag. If they are
+// enabled, these are never treated as invalid flags nor passed to the
+// command.
+var cliGlobalFlags = map[string]cliGlobalFlag{
+	"-yes":          {name: "yes", enabled: yesFlagEnabled},
+	"--yes":         {name: "yes", enabled: yesFlagEnabled},
+	"-force":        {name: "yes", enabled: yesFlagEnabled},
+	"--force":       {name: "yes", enabled: yesFlagEnabled},
+	"-C":            {name: "chdir", value: true, enabled: chdirFlagEnabled},
+	"-chdir":        {name: "chdir", value: true, enabled: chdirFlagEnabled},
+	"--chdir":       {name: "chdir", value: true, enabled: chdirFlagEnabled},
+	"-output-file":  {name: "output-file", value: true, enabled: outputFileFlagEnabled},
+	"--output-file": {name: "output-file", value: true, enabled: outputFileFlagEnabled},
+	"-q":            {name: "quiet", enabled: quietFlagEnabled},
+	"-quiet":        {name: "quiet", enabled: quietFlagEnabled},
+	"--quiet":       {name: "quiet", enabled: quietFlagEnabled},
 }
 
 // NewClI returns a new CLI instance with sensible defaults.
 func NewCLI(app, version string) *CLI {
-	return &CLI{
-		Name:     app,
-		Version:  version,
-		HelpFunc: BasicHelpFunc(app),
+	c := &CLI{
+		Name:            app,
+		Version:         version,
+		SuggestDistance: 2,
 	}
+	c.HelpFunc = c.basicHelpFunc(app)
 
+	return c
+}
+
+// AddCommand registers the command factory f under name, like adding it to
+// Commands. It is meant for registering commands from several places, such
+// as plugins. AddCommand panics if it is called once the CLI has been
+// initialized, for example by Run, since the command tree is built then.
+func (c *CLI) AddCommand(name string, f CommandFactory) {
+	if c.initialized {
+		panic(fmt.Sprintf(
+			"cli: AddCommand(%q) called after the CLI was initialized", name))
+	}
+
+	if c.Commands == nil {
+		c.Commands = make(map[string]CommandFactory)
+	}
+	c.Commands[name] = f
+}
+
+// AddHiddenCommand is like AddCommand but also adds the command to
+// HiddenCommands.
+func (c *CLI) AddHiddenCommand(name string, f CommandFactory) {
+	if c.initialized {
+		panic(fmt.Sprintf(
+			"cli: AddHiddenCommand(%q) called after the CLI was initialized", name))
+	}
+
+	c.AddCommand(name, f)
+	c.HiddenCommands = append(c.HiddenCommands, name)
 }
 
 // IsHelp returns whether or not the help flag is present within the
@@ -136,27 +475,163 @@ func (c *CLI) IsVersion() bool {
 	return c.isVersion
 }
 
+// Main runs the CLI and exits with its exit status by calling ExitFunc.
+// Any error returned by Run is written to ErrorWriter first. It is meant to
+// be the last call in a main function.
+func (c *CLI) Main() {
+	exitCode, err := c.Run()
+	if err != nil {
+		c.ErrorWriter.Write([]byte(fmt.Sprintf(
+			"Error executing CLI: %s\n", err)))
+	}
+
+	c.ExitFunc(exitCode)
+}
+
 // Run runs the actual CLI based on the arguments given.
+//
+// If no commands are registered at all, Run writes an error to ErrorWriter
+// and returns 126 rather than rendering help that lists nothing.
 func (c *CLI) Run() (int, error) {
+	return c.RunContext(context.Background())
+}
+
+// RunContext is like Run but passes ctx to the command if it implements
+// CommandContext, so that it can be cancelled. If ctx is already done
+// before the command is dispatched, the command isn't run and RunContext
+// returns 1 and the error of the context.
+func (c *CLI) RunContext(ctx context.Context) (int, error) {
+	code, err := c.runContext(ctx)
+	if c.ExitCodeMapper != nil {
+		code = c.ExitCodeMapper(code)
+	}
+
+	return code, err
+}
+
+func (c *CLI) runContext(ctx context.Context) (int, error) {
 	c.once.Do(c.init)
 
+	// Refuse to run with an invalid configuration, unless it is to report
+	// the problems with it
+	if c.initErr != nil && !(c.ValidateCommand && c.subcommand == validateCommandName) {
+		return 1, c.initErr
+	}
+
+	// Override the color detection of the CLI's own writers for this run
+	if c.ForceColor != nil {
+		helpWriter, errorWriter, commandHelpWriter := c.HelpWriter, c.ErrorWriter, c.CommandHelpWriter
+		c.HelpWriter = &forcedColorWriter{Writer: helpWriter, color: *c.ForceColor}
+		c.ErrorWriter = &forcedColorWriter{Writer: errorWriter, color: *c.ForceColor}
+		c.CommandHelpWriter = &forcedColorWriter{Writer: commandHelpWriter, color: *c.ForceColor}
+		defer func() {
+			c.HelpWriter, c.ErrorWriter, c.CommandHelpWriter = helpWriter, errorWriter, commandHelpWriter
+		}()
+	}
+
+	// Silence the CLI's own output, such as the help shown for an unknown
+	// command, if asked to. The output of the command itself is kept.
+	if c.hasGlobalFlag("quiet") {
+		helpWriter, errorWriter, commandHelpWriter := c.HelpWriter, c.ErrorWriter, c.CommandHelpWriter
+		c.HelpWriter, c.ErrorWriter, c.CommandHelpWriter = io.Discard, io.Discard, io.Discard
+		defer func() {
+			c.HelpWriter, c.ErrorWriter, c.CommandHelpWriter = helpWriter, errorWriter, commandHelpWriter
+		}()
+	}
+
+	// Run the version command instead of showing the version if set.
+	if c.IsVersion() && c.VersionCommand != "" {
+		return c.runNamedCommand(ctx, c.VersionCommand)
+	}
+
 	// Just show the version and exit if instructed.
 	if c.IsVersion() && c.Version != "" {
 		c.HelpWriter.Write([]byte(c.Version + "\n"))
 		return 0, nil
 	}
 
-	// Just print the help when only '-h' or '--help' is passed.
-	if c.IsHelp() && c.Subcommand() == "" {
-		c.HelpWriter.Write([]byte(c.HelpFunc(c.helpCommands(c.Subcommand())) + "\n"))
+	// Without any commands there is nothing to run or to show help for.
+	if c.commandTree.Len() == 0 {
+		c.ErrorWriter.Write([]byte("no commands are defined\n"))
+		return 126, nil
+	}
+
+	// Just print the help when only '-h' or '--help' is passed. If the
+	// default command is the only command, its own help is shown instead.
+	if c.IsHelp() && c.Subcommand() == "" && (c.HelpCommand != "" || !c.defaultCommandOnly()) {
+		if c.HelpCommand != "" {
+			return c.runNamedCommand(ctx, c.HelpCommand)
+		}
+
+		c.HelpWriter.Write([]byte(c.helpText(c.Subcommand()) + "\n"))
 		return 0, nil
 	}
 
+	// In strict mode, unknown global flags fail before anything else.
+	if c.StrictGlobalFlags && len(c.topFlags) > 0 {
+		c.ErrorWriter.Write([]byte(fmt.Sprintf(
+			"Unknown global flags: %s\n", strings.Join(c.topFlags, ", "))))
+		return 2, nil
+	}
+
+	// Change to the requested working directory for the command and
+	// come back once it is done.
+	if dir, ok := c.globalFlags["chdir"]; ok {
+		wd, err := os.Getwd()
+		if err != nil {
+			c.ErrorWriter.Write([]byte(fmt.Sprintf(
+				"Error getting the working directory: %s\n", err)))
+			return 2, nil
+		}
+
+		if err := os.Chdir(dir); err != nil {
+			c.ErrorWriter.Write([]byte(fmt.Sprintf(
+				"Error changing the working directory: %s\n", err)))
+			return 2, nil
+		}
+		defer os.Chdir(wd)
+	}
+
 	// Attempt to get the factory function for creating the command
 	// implementation. If the command is invalid or blank, it is an error.
 	raw, ok := c.commandTree.Get(c.Subcommand())
 	if !ok {
-		c.ErrorWriter.Write([]byte(c.HelpFunc(c.helpCommands(c.subcommandParent())) + "\n"))
+		// With the help flag, a term that isn't a command lists the
+		// commands whose name or synopsis contains it instead.
+		if c.IsHelp() && c.Subcommand() != "" && len(c.ambiguousCommands) == 0 {
+			listing, err := c.commandsListing(c.Subcommand())
+			if err != nil {
+				return 1, err
+			}
+			if listing != "" {
+				c.HelpWriter.Write([]byte(fmt.Sprintf(
+					"Commands matching %q:\n\n%s", c.Subcommand(), listing)))
+				return 0, nil
+			}
+		}
+
+		if len(c.ambiguousCommands) > 0 {
+			c.ErrorWriter.Write([]byte(fmt.Sprintf(
+				"Ambiguous command %q, could be: %s\n",
+				c.Subcommand(), strings.Join(c.ambiguousCommands, ", "))))
+			return 127, nil
+		}
+
+		if c.NotFoundFunc != nil {
+			msg := c.NotFoundFunc(c.Subcommand(), c.helpCommands(c.subcommandParent()))
+			if !strings.HasSuffix(msg, "\n") {
+				msg += "\n"
+			}
+			c.ErrorWriter.Write([]byte(msg))
+			return 127, nil
+		}
+
+		if suggestion, ok := c.suggestCommand(); ok {
+			c.ErrorWriter.Write([]byte(fmt.Sprintf(
+				"Did you mean '%s'?\n\n", suggestion)))
+		}
+
+		c.ErrorWriter.Write([]byte(c.helpText(c.subcommandParent()) + "\n"))
 		return 127, nil
 	}
 
@@ -180,16 +655,357 @@ func (c *CLI) Run() (int, error) {
 		return 1, nil
 	}
 
-	code := command.Run(c.SubcommandArgs())
+	// Warn about deprecated commands and refuse removed ones
+	if d, ok := command.(CommandDeprecatedSince); ok {
+		since, removeIn := d.DeprecatedSince()
+		if removeIn != "" {
+			if cmp, ok := compareVersions(c.Version, removeIn); ok && cmp >= 0 {
+				c.ErrorWriter.Write([]byte(fmt.Sprintf(
+					"Command %q was removed in %s.\n", c.Subcommand(), removeIn)))
+				return 3, nil
+			}
+		}
+
+		c.ErrorWriter.Write([]byte(deprecatedSinceWarning(c.Subcommand(), since, removeIn)))
+	}
+	if d, ok := command.(CommandDeprecated); ok {
+		if msg := d.DeprecationMessage(); msg != "" {
+			if !strings.HasSuffix(msg, "\n") {
+				msg += "\n"
+			}
+			c.ErrorWriter.Write([]byte(msg))
+		}
+	}
+
+	// Refuse to run commands that miss required environment variables
+	if r, ok := command.(CommandRequiresEnv); ok {
+		var missing bool
+		for _, name := range r.RequiredEnv() {
+			if _, ok := os.LookupEnv(name); !ok {
+				c.ErrorWriter.Write([]byte(fmt.Sprintf(
+					"Error: missing required environment variable %s\n", name)))
+				missing = true
+			}
+		}
+		if missing {
+			return 2, nil
+		}
+	}
+
+	// If the user likely mistyped a subcommand, help them out
+	if c.SuggestSubcommandHelp && c.isUnknownSubcommand() {
+		c.ErrorWriter.Write([]byte(fmt.Sprintf(
+			"Unknown subcommand %q for %q.\n\n",
+			c.subcommandArgs[0], c.Subcommand())))
+		c.commandHelp(c.ErrorWriter, command)
+		return 1, nil
+	}
+
+	// Don't start the command if it is cancelled already
+	if err := ctx.Err(); err != nil {
+		return 1, err
+	}
+
+	// Destructive commands must be confirmed unless forced
+	if d, ok := command.(CommandDestructive); ok && !c.hasGlobalFlag("yes") {
+		if prompt := d.DestructiveConfirm(); prompt != "" {
+			confirmed, err := c.confirm(prompt)
+			if err != nil {
+				return 1, err
+			}
+			if !confirmed {
+				return 0, nil
+			}
+		}
+	}
+
+	if s, ok := command.(CommandStdin); ok {
+		s.SetStdin(c.Stdin)
+	}
+
+	// Redirect the output of the command to a file if requested.
+	if path, ok := c.globalFlags["output-file"]; ok {
+		s, ok := command.(CommandStdout)
+		if !ok {
+			c.ErrorWriter.Write([]byte(fmt.Sprintf(
+				"Command %q doesn't support --output-file\n", c.Subcommand())))
+			return 2, nil
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			c.ErrorWriter.Write([]byte(fmt.Sprintf(
+				"Error opening the output file: %s\n", err)))
+			return 2, nil
+		}
+		defer f.Close()
+
+		s.SetStdout(f)
+	}
+
+	if c.SetTitle {
+		restore := pushTerminalTitle(ColorOutput, strings.TrimSpace(
+			c.Name+" "+c.Subcommand())+" - running")
+		defer restore()
+	}
+
+	return c.dispatchCommand(ctx, c.Subcommand(), command, c.SubcommandArgs())
+}
+
+// dispatchCommand runs the resolved command name with args between the
+// BeforeRun and AfterRun hooks.
+func (c *CLI) dispatchCommand(ctx context.Context, name string, command Command, args []string) (int, error) {
+	// Let the application observe the run
+	if c.BeforeRun != nil {
+		if err := c.BeforeRun(name, args); err != nil {
+			c.ErrorWriter.Write([]byte(fmt.Sprintf("Error: %s\n", err)))
+			return 1, err
+		}
+	}
+
+	code, err := c.runCommand(ctx, name, command, args)
+	if c.AfterRun != nil {
+		c.AfterRun(name, args, code)
+	}
+
+	return code, err
+}
+
+// runCommand runs the resolved command name with args and handles its
+// result.
+func (c *CLI) runCommand(ctx context.Context, name string, command Command, args []string) (int, error) {
+	// The counts before the run are subtracted, so that only what this
+	// run wrote is reported.
+	counting, _ := c.Ui.(*CountingUi)
+	errors, warnings := 0, 0
+	if counting != nil {
+		errors, warnings = counting.Errors(), counting.Warnings()
+	}
+
+	if f, ok := command.(CommandWithFlags); ok {
+		fs := f.Flags()
+		fs.SetOutput(io.Discard)
+		if err := fs.Parse(args); err != nil {
+			if err != flag.ErrHelp {
+				c.ErrorWriter.Write([]byte(fmt.Sprintf("Error: %s\n", err)))
+			}
+			c.namedCommandHelp(c.ErrorWriter, name, command)
+			return 1, nil
+		}
+
+		args = fs.Args()
+	}
+
+	code, err := c.runWithGrace(ctx, name, func() (int, error) {
+		return c.recoverPanic(func() (int, error) {
+			switch cmd := command.(type) {
+			case CommandContext:
+				return cmd.RunContext(ctx, args), nil
+			case CommandWithError:
+				return cmd.RunE(args)
+			default:
+				return command.Run(args), nil
+			}
+		})
+	})
+	if c.PrintSummary && counting != nil {
+		writeSummary(counting, counting.Errors()-errors, counting.Warnings()-warnings, c.ForceColor)
+	}
+	if err != nil {
+		c.ErrorWriter.Write([]byte(fmt.Sprintf("Error: %s\n", err)))
+		return code, err
+	}
 	if code == RunResultHelp {
 		// Requesting help
-		c.commandHelp(c.ErrorWriter, command)
+		c.namedCommandHelp(c.CommandHelpWriter, name, command)
 		return 1, nil
 	}
+	if code == RunResultUsage {
+		// Used incorrectly
+		c.namedCommandHelp(c.CommandHelpWriter, name, command)
+		return 2, nil
+	}
+	if code == 0 && c.WarnAsError && counting != nil {
+		if n := counting.Warnings() - warnings; n > 0 {
+			c.ErrorWriter.Write([]byte(fmt.Sprintf(
+				"Error: %d warning(s) treated as errors\n", n)))
+			return 1, nil
+		}
+	}
 
 	return code, nil
 }
 
+// runWithGrace calls fn, which runs the command name, and returns its
+// result. If ShutdownGrace is set and fn is still running when it has
+// passed after ctx is done, the process is exited with 130 through
+// ExitFunc.
+func (c *CLI) runWithGrace(ctx context.Context, name string, fn func() (int, error)) (int, error) {
+	if c.ShutdownGrace <= 0 {
+		return fn()
+	}
+
+	type result struct {
+		code   int
+		err    error
+		panic  *PanicError
+		goexit bool
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		normalReturn := false
+		recovered := false
+		defer func() {
+			if !normalReturn && !recovered {
+				// Neither returned nor panicked, so fn called
+				// runtime.Goexit
+				r.goexit, r.panic = true, nil
+			}
+			done <- r
+		}()
+
+		func() {
+			defer func() {
+				if !normalReturn {
+					v := recover()
+					r.panic = &PanicError{Value: v, Stack: debug.Stack()}
+				}
+			}()
+
+			r.code, r.err = fn()
+			normalReturn = true
+		}()
+		if !normalReturn {
+			recovered = true
+		}
+	}()
+
+	// Mirror how fn ended on this goroutine, as if it had run here
+	wait := func(r result) (int, error) {
+		switch {
+		case r.panic != nil:
+			panic(r.panic)
+		case r.goexit:
+			runtime.Goexit()
+		}
+
+		return r.code, r.err
+	}
+
+	select {
+	case r := <-done:
+		return wait(r)
+	case <-ctx.Done():
+	}
+
+	after := c.after
+	if after == nil {
+		after = time.After
+	}
+
+	select {
+	case r := <-done:
+		return wait(r)
+	case <-after(c.ShutdownGrace):
+	}
+
+	c.ErrorWriter.Write([]byte(fmt.Sprintf(
+		"Command %q didn't stop within %s, exiting.\n", name, c.ShutdownGrace)))
+	c.ExitFunc(130)
+
+	// ExitFunc only returns in tests. Don't run the cleanups while the
+	// command may still use what they release.
+	<-done
+	return 130, nil
+}
+
+// recoverPanic calls fn and returns its result. If PanicHandler is set, a
+// panic in fn is passed to it and 2 is returned instead.
+func (c *CLI) recoverPanic(fn func() (int, error)) (code int, err error) {
+	if c.PanicHandler != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				c.PanicHandler(r)
+				code, err = 2, nil
+			}
+		}()
+	}
+
+	return fn()
+}
+
+// runNamedCommand runs the registered command key without arguments, in
+// place of a built-in behavior such as printing the version. It is run
+// like a command given on the command line, so its result is handled the
+// same way.
+func (c *CLI) runNamedCommand(ctx context.Context, key string) (int, error) {
+	raw, ok := c.commandTree.Get(key)
+	if !ok {
+		return 1, fmt.Errorf("command %q is not registered", key)
+	}
+
+	command, err := raw.(CommandFactory)()
+	if err != nil {
+		return 1, err
+	}
+
+	return c.dispatchCommand(ctx, key, command, []string{})
+}
+
+// RunResult is the result of a run started with RunAsync.
+type RunResult struct {
+	ExitCode int
+	Err      error
+}
+
+// RunAsync runs the CLI with the given arguments in a new goroutine and
+// delivers the result on the returned channel, which is closed afterwards.
+//
+// Each call runs on a fresh copy of the CLI with its own parsed state, so
+// several runs can be in flight at once. The commands, their factories
+// and the configured writers are shared between those runs and must be
+// safe for concurrent use.
+func (c *CLI) RunAsync(args []string) <-chan RunResult {
+	run := c.clone()
+	run.Args = args
+
+	resultCh := make(chan RunResult, 1)
+	go func() {
+		defer close(resultCh)
+
+		code, err := run.Run()
+		resultCh <- RunResult{ExitCode: code, Err: err}
+	}()
+
+	return resultCh
+}
+
+// clone returns a new CLI with the same configuration, i.e. all the
+// exported fields, but none of the state that is built when it runs.
+func (c *CLI) clone() *CLI {
+	result := new(CLI)
+
+	src := reflect.ValueOf(c).Elem()
+	dst := reflect.ValueOf(result).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if src.Type().Field(i).PkgPath != "" {
+			// Unexported, this is internal state.
+			continue
+		}
+
+		dst.Field(i).Set(src.Field(i))
+	}
+
+	// The default HelpFunc refers to c, so the clone gets its own.
+	if c.ownHelpFunc {
+		result.HelpFunc = nil
+	}
+
+	return result
+}
+
 // Subcommand returns the subcommand that the CLI would execute. For
 // example, a CLI from "--version version --help" would return a Subcommand
 // of "version"
@@ -205,6 +1021,229 @@ func (c *CLI) SubcommandArgs() []string {
 	return c.subcommandArgs
 }
 
+// MatchCommand finds the longest registered command key that matches the
+// leading tokens, using the same rules as the CLI uses to find the
+// subcommand to run. It returns the matched key and the number of tokens
+// that make up that key. If a default command is registered and nothing
+// else matches, the blank key is returned with zero tokens consumed.
+//
+// Matching stops at the first token that is a flag, is blank or contains a
+// space, since those are always treated as arguments.
+func (c *CLI) MatchCommand(tokens []string) (key string, consumed int, ok bool) {
+	c.once.Do(c.init)
+	return c.matchCommand(tokens)
+}
+
+func (c *CLI) matchCommand(tokens []string) (string, int, bool) {
+	// Determine the argument we look to to end subcommands.
+	// We look at all arguments until one is a flag or has a space.
+	// This disallows commands like: ./cli foo "bar baz". An
+	// argument with a space is always an argument. A blank
+	// argument is always an argument.
+	j := 0
+	for k, v := range tokens {
+		if strings.ContainsRune(v, ' ') || v == "" || v[0] == '-' {
+			break
+		}
+
+		j = k + 1
+	}
+
+	searchKey := strings.Join(tokens[:j], " ")
+	k, _, ok := c.commandTree.LongestPrefix(searchKey)
+	if !ok {
+		return "", 0, false
+	}
+
+	// The default command matches without consuming anything.
+	if k == "" {
+		return "", 0, true
+	}
+
+	// k could be a prefix that doesn't contain the full command such as
+	// "foo" instead of "foobar", so we need to verify that we have an
+	// entire key. To do that, we look for an ending in a space or an end
+	// of string.
+	if searchKey != k && !strings.HasPrefix(searchKey, k+" ") {
+		return "", 0, false
+	}
+
+	return k, strings.Count(k, " ") + 1, true
+}
+
+// expandCommandPrefix replaces the first token with the command it is a
+// unique prefix of, if it isn't a command itself. If it is a prefix of
+// more than one command, they are recorded in ambiguousCommands instead.
+func (c *CLI) expandCommandPrefix(tokens []string) []string {
+	prefix := tokens[0]
+	if _, ok := c.commandTree.Get(prefix); ok || strings.ContainsRune(prefix, ' ') {
+		return tokens
+	}
+
+	var candidates []string
+	for k := range c.helpCommands("") {
+		if k != "" && !strings.ContainsRune(k, ' ') && strings.HasPrefix(k, prefix) {
+			candidates = append(candidates, k)
+		}
+	}
+	sort.Strings(candidates)
+
+	switch len(candidates) {
+	case 0:
+		return tokens
+	case 1:
+		return append([]string{candidates[0]}, tokens[1:]...)
+	default:
+		c.ambiguousCommands = candidates
+		return tokens
+	}
+}
+
+// matchAlias finds the longest alias in Aliases that the tokens start with
+// and returns the command it stands for and the number of tokens that it
+// consumed.
+func (c *CLI) matchAlias(tokens []string) (string, int, bool) {
+	var canonical string
+	var consumed int
+	for alias, command := range c.Aliases {
+		words := strings.Fields(alias)
+		if len(words) == 0 || len(words) <= consumed || len(words) > len(tokens) {
+			continue
+		}
+
+		match := true
+		for i, word := range words {
+			if tokens[i] != word {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			canonical, consumed = command, len(words)
+		}
+	}
+
+	return canonical, consumed, consumed > 0
+}
+
+// HasCommand returns whether a command is registered with exactly the given
+// key, such as "foo bar". Hidden commands are included, but parent commands
+// that were created automatically for nested subcommands are not. Use
+// HasCommandOrParent to include those.
+func (c *CLI) HasCommand(key string) bool {
+	c.once.Do(c.init)
+
+	if _, ok := c.commandParents[key]; ok {
+		return false
+	}
+
+	return c.HasCommandOrParent(key)
+}
+
+// HasCommandOrParent is like HasCommand but also returns true for parent
+// commands that were created automatically for nested subcommands.
+func (c *CLI) HasCommandOrParent(key string) bool {
+	c.once.Do(c.init)
+
+	_, ok := c.commandTree.Get(key)
+	return ok
+}
+
+// MatchCommands returns the keys of all commands that match the glob
+// pattern, such as "remote *" or "foo bar*". The pattern uses the syntax of
+// path.Match with the spaces between the words of a key in the role of the
+// path separator, so "remote *" matches "remote add" but not "remote add
+// origin". Hidden commands are omitted, use MatchAllCommands to include
+// them. A malformed pattern matches nothing.
+func (c *CLI) MatchCommands(pattern string) []string {
+	return c.matchCommands(pattern, false)
+}
+
+// MatchAllCommands is like MatchCommands but includes hidden commands.
+func (c *CLI) MatchAllCommands(pattern string) []string {
+	return c.matchCommands(pattern, true)
+}
+
+func (c *CLI) matchCommands(pattern string, hidden bool) []string {
+	c.once.Do(c.init)
+
+	pattern = strings.Replace(pattern, " ", "/", -1)
+
+	var result []string
+	c.commandTree.Walk(func(k string, raw interface{}) bool {
+		if _, ok := c.commandHidden[k]; ok && !hidden {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern, strings.Replace(k, " ", "/", -1)); ok {
+			result = append(result, k)
+		}
+
+		return false
+	})
+
+	return result
+}
+
+// DebugDump writes the effective configuration of the CLI to w. This is
+// useful to diagnose issues such as why output isn't colored or why a
+// command can't be found.
+func (c *CLI) DebugDump(w io.Writer) {
+	c.once.Do(c.init)
+
+	hidden := make([]string, 0, len(c.commandHidden))
+	for k := range c.commandHidden {
+		hidden = append(hidden, k)
+	}
+	sort.Strings(hidden)
+
+	fmt.Fprintf(w, "Name: %s\n", c.Name)
+	fmt.Fprintf(w, "Version: %s\n", c.Version)
+	fmt.Fprintf(w, "HelpWriter: %T\n", c.HelpWriter)
+	fmt.Fprintf(w, "ErrorWriter: %T\n", c.ErrorWriter)
+	fmt.Fprintf(w, "Ui: %T\n", c.Ui)
+	fmt.Fprintf(w, "Commands: %d\n", len(c.Commands))
+	fmt.Fprintf(w, "Commands (including parents): %d\n", c.commandTree.Len())
+	fmt.Fprintf(w, "Hidden commands: %s\n", strings.Join(hidden, ", "))
+	fmt.Fprintf(w, "Nested: %t\n", c.commandNested)
+	fmt.Fprintf(w, "Subcommand: %q\n", c.subcommand)
+	fmt.Fprintf(w, "NoColor: %t\n", NoColor)
+	fmt.Fprintf(w, "NoColorError: %t\n", NoColorError)
+}
+
+// deprecatedSinceWarning returns the warning for a command implementing
+// CommandDeprecatedSince.
+func deprecatedSinceWarning(name, since, removeIn string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Warning: command %q is deprecated", name)
+	if since != "" {
+		fmt.Fprintf(&b, " since %s", since)
+	}
+	if removeIn != "" {
+		fmt.Fprintf(&b, "; will be removed in %s", removeIn)
+	}
+	b.WriteString(".\n")
+
+	return b.String()
+}
+
+// isUnknownSubcommand returns true if the subcommand has subcommands of
+// its own and the first argument looks like one of them, i.e. it isn't a
+// flag, but doesn't exist.
+func (c *CLI) isUnknownSubcommand() bool {
+	if c.Subcommand() == "" || len(c.subcommandArgs) == 0 {
+		return false
+	}
+
+	arg := c.subcommandArgs[0]
+	if arg == "" || arg[0] == '-' || strings.ContainsRune(arg, ' ') {
+		return false
+	}
+
+	return len(c.helpCommands(c.Subcommand())) > 0
+}
+
 // subcommandParent returns the parent of this subcommand, if there is one.
 // If there isn't on, "" is returned.
 func (c *CLI) subcommandParent() string {
@@ -226,12 +1265,77 @@ func (c *CLI) subcommandParent() string {
 	return sub[:idx]
 }
 
+// confirm asks the user to confirm with the given prompt and returns true
+// if they answered yes.
+func (c *CLI) confirm(prompt string) (bool, error) {
+	answer, err := c.Ui.Ask(prompt + " [y/N]")
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// hasGlobalFlag returns whether the global flag with the given canonical
+// name was given.
+func (c *CLI) hasGlobalFlag(name string) bool {
+	_, ok := c.globalFlags[name]
+	return ok
+}
+
+// parseGlobalFlag parses the enabled CLI global flag at the start of
+// args, if there is one, and returns its canonical name, value and the
+// number of args it used. A flag that requires a value but has none is
+// not parsed.
+func (c *CLI) parseGlobalFlag(args []string) (name, value string, consumed int, ok bool) {
+	arg := args[0]
+	if idx := strings.Index(arg, "="); idx > 0 {
+		flag, ok := c.enabledGlobalFlag(arg[:idx])
+		if !ok || !flag.value {
+			return "", "", 0, false
+		}
+
+		return flag.name, arg[idx+1:], 1, true
+	}
+
+	flag, ok := c.enabledGlobalFlag(arg)
+	if !ok {
+		return "", "", 0, false
+	}
+	if !flag.value {
+		return flag.name, "", 1, true
+	}
+	if len(args) < 2 {
+		return "", "", 0, false
+	}
+
+	return flag.name, args[1], 2, true
+}
+
+// enabledGlobalFlag returns the global flag spelled arg, if the CLI
+// handles it.
+func (c *CLI) enabledGlobalFlag(arg string) (cliGlobalFlag, bool) {
+	flag, ok := cliGlobalFlags[arg]
+	if !ok || !flag.enabled(c) {
+		return cliGlobalFlag{}, false
+	}
+
+	return flag, true
+}
+
 func (c *CLI) init() {
+	c.initialized = true
+
 	if c.HelpFunc == nil {
-		c.HelpFunc = BasicHelpFunc("app")
+		c.HelpFunc = c.basicHelpFunc("app")
 
 		if c.Name != "" {
-			c.HelpFunc = BasicHelpFunc(c.Name)
+			c.HelpFunc = c.basicHelpFunc(c.Name)
 		}
 	}
 
@@ -241,6 +1345,22 @@ func (c *CLI) init() {
 	if c.ErrorWriter == nil {
 		c.ErrorWriter = c.HelpWriter
 	}
+	if c.CommandHelpWriter == nil {
+		c.CommandHelpWriter = c.ErrorWriter
+	}
+	if c.ExitFunc == nil {
+		c.ExitFunc = os.Exit
+	}
+	if c.Stdin == nil {
+		c.Stdin = os.Stdin
+	}
+	if c.Ui == nil {
+		c.Ui = &BasicUi{
+			Reader:      c.Stdin,
+			Writer:      os.Stdout,
+			ErrorWriter: os.Stderr,
+		}
+	}
 
 	// Build our hidden commands
 	if len(c.HiddenCommands) > 0 {
@@ -261,6 +1381,48 @@ func (c *CLI) init() {
 		}
 	}
 
+	// Register the built-in diagnostics command if requested
+	if k := strings.TrimSpace(c.DiagnosticsCommand); k != "" {
+		if _, ok := c.commandTree.Get(k); !ok {
+			c.commandTree.Insert(k, CommandFactory(c.newDiagnosticsCommand))
+			if strings.ContainsRune(k, ' ') {
+				c.commandNested = true
+			}
+		}
+	}
+
+	// Register the built-in commands command if requested
+	if k := strings.TrimSpace(c.CommandsCommand); k != "" {
+		if _, ok := c.commandTree.Get(k); !ok {
+			c.commandTree.Insert(k, CommandFactory(c.newCommandsCommand))
+			if strings.ContainsRune(k, ' ') {
+				c.commandNested = true
+			}
+		}
+	}
+
+	// Register the built-in validate command if requested
+	if c.ValidateCommand {
+		if _, ok := c.commandTree.Get(validateCommandName); !ok {
+			c.commandTree.Insert(validateCommandName, CommandFactory(c.newValidateCommand))
+			if c.commandHidden == nil {
+				c.commandHidden = make(map[string]struct{})
+			}
+			c.commandHidden[validateCommandName] = struct{}{}
+		}
+	}
+
+	// Register the built-in autocomplete command if requested
+	if c.Autocomplete {
+		if _, ok := c.commandTree.Get(autocompleteCommandName); !ok {
+			c.commandTree.Insert(autocompleteCommandName, CommandFactory(c.newAutocompleteCommand))
+			if c.commandHidden == nil {
+				c.commandHidden = make(map[string]struct{})
+			}
+			c.commandHidden[autocompleteCommandName] = struct{}{}
+		}
+	}
+
 	// Go through the key and fill in any missing parent commands
 	if c.commandNested {
 		var walkFn radix.WalkFn
@@ -290,6 +1452,7 @@ func (c *CLI) init() {
 		c.commandTree.Walk(walkFn)
 
 		// Insert any that we're missing
+		c.commandParents = toInsert
 		for k := range toInsert {
 			var f CommandFactory = func() (Command, error) {
 				return &MockCommand{
@@ -302,11 +1465,38 @@ func (c *CLI) init() {
 		}
 	}
 
+	// Validate the aliases against the final command tree
+	aliases := make([]string, 0, len(c.Aliases))
+	for k := range c.Aliases {
+		aliases = append(aliases, k)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		if _, ok := c.commandTree.Get(strings.Join(strings.Fields(alias), " ")); ok {
+			c.initErr = fmt.Errorf(
+				"alias %q has the same name as a command", alias)
+			break
+		}
+
+		command := strings.Join(strings.Fields(c.Aliases[alias]), " ")
+		if _, ok := c.commandTree.Get(command); !ok || command == "" {
+			c.initErr = fmt.Errorf(
+				"alias %q refers to unknown command %q", alias, c.Aliases[alias])
+			break
+		}
+	}
+
 	// Process the args
 	c.processArgs()
 }
 
 func (c *CLI) commandHelp(out io.Writer, command Command) {
+	c.namedCommandHelp(out, c.Subcommand(), command)
+}
+
+// namedCommandHelp writes the help of command, which is registered as
+// name, to out.
+func (c *CLI) namedCommandHelp(out io.Writer, name string, command Command) {
 	// Get the template to use
 	tpl := strings.TrimSpace(defaultHelpTemplate)
 	if t, ok := command.(CommandHelpTemplate); ok {
@@ -326,59 +1516,14 @@ func (c *CLI) commandHelp(out io.Writer, command Command) {
 	// Template data
 	data := map[string]interface{}{
 		"Name":           c.Name,
-		"SubcommandName": c.Subcommand(),
+		"SubcommandName": name,
 		"Help":           command.Help(),
 	}
 
 	// Build subcommand list if we have it
 	var subcommandsTpl []map[string]interface{}
 	if c.commandNested {
-		// Get the matching keys
-		subcommands := c.helpCommands(c.Subcommand())
-		keys := make([]string, 0, len(subcommands))
-		for k := range subcommands {
-			keys = append(keys, k)
-		}
-
-		// Sort the keys
-		sort.Strings(keys)
-
-		// Figure out the padding length
-		var longest int
-		for _, k := range keys {
-			if v := len(k); v > longest {
-				longest = v
-			}
-		}
-
-		// Go through and create their structures
-		subcommandsTpl = make([]map[string]interface{}, 0, len(subcommands))
-		for _, k := range keys {
-			// Get the command
-			raw, ok := subcommands[k]
-			if !ok {
-				c.ErrorWriter.Write([]byte(fmt.Sprintf(
-					"Error getting subcommand %q", k)))
-			}
-			sub, err := raw()
-			if err != nil {
-				c.ErrorWriter.Write([]byte(fmt.Sprintf(
-					"Error instantiating %q: %s", k, err)))
-			}
-
-			// Find the last space and make sure we only include that last part
-			name := k
-			if idx := strings.LastIndex(k, " "); idx > -1 {
-				name = name[idx+1:]
-			}
-
-			subcommandsTpl = append(subcommandsTpl, map[string]interface{}{
-				"Name":        name,
-				"NameAligned": name + strings.Repeat(" ", longest-len(k)),
-				"Help":        sub.Help(),
-				"Synopsis":    sub.Synopsis(),
-			})
-		}
+		subcommandsTpl = c.subcommandsData(name)
 	}
 	data["Subcommands"] = subcommandsTpl
 
@@ -393,6 +1538,149 @@ func (c *CLI) commandHelp(out io.Writer, command Command) {
 		"Internal error rendering help: %s", err)))
 }
 
+// SubcommandsHelp returns the aligned list of the subcommands of prefix
+// with their synopsis, one per line, as it appears in the help of the
+// command prefix. Hidden subcommands are omitted. This is useful to build
+// a custom help page.
+func (c *CLI) SubcommandsHelp(prefix string) string {
+	c.once.Do(c.init)
+
+	var b strings.Builder
+	for _, sub := range c.subcommandsData(prefix) {
+		fmt.Fprintf(&b, "    %s    %s\n", sub["NameAligned"], sub["Synopsis"])
+	}
+
+	return b.String()
+}
+
+// subcommandsData returns the template data for the subcommands of prefix,
+// sorted by name.
+func (c *CLI) subcommandsData(prefix string) []map[string]interface{} {
+	// Get the matching keys
+	subcommands := c.helpCommands(prefix)
+	keys := make([]string, 0, len(subcommands))
+	for k := range subcommands {
+		keys = append(keys, k)
+	}
+
+	// Sort the keys
+	sort.Strings(keys)
+
+	// Figure out the padding length
+	var longest int
+	for _, k := range keys {
+		if v := VisibleWidth(k); v > longest {
+			longest = v
+		}
+	}
+
+	// Go through and create their structures
+	result := make([]map[string]interface{}, 0, len(subcommands))
+	for _, k := range keys {
+		// Get the command
+		raw, ok := subcommands[k]
+		if !ok {
+			c.ErrorWriter.Write([]byte(fmt.Sprintf(
+				"Error getting subcommand %q", k)))
+		}
+		sub, err := raw()
+		if err != nil {
+			c.ErrorWriter.Write([]byte(fmt.Sprintf(
+				"Error instantiating %q: %s", k, err)))
+		}
+
+		// Find the last space and make sure we only include that last part
+		name := k
+		if idx := strings.LastIndex(k, " "); idx > -1 {
+			name = name[idx+1:]
+		}
+
+		result = append(result, map[string]interface{}{
+			"Name":        name,
+			"NameAligned": name + strings.Repeat(" ", longest-VisibleWidth(k)),
+			"Help":        sub.Help(),
+			"Synopsis":    helpSynopsis(sub),
+		})
+	}
+
+	return result
+}
+
+// basicHelpFunc returns the BasicHelpFunc for app, with a usage line that
+// shows whether the commands of the CLI are nested and colors that follow
+// ForceColor. It is bound to c, so clone leaves it out.
+func (c *CLI) basicHelpFunc(app string) HelpFunc {
+	c.ownHelpFunc = true
+	return basicHelpFunc(app, c)
+}
+
+// helpAliases returns the aliases of each command shown with
+// ShowAliasesInHelp, sorted and keyed by the command they stand for.
+func (c *CLI) helpAliases() map[string][]string {
+	if !c.ShowAliasesInHelp {
+		return nil
+	}
+
+	result := make(map[string][]string)
+	for alias, command := range c.Aliases {
+		alias = strings.Join(strings.Fields(alias), " ")
+		if _, ok := c.commandHidden[alias]; ok {
+			continue
+		}
+
+		command = strings.Join(strings.Fields(command), " ")
+		result[command] = append(result[command], alias)
+	}
+	for _, aliases := range result {
+		sort.Strings(aliases)
+	}
+
+	return result
+}
+
+// hasNestedCommands returns true if any of the commands of the CLI,
+// including the built-in ones, is nested.
+func (c *CLI) hasNestedCommands() bool {
+	for k := range c.Commands {
+		if strings.ContainsRune(k, ' ') {
+			return true
+		}
+	}
+
+	return strings.ContainsRune(strings.TrimSpace(c.DiagnosticsCommand), ' ') ||
+		strings.ContainsRune(strings.TrimSpace(c.CommandsCommand), ' ')
+}
+
+// helpText returns the output of the HelpFunc for the subcommands of
+// prefix, including any CLI level decorations for the root help.
+func (c *CLI) helpText(prefix string) string {
+	commands := c.helpCommands(prefix)
+	if c.CollapseSingleChildren {
+		commands = c.collapseSingleChildren(commands)
+	}
+	help := c.HelpFunc(commands)
+
+	if prefix == "" && len(commands) > 0 && c.HelpEpilogue != "" {
+		help = strings.TrimRight(help, "\n") + "\n\n" + c.HelpEpilogue
+	}
+
+	if prefix == "" && c.HelpShowVersion && c.Version != "" {
+		name := c.Name
+		if name == "" {
+			name = "app"
+		}
+
+		version := c.Version
+		if !strings.HasPrefix(version, "v") {
+			version = "v" + version
+		}
+
+		help = fmt.Sprintf("%s %s\n\n%s", name, version, help)
+	}
+
+	return help
+}
+
 // helpCommands returns the subcommands for the HelpFunc argument.
 // This will only contain immediate subcommands.
 func (c *CLI) helpCommands(prefix string) map[string]CommandFactory {
@@ -432,8 +1720,50 @@ func (c *CLI) helpCommands(prefix string) map[string]CommandFactory {
 	return result
 }
 
+// collapseSingleChildren replaces each automatically created parent in
+// commands that has a single subcommand with that subcommand, as long as
+// that holds.
+func (c *CLI) collapseSingleChildren(commands map[string]CommandFactory) map[string]CommandFactory {
+	result := make(map[string]CommandFactory, len(commands))
+	for k, f := range commands {
+		for {
+			if _, ok := c.commandParents[k]; !ok {
+				break
+			}
+
+			children := c.helpCommands(k)
+			if len(children) != 1 {
+				break
+			}
+
+			for child, childFactory := range children {
+				k, f = child, childFactory
+			}
+		}
+
+		result[k] = f
+	}
+
+	return result
+}
+
+// defaultCommandOnly returns true if the default command is the only
+// command listed in the root help.
+func (c *CLI) defaultCommandOnly() bool {
+	commands := c.helpCommands("")
+	_, ok := commands[""]
+	return ok && len(commands) == 1
+}
+
 func (c *CLI) processArgs() {
+	skip := 0
 	for i, arg := range c.Args {
+		// Skip the values of global flags
+		if skip > 0 {
+			skip--
+			continue
+		}
+
 		if arg == "--" {
 			break
 		}
@@ -451,6 +1781,16 @@ func (c *CLI) processArgs() {
 				continue
 			}
 
+			// Check for the flags the CLI handles itself.
+			if name, value, consumed, ok := c.parseGlobalFlag(c.Args[i:]); ok {
+				if c.globalFlags == nil {
+					c.globalFlags = make(map[string]string)
+				}
+				c.globalFlags[name] = value
+				skip = consumed - 1
+				continue
+			}
+
 			if arg != "" && arg[0] == '-' {
 				// Record the arg...
 				c.topFlags = append(c.topFlags, arg)
@@ -460,7 +1800,17 @@ func (c *CLI) processArgs() {
 		// If we didn't find a subcommand yet and this is the first non-flag
 		// argument, then this is our subcommand.
 		if c.subcommand == "" && arg != "" && arg[0] != '-' {
-			c.subcommand = arg
+			// Replace an alias with the command it stands for.
+			rest := c.Args[i:]
+			if canonical, consumed, ok := c.matchAlias(rest); ok {
+				rest = append(strings.Fields(canonical), rest[consumed:]...)
+			}
+			if c.AllowPrefixMatch {
+				rest = c.expandCommandPrefix(rest)
+			}
+
+			c.subcommand = rest[0]
+			n := 1
 			if c.commandNested {
 				// If the command has a space in it, then it is invalid.
 				// Set a blank command so that it fails.
@@ -469,39 +1819,18 @@ func (c *CLI) processArgs() {
 					return
 				}
 
-				// Determine the argument we look to to end subcommands.
-				// We look at all arguments until one is a flag or has a space.
-				// This disallows commands like: ./cli foo "bar baz". An
-				// argument with a space is always an argument. A blank
-				// argument is always an argument.
-				j := 0
-				for k, v := range c.Args[i:] {
-					if strings.ContainsRune(v, ' ') || v == "" || v[0] == '-' {
-						break
-					}
-
-					j = i + k + 1
-				}
-
 				// Nested CLI, the subcommand is actually the entire
 				// arg list up to a flag that is still a valid subcommand.
-				searchKey := strings.Join(c.Args[i:j], " ")
-				k, _, ok := c.commandTree.LongestPrefix(searchKey)
-				if ok {
-					// k could be a prefix that doesn't contain the full
-					// command such as "foo" instead of "foobar", so we
-					// need to verify that we have an entire key. To do that,
-					// we look for an ending in a space or an end of string.
-					reVerify := regexp.MustCompile(regexp.QuoteMeta(k) + `( |$)`)
-					if reVerify.MatchString(searchKey) {
-						c.subcommand = k
-						i += strings.Count(k, " ")
+				if k, consumed, ok := c.matchCommand(rest); ok {
+					c.subcommand = k
+					if consumed > 0 {
+						n = consumed
 					}
 				}
 			}
 
 			// The remaining args the subcommand arguments
-			c.subcommandArgs = c.Args[i+1:]
+			c.subcommandArgs = rest[n:]
 		}
 	}
 
@@ -515,6 +1844,39 @@ func (c *CLI) processArgs() {
 			c.subcommandArgs = args
 		}
 	}
+
+	if c.ForwardGlobalFlags && len(c.globalFlags) > 0 {
+		args := c.forwardedGlobalFlags()
+		args = append(args, c.subcommandArgs...)
+		c.subcommandArgs = args
+	}
+}
+
+// forwardedGlobalFlags returns the global flags that were given in the
+// normalized form that ForwardGlobalFlags passes them to the command in.
+func (c *CLI) forwardedGlobalFlags() []string {
+	names := make([]string, 0, len(c.globalFlags))
+	for name := range c.globalFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]string, len(names))
+	for i, name := range names {
+		args[i] = "--" + name
+		if globalFlagTakesValue(name) {
+			args[i] += "=" + c.globalFlags[name]
+		}
+	}
+
+	return args
+}
+
+// globalFlagTakesValue returns whether the global flag with the given
+// canonical name takes a value.
+func globalFlagTakesValue(name string) bool {
+	flag, ok := cliGlobalFlags["--"+name]
+	return ok && flag.value
 }
 
 const defaultHelpTemplate = `
@@ -2,11 +2,20 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"runtime/debug"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCLIIsHelp(t *testing.T) {
@@ -193,50 +202,64 @@ func TestCLIRun_subcommandSuffix(t *testing.T) {
 	}
 }
 
-func TestCLIRun_default(t *testing.T) {
-	commandBar := new(MockCommand)
-	commandBar.RunResult = 42
-
-	cli := &CLI{
-		Args: []string{"-bar", "-baz"},
-		Commands: map[string]CommandFactory{
-			"": func() (Command, error) {
-				return commandBar, nil
-			},
-			"foo": func() (Command, error) {
-				return new(MockCommand), nil
-			},
-		},
-	}
-
-	exitCode, err := cli.Run()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+func TestCLIRun_quiet(t *testing.T) {
+	testCases := []struct {
+		args  []string
+		quiet bool
+	}{
+		{[]string{"nope"}, false},
+		{[]string{"-q", "nope"}, true},
+		{[]string{"-quiet", "nope"}, true},
+		{[]string{"--quiet", "nope"}, true},
 	}
 
-	if exitCode != commandBar.RunResult {
-		t.Fatalf("bad: %d", exitCode)
-	}
+	for _, tc := range testCases {
+		helpBuf := new(bytes.Buffer)
+		errorBuf := new(bytes.Buffer)
+		cli := &CLI{
+			Args: tc.args,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+			},
+			HelpWriter:  helpBuf,
+			ErrorWriter: errorBuf,
+			QuietFlag:   true,
+		}
 
-	if !commandBar.RunCalled {
-		t.Fatalf("run should be called")
-	}
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("Args: %#v. err: %s", tc.args, err)
+		}
 
-	if !reflect.DeepEqual(commandBar.RunArgs, []string{"-bar", "-baz"}) {
-		t.Fatalf("bad args: %#v", commandBar.RunArgs)
+		if exitCode != 127 {
+			t.Fatalf("Args: %#v. bad: %d", tc.args, exitCode)
+		}
+		if helpBuf.String() != "" {
+			t.Fatalf("Args: %#v. bad: %#v", tc.args, helpBuf.String())
+		}
+		if (errorBuf.String() == "") != tc.quiet {
+			t.Fatalf("Args: %#v. bad: %#v", tc.args, errorBuf.String())
+		}
+		if cli.ErrorWriter != errorBuf {
+			t.Fatalf("Args: %#v. ErrorWriter not restored", tc.args)
+		}
 	}
 }
 
-// GH-74: When using NewCLI with a default command only, Run would
-// stack overflow and crash.
-func TestCLIRun_defaultFromNew(t *testing.T) {
-	commandBar := new(MockCommand)
-
-	cli := NewCLI("test", "0.1.0")
-	cli.Commands = map[string]CommandFactory{
-		"": func() (Command, error) {
-			return commandBar, nil
+func TestCLIRun_quietCommand(t *testing.T) {
+	buf := new(bytes.Buffer)
+	command := &MockCommand{RunResult: 42}
+	cli := &CLI{
+		Args: []string{"-q", "foo", "-bar"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
 		},
+		ErrorWriter: buf,
+		QuietFlag:   true,
 	}
 
 	exitCode, err := cli.Run()
@@ -244,132 +267,263 @@ func TestCLIRun_defaultFromNew(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if exitCode != commandBar.RunResult {
+	if exitCode != 42 {
 		t.Fatalf("bad: %d", exitCode)
 	}
-
-	if !commandBar.RunCalled {
-		t.Fatalf("run should be called")
+	if !reflect.DeepEqual(command.RunArgs, []string{"-bar"}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+	if buf.String() != "" {
+		t.Fatalf("bad: %#v", buf.String())
 	}
 }
 
-func TestCLIRun_helpNested(t *testing.T) {
-	helpCalled := false
+func TestCLIRun_notFoundFunc(t *testing.T) {
 	buf := new(bytes.Buffer)
+	command := new(MockCommand)
 	cli := &CLI{
-		Args: []string{"--help"},
+		Args: []string{"bogus", "-o=foo"},
 		Commands: map[string]CommandFactory{
-			"foo sub42": func() (Command, error) {
-				return new(MockCommand), nil
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+			"bar": func() (Command, error) {
+				return command, nil
+			},
+			"hidden": func() (Command, error) {
+				return command, nil
 			},
 		},
-		HelpFunc: func(m map[string]CommandFactory) string {
-			helpCalled = true
-
-			var keys []string
-			for k := range m {
+		HiddenCommands: []string{"hidden"},
+		NotFoundFunc: func(attempted string, available map[string]CommandFactory) string {
+			keys := make([]string, 0, len(available))
+			for k := range available {
 				keys = append(keys, k)
 			}
 			sort.Strings(keys)
 
-			expected := []string{"foo"}
-			if !reflect.DeepEqual(keys, expected) {
-				return fmt.Sprintf("error: contained sub: %#v", keys)
-			}
-
-			return ""
+			return fmt.Sprintf("Unknown command %q, try one of: %s",
+				attempted, strings.Join(keys, ", "))
 		},
 		ErrorWriter: buf,
 	}
 
-	code, err := cli.Run()
+	exitCode, err := cli.Run()
 	if err != nil {
-		t.Fatalf("Error: %s", err)
+		t.Fatalf("err: %s", err)
 	}
 
-	if code != 0 {
-		t.Fatalf("Code: %d", code)
+	if exitCode != 127 {
+		t.Fatalf("bad: %d", exitCode)
 	}
 
-	if !helpCalled {
-		t.Fatal("help not called")
+	if command.RunCalled {
+		t.Fatalf("run should not be called")
 	}
-}
 
-func TestCLIRun_nested(t *testing.T) {
-	command := new(MockCommand)
-	cli := &CLI{
-		Args: []string{"foo", "bar", "-bar", "-baz"},
-		Commands: map[string]CommandFactory{
-			"foo": func() (Command, error) {
-				return new(MockCommand), nil
-			},
-			"foo bar": func() (Command, error) {
-				return command, nil
-			},
-		},
+	expected := "Unknown command \"bogus\", try one of: bar, foo\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v", buf.String())
 	}
+}
 
-	exitCode, err := cli.Run()
-	if err != nil {
-		t.Fatalf("err: %s", err)
-	}
+func TestCLIRun_aliases(t *testing.T) {
+	testCases := []struct {
+		args       []string
+		subcommand string
+		runArgs    []string
+	}{
+		{[]string{"ls"}, "list", []string{}},
+		{[]string{"rm", "-f", "a"}, "remove", []string{"-f", "a"}},
+		{[]string{"list", "x"}, "list", []string{"x"}},
+		{[]string{"img", "ls", "-a"}, "image list", []string{"-a"}},
+		{[]string{"img", "ls", "all", "x"}, "image list all", []string{"x"}},
+		{[]string{"-C", ".", "ls"}, "list", []string{}},
+		{[]string{"image", "ls"}, "image", []string{"ls"}},
+	}
+
+	for _, tc := range testCases {
+		commands := make(map[string]*MockCommand)
+		factory := func(k string) CommandFactory {
+			commands[k] = new(MockCommand)
+			return func() (Command, error) {
+				return commands[k], nil
+			}
+		}
 
-	if exitCode != command.RunResult {
-		t.Fatalf("bad: %d", exitCode)
-	}
+		cli := &CLI{
+			Args: tc.args,
+			Commands: map[string]CommandFactory{
+				"list":           factory("list"),
+				"remove":         factory("remove"),
+				"image":          factory("image"),
+				"image list":     factory("image list"),
+				"image list all": factory("image list all"),
+			},
+			Aliases: map[string]string{
+				"ls":     "list",
+				"rm":     "remove",
+				"img ls": "image list",
+			},
+			ChdirFlag: true,
+		}
 
-	if !command.RunCalled {
-		t.Fatalf("run should be called")
-	}
+		if _, err := cli.Run(); err != nil {
+			t.Fatalf("Args: %#v. err: %s", tc.args, err)
+		}
 
-	if !reflect.DeepEqual(command.RunArgs, []string{"-bar", "-baz"}) {
-		t.Fatalf("bad args: %#v", command.RunArgs)
+		if cli.Subcommand() != tc.subcommand {
+			t.Fatalf("Args: %#v. Bad subcommand: %q", tc.args, cli.Subcommand())
+		}
+		command := commands[tc.subcommand]
+		if !command.RunCalled {
+			t.Fatalf("Args: %#v. Run should be called", tc.args)
+		}
+		if !reflect.DeepEqual(command.RunArgs, tc.runArgs) {
+			t.Fatalf("Args: %#v. Bad args: %#v", tc.args, command.RunArgs)
+		}
 	}
 }
 
-func TestCLIRun_nestedTopLevel(t *testing.T) {
-	command := new(MockCommand)
+func TestCLIRun_aliasesHelp(t *testing.T) {
+	buf := new(bytes.Buffer)
 	cli := &CLI{
-		Args: []string{"foo"},
+		Args: []string{"--help"},
 		Commands: map[string]CommandFactory{
-			"foo": func() (Command, error) {
-				return command, nil
-			},
-			"foo bar": func() (Command, error) {
-				return new(MockCommand), nil
+			"list": func() (Command, error) {
+				return &MockCommand{SynopsisText: "List"}, nil
 			},
 		},
+		Aliases:    map[string]string{"ls": "list"},
+		HelpWriter: buf,
 	}
 
-	exitCode, err := cli.Run()
-	if err != nil {
+	if _, err := cli.Run(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if exitCode != command.RunResult {
-		t.Fatalf("bad: %d", exitCode)
+	if !strings.HasSuffix(buf.String(), "Available commands are:\n    list    List\n\n") {
+		t.Fatalf("bad: %#v", buf.String())
 	}
+}
 
-	if !command.RunCalled {
-		t.Fatalf("run should be called")
+func TestCLIRun_aliasesInvalid(t *testing.T) {
+	testCases := []struct {
+		aliases map[string]string
+		err     string
+	}{
+		{
+			map[string]string{"list": "remove"},
+			`alias "list" has the same name as a command`,
+		},
+		{
+			map[string]string{"image": "list"},
+			`alias "image" has the same name as a command`,
+		},
+		{
+			map[string]string{"ls": "lst"},
+			`alias "ls" refers to unknown command "lst"`,
+		},
 	}
 
-	if !reflect.DeepEqual(command.RunArgs, []string{}) {
-		t.Fatalf("bad args: %#v", command.RunArgs)
+	for _, tc := range testCases {
+		command := new(MockCommand)
+		cli := &CLI{
+			Args: []string{"list"},
+			Commands: map[string]CommandFactory{
+				"list": func() (Command, error) {
+					return command, nil
+				},
+				"remove": func() (Command, error) {
+					return command, nil
+				},
+				"image list": func() (Command, error) {
+					return command, nil
+				},
+			},
+			Aliases: tc.aliases,
+		}
+
+		exitCode, err := cli.Run()
+		if err == nil || err.Error() != tc.err {
+			t.Fatalf("bad err: %#v", err)
+		}
+		if exitCode != 1 {
+			t.Fatalf("bad: %d", exitCode)
+		}
+		if command.RunCalled {
+			t.Fatal("run should not be called")
+		}
 	}
 }
 
-func TestCLIRun_nestedMissingParent(t *testing.T) {
+func TestCLIRun_prefixMatch(t *testing.T) {
+	testCases := []struct {
+		args       []string
+		subcommand string
+		runArgs    []string
+	}{
+		{[]string{"che", "-f"}, "checkout", []string{"-f"}},
+		{[]string{"com"}, "commit", []string{}},
+		{[]string{"commit", "x"}, "commit", []string{"x"}},
+		{[]string{"re", "add", "x"}, "remote add", []string{"x"}},
+		{[]string{"remote", "a"}, "remote", []string{"a"}},
+	}
+
+	for _, tc := range testCases {
+		commands := make(map[string]*MockCommand)
+		factory := func(k string) CommandFactory {
+			commands[k] = new(MockCommand)
+			return func() (Command, error) {
+				return commands[k], nil
+			}
+		}
+
+		cli := &CLI{
+			Args: tc.args,
+			Commands: map[string]CommandFactory{
+				"checkout":   factory("checkout"),
+				"commit":     factory("commit"),
+				"remote":     factory("remote"),
+				"remote add": factory("remote add"),
+				"rebuild":    factory("rebuild"),
+			},
+			HiddenCommands:   []string{"rebuild"},
+			AllowPrefixMatch: true,
+		}
+
+		if _, err := cli.Run(); err != nil {
+			t.Fatalf("Args: %#v. err: %s", tc.args, err)
+		}
+
+		if cli.Subcommand() != tc.subcommand {
+			t.Fatalf("Args: %#v. Bad subcommand: %q", tc.args, cli.Subcommand())
+		}
+		command := commands[tc.subcommand]
+		if !command.RunCalled {
+			t.Fatalf("Args: %#v. Run should be called", tc.args)
+		}
+		if !reflect.DeepEqual(command.RunArgs, tc.runArgs) {
+			t.Fatalf("Args: %#v. Bad args: %#v", tc.args, command.RunArgs)
+		}
+	}
+}
+
+func TestCLIRun_prefixMatchAmbiguous(t *testing.T) {
 	buf := new(bytes.Buffer)
+	command := new(MockCommand)
 	cli := &CLI{
-		Args: []string{"foo"},
+		Args: []string{"c", "-f"},
 		Commands: map[string]CommandFactory{
-			"foo bar": func() (Command, error) {
-				return &MockCommand{SynopsisText: "hi!"}, nil
+			"checkout": func() (Command, error) {
+				return command, nil
+			},
+			"commit": func() (Command, error) {
+				return command, nil
 			},
 		},
-		ErrorWriter: buf,
+		AllowPrefixMatch: true,
+		ErrorWriter:      buf,
 	}
 
 	exitCode, err := cli.Run()
@@ -377,27 +531,27 @@ func TestCLIRun_nestedMissingParent(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if exitCode != 1 {
-		t.Fatalf("bad exit code: %d", exitCode)
+	if exitCode != 127 {
+		t.Fatalf("bad: %d", exitCode)
 	}
-
-	if buf.String() != testCommandNestedMissingParent {
+	if command.RunCalled {
+		t.Fatal("run should not be called")
+	}
+	if buf.String() != "Ambiguous command \"c\", could be: checkout, commit\n" {
 		t.Fatalf("bad: %#v", buf.String())
 	}
 }
 
-func TestCLIRun_nestedNoArgs(t *testing.T) {
+func TestCLIRun_prefixMatchDisabled(t *testing.T) {
 	command := new(MockCommand)
 	cli := &CLI{
-		Args: []string{"foo", "bar"},
+		Args: []string{"che"},
 		Commands: map[string]CommandFactory{
-			"foo": func() (Command, error) {
-				return new(MockCommand), nil
-			},
-			"foo bar": func() (Command, error) {
+			"checkout": func() (Command, error) {
 				return command, nil
 			},
 		},
+		ErrorWriter: new(bytes.Buffer),
 	}
 
 	exitCode, err := cli.Run()
@@ -405,28 +559,22 @@ func TestCLIRun_nestedNoArgs(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if exitCode != command.RunResult {
+	if exitCode != 127 || command.RunCalled {
 		t.Fatalf("bad: %d", exitCode)
 	}
-
-	if !command.RunCalled {
-		t.Fatalf("run should be called")
-	}
-
-	if !reflect.DeepEqual(command.RunArgs, []string{}) {
-		t.Fatalf("bad args: %#v", command.RunArgs)
-	}
 }
 
-func TestCLIRun_nestedBlankArg(t *testing.T) {
-	command := new(MockCommand)
+func TestCLIRun_default(t *testing.T) {
+	commandBar := new(MockCommand)
+	commandBar.RunResult = 42
+
 	cli := &CLI{
-		Args: []string{"foo", "", "bar", "-baz"},
+		Args: []string{"-bar", "-baz"},
 		Commands: map[string]CommandFactory{
-			"foo": func() (Command, error) {
-				return command, nil
+			"": func() (Command, error) {
+				return commandBar, nil
 			},
-			"foo bar": func() (Command, error) {
+			"foo": func() (Command, error) {
 				return new(MockCommand), nil
 			},
 		},
@@ -437,111 +585,2142 @@ func TestCLIRun_nestedBlankArg(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if exitCode != command.RunResult {
+	if exitCode != commandBar.RunResult {
 		t.Fatalf("bad: %d", exitCode)
 	}
 
-	if !command.RunCalled {
+	if !commandBar.RunCalled {
 		t.Fatalf("run should be called")
 	}
 
-	if !reflect.DeepEqual(command.RunArgs, []string{"", "bar", "-baz"}) {
-		t.Fatalf("bad args: %#v", command.RunArgs)
+	if !reflect.DeepEqual(commandBar.RunArgs, []string{"-bar", "-baz"}) {
+		t.Fatalf("bad args: %#v", commandBar.RunArgs)
+	}
+}
+
+func TestCLIRun_defaultGlobalFlags(t *testing.T) {
+	testCases := []struct {
+		args    []string
+		enable  func(*CLI)
+		runArgs []string
+	}{
+		{[]string{"-yes", "-x"}, func(*CLI) {}, []string{"-yes", "-x"}},
+		{[]string{"--force"}, func(*CLI) {}, []string{"--force"}},
+		{[]string{"-yes", "-x"}, func(c *CLI) { c.YesFlag = true }, []string{"-x"}},
+		{[]string{"-C=/nonexistent", "-x"}, func(*CLI) {}, []string{"-C=/nonexistent", "-x"}},
+		{[]string{"--chdir=/nonexistent"}, func(*CLI) {}, []string{"--chdir=/nonexistent"}},
+		{[]string{"--output-file=out.txt", "-x"}, func(*CLI) {}, []string{"--output-file=out.txt", "-x"}},
+		{[]string{"-q"}, func(*CLI) {}, []string{"-q"}},
+		{[]string{"--quiet", "-x"}, func(*CLI) {}, []string{"--quiet", "-x"}},
+		{[]string{"-q", "-x"}, func(c *CLI) { c.QuietFlag = true }, []string{"-x"}},
+	}
+
+	for _, tc := range testCases {
+		command := new(MockCommand)
+		cli := &CLI{
+			Args: tc.args,
+			Commands: map[string]CommandFactory{
+				"": func() (Command, error) {
+					return command, nil
+				},
+			},
+		}
+		tc.enable(cli)
+
+		if _, err := cli.Run(); err != nil {
+			t.Fatalf("Args: %#v. err: %s", tc.args, err)
+		}
+
+		if !reflect.DeepEqual(command.RunArgs, tc.runArgs) {
+			t.Fatalf("Args: %#v. Bad args: %#v", tc.args, command.RunArgs)
+		}
+	}
+}
+
+// GH-74: When using NewCLI with a default command only, Run would
+// stack overflow and crash.
+func TestCLIRun_defaultFromNew(t *testing.T) {
+	commandBar := new(MockCommand)
+
+	cli := NewCLI("test", "0.1.0")
+	cli.Commands = map[string]CommandFactory{
+		"": func() (Command, error) {
+			return commandBar, nil
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != commandBar.RunResult {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if !commandBar.RunCalled {
+		t.Fatalf("run should be called")
+	}
+}
+
+func TestCLIRun_defaultOnlyHelp(t *testing.T) {
+	buf := new(bytes.Buffer)
+	command := &MockCommand{HelpText: "Usage: app [-bar]"}
+	cli := &CLI{
+		Args: []string{"-bar", "--help"},
+		Commands: map[string]CommandFactory{
+			"": func() (Command, error) {
+				return command, nil
+			},
+			"hidden": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		HiddenCommands: []string{"hidden"},
+		HelpWriter:     buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if command.RunCalled {
+		t.Fatal("run should not be called")
+	}
+
+	if buf.String() != "Usage: app [-bar]\n" {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIRun_defaultHelpWithOtherCommands(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"--help"},
+		Commands: map[string]CommandFactory{
+			"": func() (Command, error) {
+				return &MockCommand{HelpText: "default help"}, nil
+			},
+			"foo": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Foo"}, nil
+			},
+		},
+		HelpWriter: buf,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if strings.Contains(buf.String(), "default help") || !strings.Contains(buf.String(), "Foo") {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIRun_noCommands(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args:       []string{"foo"},
+		Commands:   map[string]CommandFactory{},
+		HelpWriter: buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 126 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if buf.String() != "no commands are defined\n" {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIMain(t *testing.T) {
+	var exitCodes []int
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{RunResult: 42}, nil
+			},
+		},
+		ExitFunc: func(code int) {
+			exitCodes = append(exitCodes, code)
+		},
+	}
+
+	cli.Main()
+	if !reflect.DeepEqual(exitCodes, []int{42}) {
+		t.Fatalf("bad: %#v", exitCodes)
+	}
+}
+
+func TestCLIMain_error(t *testing.T) {
+	var exitCodes []int
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return nil, fmt.Errorf("broken")
+			},
+		},
+		ErrorWriter: buf,
+		ExitFunc: func(code int) {
+			exitCodes = append(exitCodes, code)
+		},
+	}
+
+	cli.Main()
+	if !reflect.DeepEqual(exitCodes, []int{1}) {
+		t.Fatalf("bad: %#v", exitCodes)
+	}
+
+	if buf.String() != "Error executing CLI: broken\n" {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIRunAsync(t *testing.T) {
+	commandFoo := &MockCommand{RunResult: 1}
+	commandBar := &MockCommand{RunResult: 2}
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return commandFoo, nil
+			},
+			"bar": func() (Command, error) {
+				return commandBar, nil
+			},
+		},
+	}
+
+	fooCh := cli.RunAsync([]string{"foo", "-a"})
+	barCh := cli.RunAsync([]string{"bar", "-b"})
+
+	for _, tc := range []struct {
+		ch      <-chan RunResult
+		command *MockCommand
+		args    []string
+	}{
+		{fooCh, commandFoo, []string{"-a"}},
+		{barCh, commandBar, []string{"-b"}},
+	} {
+		result := <-tc.ch
+		if result.Err != nil {
+			t.Fatalf("err: %s", result.Err)
+		}
+		if result.ExitCode != tc.command.RunResult {
+			t.Fatalf("bad: %d", result.ExitCode)
+		}
+		if !reflect.DeepEqual(tc.command.RunArgs, tc.args) {
+			t.Fatalf("bad args: %#v", tc.command.RunArgs)
+		}
+
+		if _, ok := <-tc.ch; ok {
+			t.Fatal("channel should be closed")
+		}
+	}
+
+	if cli.Subcommand() != "" {
+		t.Fatalf("original CLI should not be parsed: %#v", cli.Subcommand())
+	}
+}
+
+func TestCLIRunContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+
+	command := new(MockCommandContext)
+	cli := &CLI{
+		Args: []string{"foo", "-bar"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+	}
+
+	exitCode, err := cli.RunContext(ctx)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+	if !command.RunContextCalled {
+		t.Fatal("run context should be called")
+	}
+	if command.RunContextCtx.Value(ctxKey{}) != "value" {
+		t.Fatalf("bad ctx: %#v", command.RunContextCtx)
+	}
+	if !reflect.DeepEqual(command.RunArgs, []string{"-bar"}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRunContext_plainCommand(t *testing.T) {
+	command := &MockCommand{RunResult: 42}
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+	}
+
+	exitCode, err := cli.RunContext(context.Background())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 42 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+	if !command.RunCalled {
+		t.Fatal("run should be called")
+	}
+}
+
+func TestCLIRunContext_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	command := new(MockCommandContext)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+	}
+
+	exitCode, err := cli.RunContext(ctx)
+	if err != context.Canceled {
+		t.Fatalf("bad err: %#v", err)
+	}
+
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+	if command.RunCalled || command.RunContextCalled {
+		t.Fatal("run should not be called")
+	}
+}
+
+func TestCLIRun_commandWithError(t *testing.T) {
+	testCases := []struct {
+		runResult int
+		runError  error
+		output    string
+	}{
+		{0, nil, ""},
+		{3, nil, ""},
+		{4, fmt.Errorf("disk full"), "Error: disk full\n"},
+		{0, fmt.Errorf("odd"), "Error: odd\n"},
+	}
+
+	for _, tc := range testCases {
+		buf := new(bytes.Buffer)
+		command := &MockCommandWithError{RunError: tc.runError}
+		command.RunResult = tc.runResult
+		cli := &CLI{
+			Args: []string{"foo", "-bar"},
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return command, nil
+				},
+			},
+			ErrorWriter: buf,
+		}
+
+		exitCode, err := cli.Run()
+		if err != tc.runError {
+			t.Fatalf("bad err: %#v", err)
+		}
+
+		if exitCode != tc.runResult {
+			t.Fatalf("bad: %d", exitCode)
+		}
+		if !command.RunECalled {
+			t.Fatal("RunE should be called")
+		}
+		if !reflect.DeepEqual(command.RunArgs, []string{"-bar"}) {
+			t.Fatalf("bad args: %#v", command.RunArgs)
+		}
+		if buf.String() != tc.output {
+			t.Fatalf("bad: %#v", buf.String())
+		}
+	}
+}
+
+func TestCLIAddCommand(t *testing.T) {
+	command := new(MockCommand)
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args:       []string{"--help"},
+		HelpWriter: buf,
+	}
+
+	cli.AddCommand("foo", func() (Command, error) {
+		return &MockCommand{SynopsisText: "Foo"}, nil
+	})
+	cli.AddCommand("bar", func() (Command, error) {
+		return command, nil
+	})
+	cli.AddHiddenCommand("secret", func() (Command, error) {
+		return &MockCommand{SynopsisText: "Secret"}, nil
+	})
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !cli.HasCommand("bar") || !cli.HasCommand("secret") {
+		t.Fatal("commands should be registered")
+	}
+	if !reflect.DeepEqual(cli.HiddenCommands, []string{"secret"}) {
+		t.Fatalf("bad: %#v", cli.HiddenCommands)
+	}
+
+	expected := "    bar    \n    foo    Foo\n"
+	if !strings.HasSuffix(buf.String(), expected+"\n") {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIAddCommand_afterInit(t *testing.T) {
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("should panic")
+		}
+		if !strings.Contains(fmt.Sprint(r), "after the CLI was initialized") {
+			t.Fatalf("bad: %#v", r)
+		}
+	}()
+
+	cli.AddCommand("bar", func() (Command, error) {
+		return new(MockCommand), nil
+	})
+}
+
+// testForceColorCLI returns a CLI that lists the commands matching "net"
+// with the matches highlighted, and the expected output.
+func testForceColorCLI(forceColor *bool) (*CLI, *bytes.Buffer, string) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"--help", "net"},
+		Commands: map[string]CommandFactory{
+			"network": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Network stuff"}, nil
+			},
+		},
+		HelpWriter: buf,
+		ForceColor: forceColor,
+	}
+
+	color := NewColor(ColorFgYellow, ColorBold).forced(forceColor)
+	match := func(s string) string { return color.Sprint(s) }
+	expected := "Commands matching \"net\":\n\n" +
+		"    " + match("net") + "work    " + match("Net") + "work stuff\n"
+
+	return cli, buf, expected
+}
+
+func TestCLIRun_forceColor(t *testing.T) {
+	oldNoColor, oldNoColorError := NoColor, NoColorError
+	defer func() { NoColor, NoColorError = oldNoColor, oldNoColorError }()
+
+	for _, noColor := range []bool{true, false} {
+		NoColor, NoColorError = noColor, noColor
+
+		for _, forceColor := range []*bool{boolPtr(true), boolPtr(false)} {
+			cli, buf, expected := testForceColorCLI(forceColor)
+			if _, err := cli.Run(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if buf.String() != expected {
+				t.Fatalf("bad: %#v", buf.String())
+			}
+			if NoColor != noColor || NoColorError != noColor {
+				t.Fatalf("globals changed: %v, %v", NoColor, NoColorError)
+			}
+		}
+	}
+}
+
+func TestCLIRun_forceColorStrips(t *testing.T) {
+	red := NewColor(ColorFgRed)
+	red.EnableColor()
+
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"-h"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		HelpFunc: func(map[string]CommandFactory) string {
+			return red.Sprint("help")
+		},
+		HelpWriter: buf,
+		ForceColor: boolPtr(false),
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if buf.String() != "help\n" {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIRun_forceColorConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		cli, buf, expected := testForceColorCLI(boolPtr(i%2 == 0))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := cli.Run(); err != nil {
+				t.Errorf("err: %s", err)
+				return
+			}
+			if buf.String() != expected {
+				t.Errorf("bad: %#v", buf.String())
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestCLIRun_warnAsError(t *testing.T) {
+	testCases := []struct {
+		warnAsError bool
+		runResult   int
+		expected    int
+		output      string
+	}{
+		{true, 0, 1, "Error: 1 warning(s) treated as errors\n"},
+		{false, 0, 0, ""},
+		{true, 3, 3, ""},
+	}
+
+	for _, tc := range testCases {
+		buf := new(bytes.Buffer)
+		ui := &CountingUi{Ui: NewMockUi()}
+		cli := &CLI{
+			Args: []string{"foo"},
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return &funcCommand{
+						run: func([]string) int {
+							ui.Warn("deprecated option")
+							return tc.runResult
+						},
+					}, nil
+				},
+			},
+			ErrorWriter: buf,
+			Ui:          ui,
+			WarnAsError: tc.warnAsError,
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if exitCode != tc.expected {
+			t.Fatalf("bad: %d", exitCode)
+		}
+		if buf.String() != tc.output {
+			t.Fatalf("bad: %#v", buf.String())
+		}
+	}
+}
+
+func TestCLIRun_warnAsErrorNoWarnings(t *testing.T) {
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		Ui:          &CountingUi{Ui: NewMockUi()},
+		WarnAsError: true,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+}
+
+func TestCLIRun_printSummary(t *testing.T) {
+	mock := NewMockUi()
+	ui := &CountingUi{Ui: mock}
+	newCLI := func(run func([]string) int) *CLI {
+		return &CLI{
+			Args: []string{"foo"},
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return &funcCommand{run: run}, nil
+				},
+			},
+			Ui:           ui,
+			PrintSummary: true,
+		}
+	}
+
+	exitCode, err := newCLI(func([]string) int {
+		ui.Output("working")
+		ui.Error("oops")
+		return 1
+	}).Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if StripColor(mock.OutputWriter.String()) != "working\n1 error, 0 warnings\n" {
+		t.Fatalf("bad: %#v", mock.OutputWriter.String())
+	}
+
+	// A second run sharing the Ui only reports its own counts
+	mock.OutputWriter.Reset()
+	exitCode, err = newCLI(func([]string) int {
+		ui.Warn("careful")
+		return 0
+	}).Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if StripColor(mock.OutputWriter.String()) != "0 errors, 1 warning\n" {
+		t.Fatalf("bad: %#v", mock.OutputWriter.String())
+	}
+}
+
+func TestCLIRun_commandWithFlags(t *testing.T) {
+	fs := flag.NewFlagSet("foo", flag.ContinueOnError)
+	verbose := fs.Bool("verbose", false, "")
+	name := fs.String("name", "", "")
+
+	command := &MockCommandWithFlags{FlagSet: fs}
+	cli := &CLI{
+		Args: []string{"foo", "-verbose", "-name=bar", "one", "two"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != command.RunResult {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if !*verbose || *name != "bar" {
+		t.Fatalf("bad flags: %v %q", *verbose, *name)
+	}
+	if !reflect.DeepEqual(command.RunArgs, []string{"one", "two"}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRun_commandWithFlagsError(t *testing.T) {
+	buf := new(bytes.Buffer)
+	command := &MockCommandWithFlags{
+		MockCommand: MockCommand{HelpText: "Usage: foo [-verbose]"},
+		FlagSet:     flag.NewFlagSet("foo", flag.ContinueOnError),
+	}
+	cli := &CLI{
+		Args: []string{"foo", "-bogus"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		ErrorWriter: buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if command.RunCalled {
+		t.Fatal("run should not be called")
+	}
+	expected := "Error: flag provided but not defined: -bogus\nUsage: foo [-verbose]\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIRun_beforeAfterRun(t *testing.T) {
+	testCases := []struct {
+		runResult int
+		expected  int
+	}{
+		{0, 0},
+		{42, 42},
+		{RunResultHelp, 1},
+		{RunResultUsage, 2},
+	}
+
+	for _, tc := range testCases {
+		var events []string
+		command := &MockCommand{RunResult: tc.runResult}
+		cli := &CLI{
+			Args: []string{"foo", "bar"},
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return command, nil
+				},
+			},
+			BeforeRun: func(command string, args []string) error {
+				events = append(events, fmt.Sprintf("before %s %v", command, args))
+				return nil
+			},
+			AfterRun: func(command string, args []string, exitCode int) {
+				events = append(events, fmt.Sprintf("after %s %v %d", command, args, exitCode))
+			},
+			ErrorWriter: new(bytes.Buffer),
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if exitCode != tc.expected {
+			t.Fatalf("bad: %d", exitCode)
+		}
+
+		expected := []string{
+			"before foo [bar]",
+			fmt.Sprintf("after foo [bar] %d", tc.expected),
+		}
+		if !reflect.DeepEqual(events, expected) {
+			t.Fatalf("bad: %#v", events)
+		}
+	}
+}
+
+func TestCLIRun_beforeRunError(t *testing.T) {
+	buf := new(bytes.Buffer)
+	afterCalled := false
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		BeforeRun: func(string, []string) error {
+			return errors.New("telemetry down")
+		},
+		AfterRun: func(string, []string, int) {
+			afterCalled = true
+		},
+		ErrorWriter: buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if command.RunCalled || afterCalled {
+		t.Fatal("command and AfterRun should not be called")
+	}
+	if buf.String() != "Error: telemetry down\n" {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIRun_exitCodeMapper(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"nope"}, 64},
+		{[]string{"foo"}, 42},
+	}
+
+	for _, tc := range testCases {
+		cli := &CLI{
+			Args: tc.args,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return &MockCommand{RunResult: 42}, nil
+				},
+			},
+			ExitCodeMapper: func(code int) int {
+				if code == 127 {
+					return 64
+				}
+				return code
+			},
+			ErrorWriter: new(bytes.Buffer),
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if exitCode != tc.expected {
+			t.Fatalf("%v: bad: %d", tc.args, exitCode)
+		}
+	}
+}
+
+func TestCLIRun_shutdownGrace(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var events []string
+	buf := new(bytes.Buffer)
+	clock := make(chan time.Time)
+	var waited time.Duration
+	cli := &CLI{
+		Args: []string{"-C", dir, "foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &funcCommand{
+					run: func([]string) int {
+						// Ignores the cancellation
+						close(started)
+						<-release
+
+						// The cleanups must not have run yet
+						now, _ := os.Getwd()
+						events = append(events, "command stopped in "+now)
+						return 0
+					},
+				}, nil
+			},
+		},
+		AfterRun: func(command string, args []string, exitCode int) {
+			events = append(events, fmt.Sprintf("after run %d", exitCode))
+		},
+		ExitFunc: func(code int) {
+			events = append(events, fmt.Sprintf("exit %d", code))
+			close(release)
+		},
+		ChdirFlag:     true,
+		ShutdownGrace: 10 * time.Second,
+		ErrorWriter:   buf,
+	}
+	cli.after = func(d time.Duration) <-chan time.Time {
+		waited = d
+		return clock
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+		clock <- time.Time{}
+	}()
+
+	exitCode, err := cli.RunContext(ctx)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 130 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	expected := []string{
+		"exit 130",
+		"command stopped in " + dir,
+		"after run 130",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("bad: %#v", events)
+	}
+	if now, _ := os.Getwd(); now != wd {
+		t.Fatalf("Working directory not restored: %s", now)
+	}
+
+	if waited != 10*time.Second {
+		t.Fatalf("bad: %s", waited)
+	}
+	if buf.String() != "Command \"foo\" didn't stop within 10s, exiting.\n" {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIRun_shutdownGraceStopped(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &funcCommand{
+					run: func([]string) int {
+						close(started)
+						<-release
+						return 42
+					},
+				}, nil
+			},
+		},
+		ShutdownGrace: 10 * time.Second,
+		ErrorWriter:   new(bytes.Buffer),
+	}
+	cli.after = func(time.Duration) <-chan time.Time {
+		// The grace period never runs out
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+		close(release)
+	}()
+
+	exitCode, err := cli.RunContext(ctx)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 42 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+}
+
+func TestCLIRun_shutdownGracePanic(t *testing.T) {
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &funcCommand{
+					run: func([]string) int {
+						panic("boom")
+					},
+				}, nil
+			},
+		},
+		ShutdownGrace: 10 * time.Second,
+	}
+
+	defer func() {
+		r, ok := recover().(*PanicError)
+		if !ok || r.Value != "boom" {
+			t.Fatalf("bad: %#v", r)
+		}
+		if !strings.Contains(string(r.Stack), "TestCLIRun_shutdownGracePanic") {
+			t.Fatalf("stack should include the panicking function:\n%s", r.Stack)
+		}
+	}()
+
+	cli.Run()
+	t.Fatal("should panic")
+}
+
+func TestCLIRun_shutdownGraceGoexit(t *testing.T) {
+	afterCalled := false
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &funcCommand{
+					run: func([]string) int {
+						runtime.Goexit()
+						return 0
+					},
+				}, nil
+			},
+		},
+		AfterRun: func(string, []string, int) {
+			afterCalled = true
+		},
+		ShutdownGrace: 10 * time.Second,
+	}
+
+	// Like without ShutdownGrace, Goexit ends the goroutine running the CLI
+	done := make(chan bool)
+	go func() {
+		defer func() {
+			done <- recover() == nil
+		}()
+
+		cli.Run()
+		t.Error("should exit the goroutine")
+	}()
+
+	if !<-done {
+		t.Fatal("should not panic")
+	}
+	if afterCalled {
+		t.Fatal("AfterRun should not be called")
+	}
+}
+
+func TestCLIRun_panicHandler(t *testing.T) {
+	var recovered interface{}
+	var stack string
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &funcCommand{
+					run: func([]string) int {
+						panic("boom")
+					},
+				}, nil
+			},
+		},
+		PanicHandler: func(r interface{}) {
+			recovered = r
+			stack = string(debug.Stack())
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 2 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if recovered != "boom" {
+		t.Fatalf("bad: %#v", recovered)
+	}
+	if !strings.Contains(stack, "TestCLIRun_panicHandler") {
+		t.Fatalf("stack should include the panicking function:\n%s", stack)
+	}
+}
+
+func TestCLIRun_panicNoHandler(t *testing.T) {
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &funcCommand{
+					run: func([]string) int {
+						panic("boom")
+					},
+				}, nil
+			},
+		},
+	}
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("bad: %#v", r)
+		}
+	}()
+
+	cli.Run()
+	t.Fatal("should panic")
+}
+
+func TestCLIRun_destructive(t *testing.T) {
+	testCases := []struct {
+		name   string
+		args   []string
+		input  string
+		run    bool
+		prompt string
+	}{
+		{"Confirm", []string{"foo"}, "y\n", true, "Really? [y/N]"},
+		{"ConfirmYes", []string{"foo"}, "YES\n", true, "Really? [y/N]"},
+		{"Decline", []string{"foo"}, "n\n", false, "Really? [y/N]"},
+		{"DeclineEmpty", []string{"foo"}, "\n", false, "Really? [y/N]"},
+		{"Force", []string{"--force", "foo"}, "", true, ""},
+		{"Yes", []string{"-yes", "foo"}, "", true, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ui := NewMockUi()
+			ui.InputReader = strings.NewReader(tc.input)
+
+			command := &MockCommandDestructive{
+				MockCommand:            MockCommand{RunResult: 42},
+				DestructiveConfirmText: "Really?",
+			}
+			cli := &CLI{
+				Args: tc.args,
+				Ui:   ui,
+				Commands: map[string]CommandFactory{
+					"foo": func() (Command, error) {
+						return command, nil
+					},
+				},
+				YesFlag: true,
+			}
+
+			exitCode, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if command.RunCalled != tc.run {
+				t.Fatalf("bad run called: %v", command.RunCalled)
+			}
+
+			expected := 0
+			if tc.run {
+				expected = 42
+			}
+			if exitCode != expected {
+				t.Fatalf("bad: %d", exitCode)
+			}
+
+			if ui.OutputWriter.String() != tc.prompt {
+				t.Fatalf("bad prompt: %#v", ui.OutputWriter.String())
+			}
+		})
+	}
+}
+
+// funcCommand is a Command that runs the given function.
+type funcCommand struct {
+	MockCommand
+
+	run func(args []string) int
+}
+
+func (c *funcCommand) Run(args []string) int {
+	c.MockCommand.Run(args)
+	return c.run(args)
+}
+
+func TestCLIRun_chdir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testCases := [][]string{
+		{"-C", dir, "foo", "-bar"},
+		{"--chdir", dir, "foo", "-bar"},
+		{"--chdir=" + dir, "foo", "-bar"},
+	}
+
+	for _, testCase := range testCases {
+		var runDir string
+		command := &funcCommand{
+			run: func([]string) int {
+				runDir, _ = os.Getwd()
+				return 0
+			},
+		}
+		cli := &CLI{
+			Args: testCase,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return command, nil
+				},
+			},
+			ChdirFlag: true,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if code != 0 {
+			t.Fatalf("Args: %#v. Code: %d", testCase, code)
+		}
+
+		if runDir != dir {
+			t.Fatalf("Args: %#v. Bad run dir: %s", testCase, runDir)
+		}
+		if !reflect.DeepEqual(command.RunArgs, []string{"-bar"}) {
+			t.Fatalf("Args: %#v. Bad args: %#v", testCase, command.RunArgs)
+		}
+
+		if now, _ := os.Getwd(); now != wd {
+			t.Fatalf("Args: %#v. Working directory not restored: %s", testCase, now)
+		}
+	}
+}
+
+func TestCLISubcommandArgs_forwardGlobalFlags(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		commands []string
+		forward  bool
+		expected []string
+	}{
+		{
+			[]string{"-C", "/tmp", "-force", "foo", "-bar"},
+			[]string{"foo"},
+			true,
+			[]string{"--chdir=/tmp", "--yes", "-bar"},
+		},
+		{
+			[]string{"--output-file=out.txt", "-chdir", "/tmp", "foo"},
+			[]string{"foo"},
+			true,
+			[]string{"--chdir=/tmp", "--output-file=out.txt"},
+		},
+		{
+			[]string{"-yes", "-bar"},
+			[]string{""},
+			true,
+			[]string{"--yes", "-bar"},
+		},
+		{
+			[]string{"foo", "-bar"},
+			[]string{"foo"},
+			true,
+			[]string{"-bar"},
+		},
+		{
+			[]string{"-C", "/tmp", "-yes", "foo", "-bar"},
+			[]string{"foo"},
+			false,
+			[]string{"-bar"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		cli := &CLI{
+			Args:               testCase.args,
+			Commands:           make(map[string]CommandFactory),
+			ForwardGlobalFlags: testCase.forward,
+			YesFlag:            true,
+			ChdirFlag:          true,
+			OutputFileFlag:     true,
+		}
+		for _, name := range testCase.commands {
+			cli.Commands[name] = func() (Command, error) {
+				return new(MockCommand), nil
+			}
+		}
+
+		result := cli.SubcommandArgs()
+		if !reflect.DeepEqual(result, testCase.expected) {
+			t.Errorf("Args: %#v. Result: %#v", testCase.args, result)
+		}
+	}
+}
+
+func TestCLIRun_chdirError(t *testing.T) {
+	buf := new(bytes.Buffer)
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"-C", filepath.Join(t.TempDir(), "missing"), "foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		ErrorWriter: buf,
+		ChdirFlag:   true,
+	}
+
+	code, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if code != 2 {
+		t.Fatalf("bad code: %d", code)
+	}
+	if command.RunCalled {
+		t.Fatal("run should not be called")
+	}
+	if !strings.HasPrefix(buf.String(), "Error changing the working directory: ") {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+// deprecatedStdoutCommand is a redirectable command that also writes a
+// deprecation warning to the console.
+type deprecatedStdoutCommand struct {
+	MockCommandStdout
+}
+
+func (c *deprecatedStdoutCommand) DeprecatedSince() (string, string) {
+	return "1.0", ""
+}
+
+func TestCLIRun_outputFile(t *testing.T) {
+	dir := t.TempDir()
+	testCases := [][]string{
+		{"--output-file", filepath.Join(dir, "a.txt"), "foo", "-bar"},
+		{"--output-file=" + filepath.Join(dir, "b.txt"), "foo", "-bar"},
+		{"-output-file", filepath.Join(dir, "c.txt"), "foo", "-bar"},
+	}
+
+	for i, testCase := range testCases {
+		buf := new(bytes.Buffer)
+		command := &deprecatedStdoutCommand{}
+		command.OutputText = "hello\n"
+		cli := &CLI{
+			Args: testCase,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return command, nil
+				},
+			},
+			ErrorWriter:    buf,
+			OutputFileFlag: true,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if code != 0 {
+			t.Fatalf("Args: %#v. Code: %d", testCase, code)
+		}
+		if !reflect.DeepEqual(command.RunArgs, []string{"-bar"}) {
+			t.Fatalf("Args: %#v. Bad args: %#v", testCase, command.RunArgs)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, string(rune('a'+i))+".txt"))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if string(data) != "hello\n" {
+			t.Fatalf("Args: %#v. Bad file: %#v", testCase, string(data))
+		}
+
+		expected := "Warning: command \"foo\" is deprecated since 1.0.\n"
+		if buf.String() != expected {
+			t.Fatalf("Args: %#v. Bad stderr: %#v", testCase, buf.String())
+		}
+	}
+}
+
+func TestCLIRun_outputFileError(t *testing.T) {
+	testCases := []struct {
+		command Command
+		output  string
+	}{
+		{
+			new(MockCommandStdout),
+			"Error opening the output file: ",
+		},
+		{
+			new(MockCommand),
+			"Command \"foo\" doesn't support --output-file\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		buf := new(bytes.Buffer)
+		cli := &CLI{
+			Args: []string{
+				"--output-file", filepath.Join(t.TempDir(), "missing", "out.txt"),
+				"foo",
+			},
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return tc.command, nil
+				},
+			},
+			ErrorWriter:    buf,
+			OutputFileFlag: true,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if code != 2 {
+			t.Fatalf("bad code: %d", code)
+		}
+		if !strings.HasPrefix(buf.String(), tc.output) {
+			t.Fatalf("bad: %#v", buf.String())
+		}
+	}
+}
+
+func TestCLIRun_deprecatedSince(t *testing.T) {
+	testCases := []struct {
+		version  string
+		since    string
+		removeIn string
+		code     int
+		output   string
+	}{
+		{
+			"1.5.0", "1.2", "2.0", 42,
+			"Warning: command \"foo\" is deprecated since 1.2; will be removed in 2.0.\n",
+		},
+		{
+			"1.5.0", "1.2", "", 42,
+			"Warning: command \"foo\" is deprecated since 1.2.\n",
+		},
+		{
+			"", "1.2", "2.0", 42,
+			"Warning: command \"foo\" is deprecated since 1.2; will be removed in 2.0.\n",
+		},
+		{
+			"2.0.0", "1.2", "2.0", 3,
+			"Command \"foo\" was removed in 2.0.\n",
+		},
+		{
+			"v2.1", "1.2", "2.0", 3,
+			"Command \"foo\" was removed in 2.0.\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		buf := new(bytes.Buffer)
+		command := &MockCommandDeprecatedSince{
+			MockCommand: MockCommand{RunResult: 42},
+			Since:       testCase.since,
+			RemoveIn:    testCase.removeIn,
+		}
+		cli := &CLI{
+			Args:    []string{"foo"},
+			Version: testCase.version,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return command, nil
+				},
+			},
+			ErrorWriter: buf,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if code != testCase.code {
+			t.Errorf("Version: %s. Code: %d", testCase.version, code)
+		}
+		if command.RunCalled != (testCase.code == 42) {
+			t.Errorf("Version: %s. Run called: %v", testCase.version, command.RunCalled)
+		}
+		if buf.String() != testCase.output {
+			t.Errorf("Version: %s. Output: %#v", testCase.version, buf.String())
+		}
+	}
+}
+
+func TestCLIRun_deprecated(t *testing.T) {
+	testCases := []struct {
+		message string
+		output  string
+	}{
+		{"'foo' is deprecated, use 'bar' instead.", "'foo' is deprecated, use 'bar' instead.\n"},
+		{"renamed to 'bar'\n", "renamed to 'bar'\n"},
+		{"", ""},
+	}
+
+	for _, testCase := range testCases {
+		buf := new(bytes.Buffer)
+		command := &MockCommandDeprecated{
+			MockCommand:            MockCommand{RunResult: 42},
+			DeprecationMessageText: testCase.message,
+		}
+		cli := &CLI{
+			Args: []string{"foo", "-x"},
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return command, nil
+				},
+			},
+			ErrorWriter: buf,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if code != 42 || !command.RunCalled {
+			t.Errorf("Message: %q. Code: %d", testCase.message, code)
+		}
+		if !reflect.DeepEqual(command.RunArgs, []string{"-x"}) {
+			t.Errorf("Message: %q. Args: %#v", testCase.message, command.RunArgs)
+		}
+		if buf.String() != testCase.output {
+			t.Errorf("Message: %q. Output: %#v", testCase.message, buf.String())
+		}
+	}
+}
+
+func TestCLIRun_deprecatedHelp(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"--help"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommandDeprecated{
+					MockCommand: MockCommand{SynopsisText: "Foo things"},
+				}, nil
+			},
+			"bar": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Bar things"}, nil
+			},
+		},
+		HelpWriter: buf,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.Contains(buf.String(), "    foo    Foo things (deprecated)\n") {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "Bar things (deprecated)") {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+}
+
+func TestCLIRun_requiresEnv(t *testing.T) {
+	t.Setenv("CLI_TEST_TOKEN", "secret")
+	t.Setenv("CLI_TEST_EMPTY", "")
+	os.Unsetenv("CLI_TEST_REGION")
+	os.Unsetenv("CLI_TEST_ZONE")
+
+	testCases := []struct {
+		env    []string
+		code   int
+		output string
+	}{
+		{[]string{"CLI_TEST_TOKEN", "CLI_TEST_EMPTY"}, 42, ""},
+		{
+			[]string{"CLI_TEST_TOKEN", "CLI_TEST_REGION"}, 2,
+			"Error: missing required environment variable CLI_TEST_REGION\n",
+		},
+		{
+			[]string{"CLI_TEST_REGION", "CLI_TEST_ZONE"}, 2,
+			"Error: missing required environment variable CLI_TEST_REGION\n" +
+				"Error: missing required environment variable CLI_TEST_ZONE\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		buf := new(bytes.Buffer)
+		command := &MockCommandRequiresEnv{
+			MockCommand: MockCommand{RunResult: 42},
+			Env:         testCase.env,
+		}
+		cli := &CLI{
+			Args: []string{"foo"},
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return command, nil
+				},
+			},
+			ErrorWriter: buf,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if code != testCase.code {
+			t.Errorf("Env: %v. Code: %d", testCase.env, code)
+		}
+		if command.RunCalled != (testCase.code == 42) {
+			t.Errorf("Env: %v. Run called: %v", testCase.env, command.RunCalled)
+		}
+		if buf.String() != testCase.output {
+			t.Errorf("Env: %v. Output: %#v", testCase.env, buf.String())
+		}
+	}
+}
+
+func TestCLIRun_helpNested(t *testing.T) {
+	helpCalled := false
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"--help"},
+		Commands: map[string]CommandFactory{
+			"foo sub42": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		HelpFunc: func(m map[string]CommandFactory) string {
+			helpCalled = true
+
+			var keys []string
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			expected := []string{"foo"}
+			if !reflect.DeepEqual(keys, expected) {
+				return fmt.Sprintf("error: contained sub: %#v", keys)
+			}
+
+			return ""
+		},
+		ErrorWriter: buf,
+	}
+
+	code, err := cli.Run()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if code != 0 {
+		t.Fatalf("Code: %d", code)
+	}
+
+	if !helpCalled {
+		t.Fatal("help not called")
+	}
+}
+
+func TestCLIRun_nested(t *testing.T) {
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"foo", "bar", "-bar", "-baz"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"foo bar": func() (Command, error) {
+				return command, nil
+			},
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != command.RunResult {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if !command.RunCalled {
+		t.Fatalf("run should be called")
+	}
+
+	if !reflect.DeepEqual(command.RunArgs, []string{"-bar", "-baz"}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRun_nestedTopLevel(t *testing.T) {
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+			"foo bar": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != command.RunResult {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if !command.RunCalled {
+		t.Fatalf("run should be called")
+	}
+
+	if !reflect.DeepEqual(command.RunArgs, []string{}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRun_nestedMissingParent(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo bar": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+		},
+		ErrorWriter: buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 1 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
+
+	if buf.String() != testCommandNestedMissingParent {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIRun_nestedNoArgs(t *testing.T) {
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"foo", "bar"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"foo bar": func() (Command, error) {
+				return command, nil
+			},
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != command.RunResult {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if !command.RunCalled {
+		t.Fatalf("run should be called")
+	}
+
+	if !reflect.DeepEqual(command.RunArgs, []string{}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRun_nestedBlankArg(t *testing.T) {
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"foo", "", "bar", "-baz"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+			"foo bar": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != command.RunResult {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if !command.RunCalled {
+		t.Fatalf("run should be called")
+	}
+
+	if !reflect.DeepEqual(command.RunArgs, []string{"", "bar", "-baz"}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRun_nestedQuotedCommand(t *testing.T) {
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"foo bar"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"foo bar": func() (Command, error) {
+				return command, nil
+			},
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 127 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+}
+
+func TestCLIRun_nestedQuotedArg(t *testing.T) {
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"foo", "bar baz"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+			"foo bar": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != command.RunResult {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if !command.RunCalled {
+		t.Fatalf("run should be called")
+	}
+
+	if !reflect.DeepEqual(command.RunArgs, []string{"bar baz"}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRun_printHelp(t *testing.T) {
+	testCases := [][]string{
+		{"-h"},
+		{"--help"},
+	}
+
+	for _, testCase := range testCases {
+		buf := new(bytes.Buffer)
+		helpText := "foo"
+
+		cli := &CLI{
+			Args: testCase,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+			},
+			HelpFunc: func(map[string]CommandFactory) string {
+				return helpText
+			},
+			HelpWriter: buf,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Errorf("Args: %#v. Error: %s", testCase, err)
+			continue
+		}
+
+		if code != 0 {
+			t.Errorf("Args: %#v. Code: %d", testCase, code)
+			continue
+		}
+
+		if !strings.Contains(buf.String(), helpText) {
+			t.Errorf("Args: %#v. Text: %v", testCase, buf.String())
+		}
+	}
+}
+
+func TestCLIRun_versionCommand(t *testing.T) {
+	testCases := [][]string{
+		{"-v"},
+		{"--version"},
+		{"-version"},
+	}
+
+	for _, args := range testCases {
+		command := &MockCommand{RunResult: 7}
+		buf := new(bytes.Buffer)
+		cli := &CLI{
+			Args:    args,
+			Version: "1.2.3",
+			Commands: map[string]CommandFactory{
+				"version": func() (Command, error) {
+					return command, nil
+				},
+			},
+			VersionCommand: "version",
+			HelpWriter:     buf,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if code != 7 {
+			t.Fatalf("Args: %#v. Code: %d", args, code)
+		}
+		if !command.RunCalled {
+			t.Fatalf("Args: %#v. Run should be called", args)
+		}
+		if buf.String() != "" {
+			t.Fatalf("Args: %#v. Bad: %#v", args, buf.String())
+		}
+	}
+}
+
+func TestCLIRun_versionCommandResult(t *testing.T) {
+	testCases := []struct {
+		name     string
+		run      func([]string) int
+		expected int
+		help     string
+		panicked bool
+	}{
+		{"help", func([]string) int { return RunResultHelp }, 1, "Prints the version\n", false},
+		{"usage", func([]string) int { return RunResultUsage }, 2, "Prints the version\n", false},
+		{"panic", func([]string) int { panic("boom") }, 2, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			var panicked bool
+			var afterRun []string
+			cli := &CLI{
+				Args: []string{"-v"},
+				Commands: map[string]CommandFactory{
+					"version": func() (Command, error) {
+						return &funcCommand{
+							MockCommand: MockCommand{HelpText: "Prints the version"},
+							run:         tc.run,
+						}, nil
+					},
+				},
+				VersionCommand:    "version",
+				CommandHelpWriter: buf,
+				PanicHandler:      func(interface{}) { panicked = true },
+				AfterRun: func(command string, args []string, exitCode int) {
+					afterRun = append(afterRun, fmt.Sprintf("%s %d", command, exitCode))
+				},
+			}
+
+			code, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if code != tc.expected {
+				t.Fatalf("bad code: %d", code)
+			}
+			if buf.String() != tc.help {
+				t.Fatalf("bad: %#v", buf.String())
+			}
+			if panicked != tc.panicked {
+				t.Fatalf("bad panicked: %v", panicked)
+			}
+			if !reflect.DeepEqual(afterRun, []string{fmt.Sprintf("version %d", tc.expected)}) {
+				t.Fatalf("bad: %#v", afterRun)
+			}
+		})
 	}
 }
 
-func TestCLIRun_nestedQuotedCommand(t *testing.T) {
+func TestCLIRun_helpCommand(t *testing.T) {
 	command := new(MockCommand)
+	buf := new(bytes.Buffer)
 	cli := &CLI{
-		Args: []string{"foo bar"},
+		Args: []string{"--help"},
 		Commands: map[string]CommandFactory{
-			"foo": func() (Command, error) {
-				return new(MockCommand), nil
-			},
-			"foo bar": func() (Command, error) {
+			"help": func() (Command, error) {
 				return command, nil
 			},
 		},
+		HelpCommand: "help",
+		HelpWriter:  buf,
 	}
 
-	exitCode, err := cli.Run()
+	code, err := cli.Run()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
-
-	if exitCode != 127 {
-		t.Fatalf("bad: %d", exitCode)
+	if code != 0 {
+		t.Fatalf("bad code: %d", code)
+	}
+	if !command.RunCalled {
+		t.Fatal("run should be called")
+	}
+	if buf.String() != "" {
+		t.Fatalf("bad: %#v", buf.String())
 	}
 }
 
-func TestCLIRun_nestedQuotedArg(t *testing.T) {
-	command := new(MockCommand)
+func TestCLIRun_versionCommandMissing(t *testing.T) {
 	cli := &CLI{
-		Args: []string{"foo", "bar baz"},
+		Args: []string{"-v"},
 		Commands: map[string]CommandFactory{
 			"foo": func() (Command, error) {
-				return command, nil
-			},
-			"foo bar": func() (Command, error) {
 				return new(MockCommand), nil
 			},
 		},
+		VersionCommand: "version",
 	}
 
-	exitCode, err := cli.Run()
+	if _, err := cli.Run(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestCLIRun_printHelpEpilogue(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"--help"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{SynopsisText: "foo!"}, nil
+			},
+		},
+		HelpFunc:     BasicHelpFunc("app"),
+		HelpEpilogue: "Run 'app <command> --help' for more information on a command.",
+		HelpWriter:   buf,
+	}
+
+	code, err := cli.Run()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
+	if code != 0 {
+		t.Fatalf("bad code: %d", code)
+	}
 
-	if exitCode != command.RunResult {
-		t.Fatalf("bad: %d", exitCode)
+	expected := "Usage: app [--version] [--help] <command> [<args>]\n\n" +
+		"Available commands are:\n" +
+		"    foo    foo!\n\n" +
+		"Run 'app <command> --help' for more information on a command.\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v", buf.String())
 	}
+}
 
-	if !command.RunCalled {
-		t.Fatalf("run should be called")
+func TestCLIRun_printHelpEpilogueNoCommands(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"--help"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		HiddenCommands: []string{"foo"},
+		HelpFunc: func(map[string]CommandFactory) string {
+			return "help"
+		},
+		HelpEpilogue: "epilogue",
+		HelpWriter:   buf,
 	}
 
-	if !reflect.DeepEqual(command.RunArgs, []string{"bar baz"}) {
-		t.Fatalf("bad args: %#v", command.RunArgs)
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if buf.String() != "help\n" {
+		t.Fatalf("bad: %#v", buf.String())
 	}
 }
 
-func TestCLIRun_printHelp(t *testing.T) {
-	testCases := [][]string{
-		{"-h"},
-		{"--help"},
+func TestCLIRun_printHelpVersion(t *testing.T) {
+	testCases := []struct {
+		version  string
+		expected string
+	}{
+		{"1.2.3", "app v1.2.3\n\nhelp\n"},
+		{"v1.2.3", "app v1.2.3\n\nhelp\n"},
+		{"", "help\n"},
 	}
 
 	for _, testCase := range testCases {
 		buf := new(bytes.Buffer)
-		helpText := "foo"
-
 		cli := &CLI{
-			Args: testCase,
+			Args:    []string{"--help"},
+			Name:    "app",
+			Version: testCase.version,
 			Commands: map[string]CommandFactory{
 				"foo": func() (Command, error) {
 					return new(MockCommand), nil
 				},
 			},
 			HelpFunc: func(map[string]CommandFactory) string {
-				return helpText
+				return "help"
 			},
-			HelpWriter: buf,
-		}
-
-		code, err := cli.Run()
-		if err != nil {
-			t.Errorf("Args: %#v. Error: %s", testCase, err)
-			continue
+			HelpShowVersion: true,
+			HelpWriter:      buf,
 		}
 
-		if code != 0 {
-			t.Errorf("Args: %#v. Code: %d", testCase, code)
-			continue
+		if _, err := cli.Run(); err != nil {
+			t.Fatalf("err: %s", err)
 		}
 
-		if !strings.Contains(buf.String(), helpText) {
-			t.Errorf("Args: %#v. Text: %v", testCase, buf.String())
+		if buf.String() != testCase.expected {
+			t.Errorf("Expected %#v, got %#v", testCase.expected, buf.String())
 		}
 	}
 }
@@ -577,71 +2756,326 @@ func TestCLIRun_printHelpIllegal(t *testing.T) {
 				}
 				sort.Strings(keys)
 
-				expected := []string{"foo"}
-				if !reflect.DeepEqual(keys, expected) {
-					return fmt.Sprintf("error: contained sub: %#v", keys)
-				}
+				expected := []string{"foo"}
+				if !reflect.DeepEqual(keys, expected) {
+					return fmt.Sprintf("error: contained sub: %#v", keys)
+				}
+
+				return helpText
+			},
+			ErrorWriter: buf,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Errorf("Args: %#v. Error: %s", testCase, err)
+			continue
+		}
+
+		if code != testCase.exit {
+			t.Errorf("Args: %#v. Code: %d", testCase, code)
+			continue
+		}
+
+		if strings.Contains(buf.String(), "error") {
+			t.Errorf("Args: %#v. Text: %v", testCase, buf.String())
+		}
+
+		if !strings.Contains(buf.String(), helpText) {
+			t.Errorf("Args: %#v. Text: %v", testCase, buf.String())
+		}
+	}
+}
+
+func TestCLIRun_strictGlobalFlags(t *testing.T) {
+	testCases := []struct {
+		strict     bool
+		code       int
+		factoryRun bool
+		output     string
+	}{
+		{false, 1, true, "Invalid flags before the subcommand."},
+		{true, 2, false, "Unknown global flags: -x, -y\n"},
+	}
+
+	for _, testCase := range testCases {
+		buf := new(bytes.Buffer)
+		factoryRun := false
+		cli := &CLI{
+			Args: []string{"-x", "-y", "foo"},
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					factoryRun = true
+					return new(MockCommand), nil
+				},
+			},
+			StrictGlobalFlags: testCase.strict,
+			ErrorWriter:       buf,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if code != testCase.code {
+			t.Errorf("Strict: %v. Code: %d", testCase.strict, code)
+		}
+		if factoryRun != testCase.factoryRun {
+			t.Errorf("Strict: %v. Factory run: %v", testCase.strict, factoryRun)
+		}
+		if !strings.HasPrefix(buf.String(), testCase.output) {
+			t.Errorf("Strict: %v. Output: %#v", testCase.strict, buf.String())
+		}
+	}
+}
+
+func TestCLIRun_suggestSubcommandHelp(t *testing.T) {
+	testCases := []struct {
+		suggest bool
+		args    []string
+		code    int
+		runArgs []string
+	}{
+		{true, []string{"foo", "baz"}, 1, nil},
+		{false, []string{"foo", "baz"}, 0, []string{"baz"}},
+		{true, []string{"foo", "-baz"}, 0, []string{"-baz"}},
+		{true, []string{"foo"}, 0, []string{}},
+	}
+
+	for _, testCase := range testCases {
+		buf := new(bytes.Buffer)
+		command := &MockCommand{HelpText: "donuts"}
+		cli := &CLI{
+			Args: testCase.args,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return command, nil
+				},
+				"foo bar": func() (Command, error) {
+					return &MockCommand{SynopsisText: "hi!"}, nil
+				},
+			},
+			SuggestSubcommandHelp: testCase.suggest,
+			ErrorWriter:           buf,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if code != testCase.code {
+			t.Errorf("Args: %#v. Code: %d", testCase.args, code)
+		}
+		if command.RunCalled != (testCase.runArgs != nil) {
+			t.Errorf("Args: %#v. Run called: %v", testCase.args, command.RunCalled)
+		}
+		if testCase.runArgs != nil && !reflect.DeepEqual(command.RunArgs, testCase.runArgs) {
+			t.Errorf("Args: %#v. Run args: %#v", testCase.args, command.RunArgs)
+		}
+
+		if testCase.runArgs == nil {
+			expected := "Unknown subcommand \"baz\" for \"foo\".\n\n" +
+				"donuts\n\nSubcommands:\n    bar    hi!\n"
+			if buf.String() != expected {
+				t.Errorf("Args: %#v. Output: %#v", testCase.args, buf.String())
+			}
+		}
+	}
+}
+
+func TestCLIRun_printCommandHelp(t *testing.T) {
+	testCases := [][]string{
+		{"--help", "foo"},
+		{"-h", "foo"},
+	}
+
+	for _, args := range testCases {
+		command := &MockCommand{
+			HelpText: "donuts",
+		}
+
+		buf := new(bytes.Buffer)
+		cli := &CLI{
+			Args: args,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return command, nil
+				},
+			},
+			HelpWriter: buf,
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if exitCode != 0 {
+			t.Fatalf("bad exit code: %d", exitCode)
+		}
+
+		if buf.String() != (command.HelpText + "\n") {
+			t.Fatalf("bad: %#v", buf.String())
+		}
+	}
+}
+
+func TestCLIRun_runResultHelp(t *testing.T) {
+	command := &MockCommand{
+		HelpText:  "donuts",
+		RunResult: RunResultHelp,
+	}
+
+	helpBuf := new(bytes.Buffer)
+	errBuf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		HelpWriter:  helpBuf,
+		ErrorWriter: errBuf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 1 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
+
+	if errBuf.String() != (command.HelpText + "\n") {
+		t.Fatalf("bad: %#v", errBuf.String())
+	}
+	if helpBuf.String() != "" {
+		t.Fatalf("bad: %#v", helpBuf.String())
+	}
+}
+
+func TestCLIRun_runResultUsage(t *testing.T) {
+	command := &MockCommand{
+		HelpText:  "donuts",
+		RunResult: RunResultUsage,
+	}
+
+	helpBuf := new(bytes.Buffer)
+	errBuf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		HelpWriter:  helpBuf,
+		ErrorWriter: errBuf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 2 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
+
+	if errBuf.String() != (command.HelpText + "\n") {
+		t.Fatalf("bad: %#v", errBuf.String())
+	}
+	if helpBuf.String() != "" {
+		t.Fatalf("bad: %#v", helpBuf.String())
+	}
+}
+
+func TestCLIRun_runResultHelpCommandHelpWriter(t *testing.T) {
+	command := &MockCommand{
+		HelpText:  "donuts",
+		RunResult: RunResultHelp,
+	}
 
-				return helpText
+	helpBuf := new(bytes.Buffer)
+	errBuf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
 			},
-			ErrorWriter: buf,
-		}
-
-		code, err := cli.Run()
-		if err != nil {
-			t.Errorf("Args: %#v. Error: %s", testCase, err)
-			continue
-		}
+		},
+		HelpWriter:        helpBuf,
+		ErrorWriter:       errBuf,
+		CommandHelpWriter: helpBuf,
+	}
 
-		if code != testCase.exit {
-			t.Errorf("Args: %#v. Code: %d", testCase, code)
-			continue
-		}
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-		if strings.Contains(buf.String(), "error") {
-			t.Errorf("Args: %#v. Text: %v", testCase, buf.String())
-		}
+	if exitCode != 1 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
 
-		if !strings.Contains(buf.String(), helpText) {
-			t.Errorf("Args: %#v. Text: %v", testCase, buf.String())
-		}
+	if helpBuf.String() != (command.HelpText + "\n") {
+		t.Fatalf("bad: %#v", helpBuf.String())
+	}
+	if errBuf.String() != "" {
+		t.Fatalf("bad: %#v", errBuf.String())
 	}
 }
 
-func TestCLIRun_printCommandHelp(t *testing.T) {
-	testCases := [][]string{
-		{"--help", "foo"},
-		{"-h", "foo"},
+func TestCLISubcommandsHelp(t *testing.T) {
+	factory := func(synopsis string) CommandFactory {
+		return func() (Command, error) {
+			return &MockCommand{
+				HelpText:     "donuts",
+				SynopsisText: synopsis,
+			}, nil
+		}
 	}
 
-	for _, args := range testCases {
-		command := &MockCommand{
-			HelpText: "donuts",
-		}
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"foo", "--help"},
+		Commands: map[string]CommandFactory{
+			"foo":          factory("Foo"),
+			"foo zip":      factory("Zip"),
+			"foo banana":   factory("Banana"),
+			"foo zip zap":  factory("Zap"),
+			"foo secret":   factory("Secret"),
+			"other":        factory("Other"),
+			"other things": factory("Things"),
+		},
+		HiddenCommands: []string{"foo secret"},
+		HelpWriter:     buf,
+	}
 
-		buf := new(bytes.Buffer)
-		cli := &CLI{
-			Args: args,
-			Commands: map[string]CommandFactory{
-				"foo": func() (Command, error) {
-					return command, nil
-				},
-			},
-			HelpWriter: buf,
-		}
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-		exitCode, err := cli.Run()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
+	expected := "    banana    Banana\n    zip       Zip\n"
+	actual := cli.SubcommandsHelp("foo")
+	if actual != expected {
+		t.Fatalf("bad: %#v", actual)
+	}
 
-		if exitCode != 0 {
-			t.Fatalf("bad exit code: %d", exitCode)
-		}
+	if !strings.HasSuffix(buf.String(), "Subcommands:\n"+expected) {
+		t.Fatalf("bad: %#v", buf.String())
+	}
 
-		if buf.String() != (command.HelpText + "\n") {
-			t.Fatalf("bad: %#v", buf.String())
-		}
+	if actual := cli.SubcommandsHelp("foo zip"); actual != "    zap    Zap\n" {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if actual := cli.SubcommandsHelp("foo banana"); actual != "" {
+		t.Fatalf("bad: %#v", actual)
 	}
 }
 
@@ -823,7 +3257,7 @@ func TestCLIRun_printHelpRootSubcommands(t *testing.T) {
 			t.Fatalf("bad exit code: %d", exitCode)
 		}
 
-		expected := `Usage: app [--version] [--help] <command> [<args>]
+		expected := `Usage: app [--version] [--help] <command> [<subcommand>] [<args>]
 
 Available commands are:
     bar    hi!
@@ -836,6 +3270,77 @@ Available commands are:
 	}
 }
 
+func TestCLIRun_printHelpCollapseSingleChildren(t *testing.T) {
+	factory := func(synopsis string) CommandFactory {
+		return func() (Command, error) {
+			return &MockCommand{SynopsisText: synopsis}, nil
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		commands map[string]CommandFactory
+		expected string
+	}{
+		{
+			"chain",
+			map[string]CommandFactory{
+				"a b c": factory("C"),
+				"zip":   factory("Zip"),
+			},
+			"    a b c    C\n    zip      Zip\n",
+		},
+		{
+			"branch",
+			map[string]CommandFactory{
+				"a b c": factory("C"),
+				"a b d": factory("D"),
+				"zip":   factory("Zip"),
+			},
+			"    a b    \n    zip    Zip\n",
+		},
+		{
+			"registered parent",
+			map[string]CommandFactory{
+				"a":     factory("A"),
+				"a b c": factory("C"),
+			},
+			"    a    A\n",
+		},
+		{
+			"hidden sibling",
+			map[string]CommandFactory{
+				"a b":      factory("B"),
+				"a hidden": factory("Hidden"),
+			},
+			"    a b    B\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			cli := &CLI{
+				Args:                   []string{"--help"},
+				Commands:               tc.commands,
+				HiddenCommands:         []string{"a hidden"},
+				CollapseSingleChildren: true,
+				HelpWriter:             buf,
+			}
+
+			if _, err := cli.Run(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			expected := "Usage: app [--version] [--help] <command> [<subcommand>] [<args>]\n\n" +
+				"Available commands are:\n" + tc.expected + "\n"
+			if buf.String() != expected {
+				t.Fatalf("bad: %#v", buf.String())
+			}
+		})
+	}
+}
+
 func TestCLIRun_printCommandHelpTemplate(t *testing.T) {
 	testCases := [][]string{
 		{"--help", "foo"},
@@ -1017,6 +3522,286 @@ func TestCLISubcommand_nested(t *testing.T) {
 	}
 }
 
+func TestCLIHelpCommands_nestedLevels(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"-h"}, []string{"foo"}},
+		{[]string{"foo", "-h"}, []string{"foo bar", "foo zip"}},
+		{[]string{"foo", "bar", "-h"}, []string{"foo bar baz"}},
+		{[]string{"foo", "bar", "baz", "-h"}, []string{}},
+	}
+
+	for _, testCase := range testCases {
+		cli := &CLI{
+			Args: testCase.args,
+			Commands: map[string]CommandFactory{
+				"foo bar": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+				"foo bar baz": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+				"foo zip": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+			},
+		}
+
+		result := cli.helpCommands(cli.Subcommand())
+		keys := make([]string, 0, len(result))
+		for k := range result {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		if !reflect.DeepEqual(keys, testCase.expected) {
+			t.Errorf("Expected %#v, got %#v. Args: %#v",
+				testCase.expected, keys, testCase.args)
+		}
+	}
+}
+
+func TestCLIRun_printCommandHelpNestedLevels(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"foo", "-h"}, "foo\n\nSubcommands:\n    bar    bar\n    zip    zip\n"},
+		{[]string{"foo", "bar", "-h"}, "bar\n\nSubcommands:\n    baz    baz\n"},
+		{[]string{"foo", "bar", "baz", "-h"}, "baz\n"},
+	}
+
+	for _, testCase := range testCases {
+		buf := new(bytes.Buffer)
+		cli := &CLI{
+			Args:       testCase.args,
+			HelpWriter: buf,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return &MockCommand{HelpText: "foo", SynopsisText: "foo"}, nil
+				},
+				"foo bar": func() (Command, error) {
+					return &MockCommand{HelpText: "bar", SynopsisText: "bar"}, nil
+				},
+				"foo bar baz": func() (Command, error) {
+					return &MockCommand{HelpText: "baz", SynopsisText: "baz"}, nil
+				},
+				"foo zip": func() (Command, error) {
+					return &MockCommand{HelpText: "zip", SynopsisText: "zip"}, nil
+				},
+			},
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if code != 0 {
+			t.Fatalf("bad code: %d", code)
+		}
+
+		if buf.String() != testCase.expected {
+			t.Errorf("Expected %#v, got %#v. Args: %#v",
+				testCase.expected, buf.String(), testCase.args)
+		}
+	}
+}
+
+func TestCLIMatchCommand(t *testing.T) {
+	testCases := []struct {
+		tokens   []string
+		key      string
+		consumed int
+		ok       bool
+	}{
+		{[]string{"foo"}, "foo", 1, true},
+		{[]string{"foo", "bar"}, "foo bar", 2, true},
+		{[]string{"foo", "bar", "baz"}, "foo bar", 2, true},
+		{[]string{"foo", "qux"}, "foo", 1, true},
+		{[]string{"foo", "-bar"}, "foo", 1, true},
+		{[]string{"foo", "bar baz"}, "foo", 1, true},
+		{[]string{"foobar"}, "", 0, false},
+		{[]string{"foobar", "bar"}, "", 0, false},
+		{[]string{"zip"}, "", 0, false},
+		{[]string{"-h", "foo"}, "", 0, false},
+		{[]string{}, "", 0, false},
+	}
+
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"foo bar": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		key, consumed, ok := cli.MatchCommand(testCase.tokens)
+		if key != testCase.key || consumed != testCase.consumed || ok != testCase.ok {
+			t.Errorf("Expected %#v/%d/%v, got %#v/%d/%v. Tokens: %#v",
+				testCase.key, testCase.consumed, testCase.ok,
+				key, consumed, ok, testCase.tokens)
+		}
+	}
+}
+
+func TestCLIMatchCommand_default(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"foo bar": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+	}
+
+	key, consumed, ok := cli.MatchCommand([]string{"zip"})
+	if key != "" || consumed != 0 || !ok {
+		t.Fatalf("bad: %#v/%d/%v", key, consumed, ok)
+	}
+}
+
+func TestCLIHasCommand(t *testing.T) {
+	testCases := []struct {
+		key      string
+		exact    bool
+		orParent bool
+	}{
+		{"foo", false, true},
+		{"foo bar", true, true},
+		{"foo bar baz", false, false},
+		{"zip", true, true},
+		{"hidden", true, true},
+		{"missing", false, false},
+		{"fo", false, false},
+	}
+
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo bar": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"zip": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"hidden": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		HiddenCommands: []string{"hidden"},
+	}
+
+	for _, testCase := range testCases {
+		if v := cli.HasCommand(testCase.key); v != testCase.exact {
+			t.Errorf("HasCommand(%q): expected %v", testCase.key, testCase.exact)
+		}
+		if v := cli.HasCommandOrParent(testCase.key); v != testCase.orParent {
+			t.Errorf("HasCommandOrParent(%q): expected %v", testCase.key, testCase.orParent)
+		}
+	}
+}
+
+func TestCLIMatchCommands(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		expected []string
+		all      []string
+	}{
+		{
+			"remote *",
+			[]string{"remote add", "remote remove"},
+			[]string{"remote add", "remote prune", "remote remove"},
+		},
+		{
+			"foo bar*",
+			[]string{"foo bar", "foo barn"},
+			[]string{"foo bar", "foo barn"},
+		},
+		{
+			"* b*",
+			[]string{"foo bar", "foo barn"},
+			[]string{"foo bar", "foo barn"},
+		},
+		{
+			"remote [ap]*",
+			[]string{"remote add"},
+			[]string{"remote add", "remote prune"},
+		},
+		{"zip *", nil, nil},
+		{"[", nil, nil},
+	}
+
+	factory := func() (Command, error) {
+		return new(MockCommand), nil
+	}
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo bar":       factory,
+			"foo bar baz":   factory,
+			"foo barn":      factory,
+			"remote add":    factory,
+			"remote prune":  factory,
+			"remote remove": factory,
+			"zip":           factory,
+		},
+		HiddenCommands: []string{"remote prune"},
+	}
+
+	for _, testCase := range testCases {
+		if v := cli.MatchCommands(testCase.pattern); !reflect.DeepEqual(v, testCase.expected) {
+			t.Errorf("MatchCommands(%q): bad: %#v", testCase.pattern, v)
+		}
+		if v := cli.MatchAllCommands(testCase.pattern); !reflect.DeepEqual(v, testCase.all) {
+			t.Errorf("MatchAllCommands(%q): bad: %#v", testCase.pattern, v)
+		}
+	}
+}
+
+func TestCLIDebugDump(t *testing.T) {
+	cli := &CLI{
+		Name:    "app",
+		Version: "1.2.3",
+		Args:    []string{"foo", "bar"},
+		Commands: map[string]CommandFactory{
+			"foo bar": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"zip": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		HiddenCommands: []string{"zip"},
+		HelpWriter:     new(bytes.Buffer),
+	}
+
+	buf := new(bytes.Buffer)
+	cli.DebugDump(buf)
+
+	for _, expected := range []string{
+		"Name: app\n",
+		"Version: 1.2.3\n",
+		"HelpWriter: *bytes.Buffer\n",
+		"ErrorWriter: *bytes.Buffer\n",
+		"Commands: 2\n",
+		"Commands (including parents): 3\n",
+		"Hidden commands: zip\n",
+		"Nested: true\n",
+		"Subcommand: \"foo bar\"\n",
+		fmt.Sprintf("NoColor: %t\n", NoColor),
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("missing %#v in:\n%s", expected, buf.String())
+		}
+	}
+}
+
 const testCommandNestedMissingParent = `This command is accessed by using one of the subcommands below.
 
 Subcommands:
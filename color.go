@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -12,12 +13,17 @@ import (
 var (
 	// NoColor defines if the output is colorized or not. It's dynamically set to
 	// false or true based on the stdout's file descriptor referring to a terminal
-	// or not. It's also set to true if the NO_COLOR environment variable is
-	// set (regardless of its value). This is a global option and affects all
-	// colors. For more control over each color block use the methods
-	// DisableColor() individually.
-	NoColor = noColorIsSet() || os.Getenv("TERM") == "dumb" ||
-		(!IsTerminal(os.Stdout.Fd()) && !IsCygwinTerminal(os.Stdout.Fd()))
+	// or not, and on the NO_COLOR, CLICOLOR, CLICOLOR_FORCE and FORCE_COLOR
+	// environment variables. See resolveColorPreference for the precedence.
+	// This is a global option and affects all colors. For more control over
+	// each color block use the methods DisableColor() individually.
+	NoColor = !resolveColorPreference(os.Stdout)
+
+	// NoColorError is the same as NoColor but is based on stderr's file
+	// descriptor. It is used instead of NoColor when writing to ColorError
+	// or os.Stderr, so that each stream is colorized correctly when only
+	// one of them is redirected.
+	NoColorError = !resolveColorPreference(os.Stderr)
 
 	// ColorOutput defines the standard output of the print functions. By default,
 	// os.Stdout is used.
@@ -37,6 +43,39 @@ func noColorIsSet() bool {
 	return os.Getenv("NO_COLOR") != ""
 }
 
+// isTerminalFile reports whether the file refers to a terminal.
+var isTerminalFile = func(f *os.File) bool {
+	return IsTerminal(f.Fd()) || IsCygwinTerminal(f.Fd())
+}
+
+// resolveColorPreference returns true if output written to f should be
+// colorized. The environment takes precedence over the terminal detection,
+// in this order:
+//
+//  1. NO_COLOR set to any non-empty value disables color.
+//  2. CLICOLOR=0 disables color.
+//  3. CLICOLOR_FORCE or FORCE_COLOR set to a value other than "0" forces
+//     color, for example to keep colors when output is piped to a log
+//     viewer.
+//  4. Otherwise color is used if f is a terminal and TERM isn't "dumb".
+func resolveColorPreference(f *os.File) bool {
+	if noColorIsSet() || os.Getenv("CLICOLOR") == "0" {
+		return false
+	}
+	if envIsSetNonZero("CLICOLOR_FORCE") || envIsSetNonZero("FORCE_COLOR") {
+		return true
+	}
+
+	return os.Getenv("TERM") != "dumb" && isTerminalFile(f)
+}
+
+// envIsSetNonZero returns true if the environment variable key is set to a
+// non-empty string other than "0".
+func envIsSetNonZero(key string) bool {
+	v := os.Getenv(key)
+	return v != "" && v != "0"
+}
+
 // Color defines a custom color object which is defined by SGR parameters.
 type Color struct {
 	params  []ColorAttribute
@@ -133,6 +172,17 @@ const (
 	ColorBgHiWhite
 )
 
+// Extended color attributes. An extended color is a single attribute made
+// of several SGR parameters: 38 or 48, followed by 5 and a palette index, or
+// by 2 and the red, green and blue components.
+const (
+	colorFgExtended ColorAttribute = 38
+	colorBgExtended ColorAttribute = 48
+
+	colorExtended256 ColorAttribute = 5
+	colorExtendedRGB ColorAttribute = 2
+)
+
 // New returns a newly created color object.
 func NewColor(value ...ColorAttribute) *Color {
 	c := &Color{
@@ -147,6 +197,59 @@ func NewColor(value ...ColorAttribute) *Color {
 	return c
 }
 
+// NewColor256 returns a color that sets the foreground to n from the
+// 256-color palette. It can be combined with other attributes using Add.
+func NewColor256(n uint8) *Color {
+	return NewColor(colorFgExtended, colorExtended256, ColorAttribute(n))
+}
+
+// NewBgColor256 returns a color that sets the background to n from the
+// 256-color palette. It can be combined with other attributes using Add.
+func NewBgColor256(n uint8) *Color {
+	return NewColor(colorBgExtended, colorExtended256, ColorAttribute(n))
+}
+
+// NewColorRGB returns a color that sets the foreground to the 24-bit color
+// with the given red, green and blue components. It requires a terminal
+// with truecolor support.
+func NewColorRGB(r, g, b uint8) *Color {
+	return NewColor(colorFgExtended, colorExtendedRGB, ColorAttribute(r), ColorAttribute(g), ColorAttribute(b))
+}
+
+// NewBgColorRGB returns a color that sets the background to the 24-bit
+// color with the given red, green and blue components.
+func NewBgColorRGB(r, g, b uint8) *Color {
+	return NewColor(colorBgExtended, colorExtendedRGB, ColorAttribute(r), ColorAttribute(g), ColorAttribute(b))
+}
+
+// NewColorHex returns a color that sets the foreground to the 24-bit color
+// written as a hex string, such as "#ff8800" or "ff8800". An invalid string
+// returns an error.
+func NewColorHex(hex string) (*Color, error) {
+	r, g, b, err := parseHexColor(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewColorRGB(r, g, b), nil
+}
+
+// parseHexColor parses a "#rrggbb" or "rrggbb" string into its red, green
+// and blue components.
+func parseHexColor(hex string) (r, g, b uint8, err error) {
+	s := strings.TrimPrefix(hex, "#")
+	if len(s) != 6 {
+		return 0, 0, 0, fmt.Errorf("invalid hex color %q: expected 6 hex digits", hex)
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid hex color %q: %q is not a hex number", hex, s)
+	}
+
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), nil
+}
+
 // Set sets the given parameters immediately. It will change the color of
 // output with the given SGR parameters until color.Unset() is called.
 func Set(p ...ColorAttribute) *Color {
@@ -187,7 +290,7 @@ func (c *Color) unset() {
 // a low-level function, and users should use the higher-level functions, such
 // as color.Fprint, color.Print, etc.
 func (c *Color) SetWriter(w io.Writer) *Color {
-	if c.isNoColorSet() {
+	if c.isNoColorSetFor(w) {
 		return c
 	}
 
@@ -198,11 +301,11 @@ func (c *Color) SetWriter(w io.Writer) *Color {
 // UnsetWriter resets all colorEscape attributes and clears the output with the give
 // io.Writer. Usually should be called after SetWriter().
 func (c *Color) UnsetWriter(w io.Writer) {
-	if c.isNoColorSet() {
+	if c.isNoColorSetFor(w) {
 		return
 	}
 
-	if NoColor {
+	if globalNoColorFor(w) {
 		return
 	}
 
@@ -221,11 +324,43 @@ func (c *Color) Add(value ...ColorAttribute) *Color {
 // It returns the number of bytes written and any write error encountered.
 // On Windows, users should wrap w with NewColorable() if w is of
 // type *os.File.
+//
+// If writing the content fails, the reset sequence is not written and the
+// original error is returned.
 func (c *Color) Fprint(w io.Writer, a ...interface{}) (n int, err error) {
 	c.SetWriter(w)
-	defer c.UnsetWriter(w)
 
-	return fmt.Fprint(w, a...)
+	n, err = fmt.Fprint(w, a...)
+	if err != nil {
+		return n, err
+	}
+
+	c.UnsetWriter(w)
+	return n, nil
+}
+
+// FprintCtx is like Fprint but takes the color capability of w from the
+// caller instead of detecting it, for example for a server that writes to
+// the terminals of several clients. If forceColor is nil, it behaves just
+// like Fprint. Otherwise the output is colored if and only if *forceColor
+// is true, regardless of NoColor, NoColorError and DisableColor.
+func (c *Color) FprintCtx(w io.Writer, forceColor *bool, a ...interface{}) (n int, err error) {
+	if forceColor == nil {
+		return c.Fprint(w, a...)
+	}
+	if !*forceColor {
+		return fmt.Fprint(w, a...)
+	}
+
+	fmt.Fprint(w, c.format())
+
+	n, err = fmt.Fprint(w, a...)
+	if err != nil {
+		return n, err
+	}
+
+	fmt.Fprintf(w, "%s[%dm", colorEscape, ColorReset)
+	return n, nil
 }
 
 // Print formats using the default formats for its operands and writes to
@@ -244,11 +379,19 @@ func (c *Color) Print(a ...interface{}) (n int, err error) {
 // It returns the number of bytes written and any write error encountered.
 // On Windows, users should wrap w with NewColorable() if w is of
 // type *os.File.
+//
+// If writing the content fails, the reset sequence is not written and the
+// original error is returned.
 func (c *Color) Fprintf(w io.Writer, format string, a ...interface{}) (n int, err error) {
 	c.SetWriter(w)
-	defer c.UnsetWriter(w)
 
-	return fmt.Fprintf(w, format, a...)
+	n, err = fmt.Fprintf(w, format, a...)
+	if err != nil {
+		return n, err
+	}
+
+	c.UnsetWriter(w)
+	return n, nil
 }
 
 // Printf formats according to a format specifier and writes to standard output.
@@ -265,8 +408,16 @@ func (c *Color) Printf(format string, a ...interface{}) (n int, err error) {
 // Spaces are always added between operands and a newline is appended.
 // On Windows, users should wrap w with NewColorable() if w is of
 // type *os.File.
+//
+// The colored content and its reset sequence are written in a single call,
+// so a failed write never leaves a dangling reset behind.
 func (c *Color) Fprintln(w io.Writer, a ...interface{}) (n int, err error) {
-	return fmt.Fprintln(w, c.wrap(fmt.Sprint(a...)))
+	s := fmt.Sprint(a...)
+	if !c.isNoColorSetFor(w) {
+		s = c.format() + s + c.unformat()
+	}
+
+	return fmt.Fprintln(w, s)
 }
 
 // Println formats using the default formats for its operands and writes to
@@ -399,11 +550,12 @@ func (c *Color) format() string {
 func (c *Color) unformat() string {
 	//return fmt.Sprintf("%s[%dm", colorEscape, ColorReset)
 	//for each element in sequence let's use the speficic reset colorEscape, ou the generic one if not found
-	format := make([]string, len(c.params))
-	for i, v := range c.params {
+	groups := colorAttributeGroups(c.params)
+	format := make([]string, len(groups))
+	for i, g := range groups {
 		format[i] = strconv.Itoa(int(ColorReset))
-		ra, ok := mapResetAttributes[v]
-		if ok {
+		ra, ok := mapResetAttributes[g[0]]
+		if ok && len(g) == 1 {
 			format[i] = strconv.Itoa(int(ra))
 		}
 	}
@@ -411,6 +563,34 @@ func (c *Color) unformat() string {
 	return fmt.Sprintf("%s[%sm", colorEscape, strings.Join(format, ";"))
 }
 
+// colorAttributeGroups splits params into single attributes, keeping the
+// parameters of an extended color together so they are not mistaken for
+// attributes of their own.
+func colorAttributeGroups(params []ColorAttribute) [][]ColorAttribute {
+	var groups [][]ColorAttribute
+	for i := 0; i < len(params); i++ {
+		n := 1
+		if params[i] == colorFgExtended || params[i] == colorBgExtended {
+			if i+1 < len(params) {
+				switch params[i+1] {
+				case colorExtended256:
+					n = 3
+				case colorExtendedRGB:
+					n = 5
+				}
+			}
+			if i+n > len(params) {
+				n = len(params) - i
+			}
+		}
+
+		groups = append(groups, params[i:i+n])
+		i += n - 1
+	}
+
+	return groups
+}
+
 // DisableColor disables the color output. Useful to not change any existing
 // code and still being able to output. Can be used for flags like
 // "--no-color". To enable back use EnableColor() method.
@@ -434,6 +614,81 @@ func (c *Color) isNoColorSet() bool {
 	return NoColor
 }
 
+// isNoColorSetFor is like isNoColorSet but uses the global option that
+// belongs to the stream w writes to.
+func (c *Color) isNoColorSetFor(w io.Writer) bool {
+	if c.noColor != nil {
+		return *c.noColor
+	}
+
+	return globalNoColorFor(w)
+}
+
+// globalNoColorFor returns NoColorError for writes to stderr and NoColor
+// for everything else. The writers of a CLI with ForceColor set follow it
+// instead.
+func globalNoColorFor(w io.Writer) bool {
+	if f, ok := w.(*forcedColorWriter); ok {
+		return !f.color
+	}
+	if f, ok := w.(*os.File); ok && f == os.Stderr {
+		return NoColorError
+	}
+	if sameValue(w, ColorError) {
+		return NoColorError
+	}
+
+	return NoColor
+}
+
+// forcedColorWriter is a writer of a CLI whose color output is decided by
+// CLI.ForceColor for a run. Escape sequences are stripped from what is
+// written to it if color is off.
+type forcedColorWriter struct {
+	io.Writer
+	color bool
+}
+
+func (w *forcedColorWriter) Write(p []byte) (int, error) {
+	if w.color {
+		return w.Writer.Write(p)
+	}
+
+	if _, err := io.WriteString(w.Writer, StripColor(string(p))); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// forced returns c, or a copy of c that is colored if and only if
+// *forceColor is true, like FprintCtx, if forceColor isn't nil.
+func (c *Color) forced(forceColor *bool) *Color {
+	if forceColor == nil {
+		return c
+	}
+
+	result := *c
+	result.noColor = boolPtr(!*forceColor)
+	return &result
+}
+
+// sameValue returns true if a and b, such as two writers, are the same.
+// Values of a type that can't be compared, such as a func, are never the
+// same, as comparing them with == would panic.
+func sameValue(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return false
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Type() != vb.Type() || !va.Comparable() || !vb.Comparable() {
+		return false
+	}
+
+	return a == b
+}
+
 // Equals returns a boolean value indicating whether two colors are equal.
 func (c *Color) Equals(c2 *Color) bool {
 	if c == nil && c2 == nil {
@@ -442,12 +697,14 @@ func (c *Color) Equals(c2 *Color) bool {
 	if c == nil || c2 == nil {
 		return false
 	}
-	if len(c.params) != len(c2.params) {
+
+	groups, groups2 := colorAttributeGroups(c.params), colorAttributeGroups(c2.params)
+	if len(groups) != len(groups2) {
 		return false
 	}
 
-	for _, attr := range c.params {
-		if !c2.attrExists(attr) {
+	for _, g := range groups {
+		if !attrGroupExists(groups2, g) {
 			return false
 		}
 	}
@@ -455,9 +712,20 @@ func (c *Color) Equals(c2 *Color) bool {
 	return true
 }
 
-func (c *Color) attrExists(a ColorAttribute) bool {
-	for _, attr := range c.params {
-		if attr == a {
+func attrGroupExists(groups [][]ColorAttribute, a []ColorAttribute) bool {
+	for _, g := range groups {
+		if len(g) != len(a) {
+			continue
+		}
+
+		equal := true
+		for i := range g {
+			if g[i] != a[i] {
+				equal = false
+				break
+			}
+		}
+		if equal {
 			return true
 		}
 	}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"os"
+)
+
+// badgePalette maps the base background colors to their usual RGB values
+// in a terminal, to find the closest one to a truecolor background.
+var badgePalette = []struct {
+	attr ColorAttribute
+	rgb  [3]uint8
+}{
+	{ColorBgBlack, [3]uint8{0, 0, 0}},
+	{ColorBgRed, [3]uint8{205, 0, 0}},
+	{ColorBgGreen, [3]uint8{0, 205, 0}},
+	{ColorBgYellow, [3]uint8{205, 205, 0}},
+	{ColorBgBlue, [3]uint8{0, 0, 238}},
+	{ColorBgMagenta, [3]uint8{205, 0, 205}},
+	{ColorBgCyan, [3]uint8{0, 205, 205}},
+	{ColorBgWhite, [3]uint8{229, 229, 229}},
+	{ColorBgHiBlack, [3]uint8{127, 127, 127}},
+	{ColorBgHiRed, [3]uint8{255, 0, 0}},
+	{ColorBgHiGreen, [3]uint8{0, 255, 0}},
+	{ColorBgHiYellow, [3]uint8{255, 255, 0}},
+	{ColorBgHiBlue, [3]uint8{92, 92, 255}},
+	{ColorBgHiMagenta, [3]uint8{255, 0, 255}},
+	{ColorBgHiCyan, [3]uint8{0, 255, 255}},
+	{ColorBgHiWhite, [3]uint8{255, 255, 255}},
+}
+
+// BadgeString returns text on the background color bg, given as red, green
+// and blue, with a black or white foreground, whichever is more readable on
+// that background. If the terminal doesn't announce truecolor support in
+// COLORTERM, the closest base background color is used instead.
+func BadgeString(text string, bg [3]uint8) string {
+	if NoColor {
+		return text
+	}
+
+	light := badgeIsLight(bg)
+	if !supportsTrueColor() {
+		fg := ColorFgWhite
+		if light {
+			fg = ColorFgBlack
+		}
+
+		return NewColor(fg, badgeClosestBg(bg)).Sprint(text)
+	}
+
+	var fg uint8
+	if !light {
+		fg = 255
+	}
+
+	return fmt.Sprintf("%s[38;2;%d;%d;%d;48;2;%d;%d;%dm%s%s[0m",
+		colorEscape, fg, fg, fg, bg[0], bg[1], bg[2], text, colorEscape)
+}
+
+// supportsTrueColor returns true if the terminal announces that it supports
+// 24-bit colors.
+func supportsTrueColor() bool {
+	v := os.Getenv("COLORTERM")
+	return v == "truecolor" || v == "24bit"
+}
+
+// badgeIsLight returns true if black text is more readable than white text
+// on the color c, based on its relative luminance.
+func badgeIsLight(c [3]uint8) bool {
+	linear := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.03928 {
+			return f / 12.92
+		}
+
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+
+	l := 0.2126*linear(c[0]) + 0.7152*linear(c[1]) + 0.0722*linear(c[2])
+
+	// Above this luminance the contrast ratio against black is higher
+	// than against white.
+	return l > 0.179
+}
+
+// badgeClosestBg returns the base background color closest to c.
+func badgeClosestBg(c [3]uint8) ColorAttribute {
+	result := ColorBgBlack
+	best := -1
+	for _, p := range badgePalette {
+		d := 0
+		for i := range c {
+			v := int(c[i]) - int(p.rgb[i])
+			d += v * v
+		}
+
+		if best == -1 || d < best {
+			result, best = p.attr, d
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestBadgeString(t *testing.T) {
+	withColor(t)
+	t.Setenv("COLORTERM", "truecolor")
+
+	cases := []struct {
+		BG     [3]uint8
+		Output string
+	}{
+		{
+			[3]uint8{255, 255, 200},
+			"\x1b[38;2;0;0;0;48;2;255;255;200mfoo\x1b[0m",
+		},
+		{
+			[3]uint8{20, 20, 80},
+			"\x1b[38;2;255;255;255;48;2;20;20;80mfoo\x1b[0m",
+		},
+		{
+			[3]uint8{0, 200, 0},
+			"\x1b[38;2;0;0;0;48;2;0;200;0mfoo\x1b[0m",
+		},
+		{
+			[3]uint8{200, 0, 0},
+			"\x1b[38;2;255;255;255;48;2;200;0;0mfoo\x1b[0m",
+		},
+	}
+
+	for _, tc := range cases {
+		if actual := BadgeString("foo", tc.BG); actual != tc.Output {
+			t.Fatalf("%v: bad: %#v", tc.BG, actual)
+		}
+	}
+}
+
+func TestBadgeString_baseColors(t *testing.T) {
+	withColor(t)
+	t.Setenv("COLORTERM", "")
+
+	cases := []struct {
+		BG     [3]uint8
+		Output string
+	}{
+		{
+			[3]uint8{250, 250, 10},
+			"\x1b[30;103mfoo\x1b[0;0m",
+		},
+		{
+			[3]uint8{10, 10, 200},
+			"\x1b[37;44mfoo\x1b[0;0m",
+		},
+	}
+
+	for _, tc := range cases {
+		if actual := BadgeString("foo", tc.BG); actual != tc.Output {
+			t.Fatalf("%v: bad: %#v", tc.BG, actual)
+		}
+	}
+}
+
+func TestBadgeString_noColor(t *testing.T) {
+	old := NoColor
+	NoColor = true
+	t.Cleanup(func() { NoColor = old })
+
+	if actual := BadgeString("foo", [3]uint8{1, 2, 3}); actual != "foo" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// dumpKeyColor is the color of the field names written by ColorDump.
+var dumpKeyColor = NewColor(ColorFgCyan)
+
+// ColorDump writes the exported fields of the struct v to w for debugging,
+// one "Name: value" line per field with the field name in color. Fields
+// that are structs, or pointers to them, are written below their name,
+// indented by two spaces, unless they implement fmt.Stringer or error.
+// Unexported fields are skipped. A pointer back to a struct that is
+// already being written is written as "<cycle>". Colors are left out if
+// NoColor, or NoColorError when w is stderr, is set.
+//
+// If v isn't a struct or a pointer to one, it is written as is.
+func ColorDump(w io.Writer, v interface{}) {
+	colorDump(w, reflect.ValueOf(v), "", make(map[dumpVisit]bool))
+}
+
+// dumpVisit identifies a struct that ColorDump is writing. The type is
+// part of it because a struct shares its address with its first field.
+type dumpVisit struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+// colorDump writes the fields of v. The structs being written by the
+// callers up the stack are in visiting.
+func colorDump(w io.Writer, v reflect.Value, indent string, visiting map[dumpVisit]bool) {
+	v, ok := dumpStruct(v)
+	if !ok {
+		fmt.Fprintf(w, "%s%s\n", indent, dumpValue(v))
+		return
+	}
+
+	if v.CanAddr() {
+		visit := dumpVisit{v.UnsafeAddr(), v.Type()}
+		visiting[visit] = true
+		defer delete(visiting, visit)
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// Unexported
+			continue
+		}
+
+		name := field.Name
+		if !dumpKeyColor.isNoColorSetFor(w) {
+			name = dumpKeyColor.format() + name + dumpKeyColor.unformat()
+		}
+
+		value := v.Field(i)
+		if nested, ok := dumpStruct(value); ok {
+			if nested.CanAddr() && visiting[dumpVisit{nested.UnsafeAddr(), nested.Type()}] {
+				fmt.Fprintf(w, "%s%s: <cycle>\n", indent, name)
+				continue
+			}
+
+			fmt.Fprintf(w, "%s%s:\n", indent, name)
+			colorDump(w, nested, indent+"  ", visiting)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s%s: %s\n", indent, name, dumpValue(value))
+	}
+}
+
+// dumpStruct returns the struct v is or points to, if ColorDump should
+// write its fields.
+func dumpStruct(v reflect.Value) (reflect.Value, bool) {
+	if !v.IsValid() {
+		return v, false
+	}
+	if v.CanInterface() {
+		switch v.Interface().(type) {
+		case fmt.Stringer, error:
+			return v, false
+		}
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+
+	return v, v.Kind() == reflect.Struct
+}
+
+// dumpValue formats a value that ColorDump doesn't descend into.
+func dumpValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("%v", v.Interface())
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type dumpInner struct {
+	Host string
+	Port int
+}
+
+type dumpNode struct {
+	Name string
+	Next *dumpNode
+}
+
+type dumpOuter struct {
+	Name     string
+	Tags     []string
+	Inner    dumpInner
+	Pointer  *dumpInner
+	Missing  *dumpInner
+	Err      error
+	internal string
+}
+
+func TestColorDump(t *testing.T) {
+	withColor(t)
+
+	buf := new(bytes.Buffer)
+	ColorDump(buf, dumpInner{Host: "localhost", Port: 8080})
+
+	expected := "\x1b[36mHost\x1b[0m: localhost\n\x1b[36mPort\x1b[0m: 8080\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestColorDump_nested(t *testing.T) {
+	old := NoColor
+	NoColor = true
+	defer func() { NoColor = old }()
+
+	buf := new(bytes.Buffer)
+	ColorDump(buf, &dumpOuter{
+		Name:     "web",
+		Tags:     []string{"a", "b"},
+		Inner:    dumpInner{Host: "localhost", Port: 80},
+		Pointer:  &dumpInner{Host: "example.com"},
+		Err:      errors.New("boom"),
+		internal: "hidden",
+	})
+
+	expected := `Name: web
+Tags: [a b]
+Inner:
+  Host: localhost
+  Port: 80
+Pointer:
+  Host: example.com
+  Port: 0
+Missing: <nil>
+Err: boom
+`
+	if buf.String() != expected {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+}
+
+func TestColorDump_notStruct(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ColorDump(buf, 42)
+	ColorDump(buf, nil)
+
+	if buf.String() != "42\n<nil>\n" {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestColorDump_cycle(t *testing.T) {
+	old := NoColor
+	NoColor = true
+	defer func() { NoColor = old }()
+
+	n := dumpNode{Name: "a"}
+	n.Next = &n
+	shared := &dumpNode{Name: "c"}
+
+	buf := new(bytes.Buffer)
+	ColorDump(buf, &n)
+	ColorDump(buf, &dumpNode{Name: "b", Next: shared})
+
+	expected := `Name: a
+Next: <cycle>
+Name: b
+Next:
+  Name: c
+  Next: <nil>
+`
+	if buf.String() != expected {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"regexp"
+	"strings"
+)
+
+// logLevelPatterns match the level token of a log line in the supported
+// formats. The first group is the level itself.
+var logLevelPatterns = []*regexp.Regexp{
+	// [ERROR] something failed
+	regexp.MustCompile(`\[(?i)(error|err|warning|warn|info|debug|trace)\]`),
+
+	// time=... level=error msg="something failed"
+	regexp.MustCompile(`(?:^|\s)level="?(?i)(error|err|warning|warn|info|debug|trace)\b`),
+
+	// ERROR: something failed
+	regexp.MustCompile(`^(?i)(error|err|warning|warn|info|debug|trace)\b`),
+}
+
+// logLevelColors are the colors of the log levels, by their lower case
+// name.
+var logLevelColors = map[string]ColorAttribute{
+	"error":   ColorFgRed,
+	"err":     ColorFgRed,
+	"warning": ColorFgYellow,
+	"warn":    ColorFgYellow,
+	"info":    ColorFgGreen,
+	"debug":   ColorFaint,
+	"trace":   ColorFaint,
+}
+
+// ColorizeLogLine colors the level of a log line: errors red, warnings
+// yellow, info green and debug and trace messages dim. The level is
+// recognized in brackets anywhere in the line, such as "[ERROR]", as a
+// logfmt field such as "level=error", or as the first word of the line
+// such as "ERROR:". If several are found, the first one in the line is
+// used. Only the level itself is colored, the rest of the line is returned
+// as is, and lines without a level are returned unchanged.
+func ColorizeLogLine(line string) string {
+	start, end := -1, -1
+	for _, re := range logLevelPatterns {
+		m := re.FindStringSubmatchIndex(line)
+		if m != nil && (start == -1 || m[2] < start) {
+			start, end = m[2], m[3]
+		}
+	}
+	if start == -1 {
+		return line
+	}
+
+	level := line[start:end]
+	c := getCachedColor(logLevelColors[strings.ToLower(level)])
+	return line[:start] + c.Sprint(level) + line[end:]
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestColorizeLogLine(t *testing.T) {
+	withColor(t)
+
+	cases := []struct {
+		Input  string
+		Output string
+	}{
+		// Bracketed
+		{
+			"[ERROR] disk full",
+			"[\x1b[31mERROR\x1b[0m] disk full",
+		},
+		{
+			"2024/01/02 15:04:05 [warn] retrying in 5s",
+			"2024/01/02 15:04:05 [\x1b[33mwarn\x1b[0m] retrying in 5s",
+		},
+		{
+			"[DEBUG] error count: 0",
+			"[\x1b[2mDEBUG\x1b[22m] error count: 0",
+		},
+
+		// logfmt
+		{
+			`time=2024-01-02T15:04:05Z level=info msg="started"`,
+			"time=2024-01-02T15:04:05Z level=\x1b[32minfo\x1b[0m msg=\"started\"",
+		},
+		{
+			`level="error" msg="[INFO] nested"`,
+			"level=\"\x1b[31merror\x1b[0m\" msg=\"[INFO] nested\"",
+		},
+
+		// Plain
+		{
+			"WARNING: low memory",
+			"\x1b[33mWARNING\x1b[0m: low memory",
+		},
+		{
+			"INFO listening on :8080",
+			"\x1b[32mINFO\x1b[0m listening on :8080",
+		},
+
+		// No level
+		{"information wants to be free", "information wants to be free"},
+		{"the error is here", "the error is here"},
+		{"loglevel=error", "loglevel=error"},
+		{"", ""},
+	}
+
+	for _, tc := range cases {
+		if actual := ColorizeLogLine(tc.Input); actual != tc.Output {
+			t.Fatalf("%q: bad: %#v", tc.Input, actual)
+		}
+	}
+}
+
+func TestColorizeLogLine_noColor(t *testing.T) {
+	old := NoColor
+	NoColor = true
+	t.Cleanup(func() { NoColor = old })
+
+	if actual := ColorizeLogLine("[ERROR] disk full"); actual != "[ERROR] disk full" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
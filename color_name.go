@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// colorNames maps the base color names to their foreground attribute.
+var colorNames = map[string]ColorAttribute{
+	"black":   ColorFgBlack,
+	"red":     ColorFgRed,
+	"green":   ColorFgGreen,
+	"yellow":  ColorFgYellow,
+	"blue":    ColorFgBlue,
+	"magenta": ColorFgMagenta,
+	"cyan":    ColorFgCyan,
+	"white":   ColorFgWhite,
+}
+
+// colorAttributeNames maps the names of the non-color attributes.
+var colorAttributeNames = map[string]ColorAttribute{
+	"reset":         ColorReset,
+	"bold":          ColorBold,
+	"faint":         ColorFaint,
+	"dim":           ColorFaint,
+	"italic":        ColorItalic,
+	"underline":     ColorUnderline,
+	"blink":         ColorBlinkSlow,
+	"blink-rapid":   ColorBlinkRapid,
+	"reverse":       ColorReverseVideo,
+	"concealed":     ColorConcealed,
+	"crossed-out":   ColorCrossedOut,
+	"strikethrough": ColorCrossedOut,
+}
+
+// ColorByName returns a Color for a common color or attribute name such as
+// "red", "bold" or "underline". Names are case insensitive.
+//
+// Colors can be prefixed with "bright-" or "hi-" for the high-intensity
+// variant and with "bg-" for the background color, for example "bg-red"
+// or "bg-bright-red". An unknown name returns an error.
+func ColorByName(name string) (*Color, error) {
+	attr, err := colorAttributeByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewColor(attr), nil
+}
+
+// colorAttributeByName returns the ColorAttribute for the name. See
+// ColorByName for the accepted names.
+func colorAttributeByName(name string) (ColorAttribute, error) {
+	n := strings.ToLower(strings.TrimSpace(name))
+	if attr, ok := colorAttributeNames[n]; ok {
+		return attr, nil
+	}
+
+	var offset ColorAttribute
+	if strings.HasPrefix(n, "bg-") {
+		n = n[len("bg-"):]
+		offset += ColorBgBlack - ColorFgBlack
+	}
+	for _, prefix := range []string{"bright-", "hi-"} {
+		if strings.HasPrefix(n, prefix) {
+			n = n[len(prefix):]
+			offset += ColorFgHiBlack - ColorFgBlack
+			break
+		}
+	}
+
+	attr, ok := colorNames[n]
+	if !ok {
+		return 0, fmt.Errorf("unknown color name %q", name)
+	}
+
+	return attr + offset, nil
+}
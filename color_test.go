@@ -0,0 +1,411 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// failingWriter accepts up to limit bytes and then fails every write.
+type failingWriter struct {
+	limit  int
+	writes []string
+}
+
+var errFailingWriter = errors.New("write failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.limit < len(p) {
+		n := w.limit
+		w.writes = append(w.writes, string(p[:n]))
+		w.limit = 0
+		return n, errFailingWriter
+	}
+
+	w.limit -= len(p)
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func withColor(t *testing.T) {
+	old := NoColor
+	NoColor = false
+	t.Cleanup(func() { NoColor = old })
+}
+
+func TestColorFprint_writeError(t *testing.T) {
+	withColor(t)
+
+	c := NewColor(ColorFgRed)
+	c.EnableColor()
+
+	w := &failingWriter{limit: len(c.format()) + 2}
+	n, err := c.Fprint(w, "hello")
+	if err != errFailingWriter {
+		t.Fatalf("bad err: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("bad n: %d", n)
+	}
+
+	for _, s := range w.writes {
+		if strings.Contains(s, "[0m") {
+			t.Fatalf("reset should not be written: %#v", w.writes)
+		}
+	}
+}
+
+func TestColorFprintf_writeError(t *testing.T) {
+	withColor(t)
+
+	c := NewColor(ColorFgRed)
+	c.EnableColor()
+
+	w := &failingWriter{limit: len(c.format())}
+	_, err := c.Fprintf(w, "hello %s", "world")
+	if err != errFailingWriter {
+		t.Fatalf("bad err: %v", err)
+	}
+	if len(w.writes) != 2 {
+		t.Fatalf("reset should not be written: %#v", w.writes)
+	}
+}
+
+func TestColorFprintln_writeError(t *testing.T) {
+	withColor(t)
+
+	c := NewColor(ColorFgRed)
+	c.EnableColor()
+
+	w := &failingWriter{limit: 3}
+	_, err := c.Fprintln(w, "hello")
+	if err != errFailingWriter {
+		t.Fatalf("bad err: %v", err)
+	}
+	if len(w.writes) != 1 {
+		t.Fatalf("bad writes: %#v", w.writes)
+	}
+}
+
+func TestColorFprint_resetOnSuccess(t *testing.T) {
+	withColor(t)
+
+	c := NewColor(ColorFgRed)
+	c.EnableColor()
+
+	w := &failingWriter{limit: 1024}
+	if _, err := c.Fprint(w, "hello"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"\x1b[31m", "hello", "\x1b[0m"}
+	if strings.Join(w.writes, "|") != strings.Join(expected, "|") {
+		t.Fatalf("bad writes: %#v", w.writes)
+	}
+}
+
+func TestResolveColorPreference_perStream(t *testing.T) {
+	for _, k := range []string{"NO_COLOR", "CLICOLOR", "CLICOLOR_FORCE", "FORCE_COLOR"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("TERM", "xterm")
+
+	old := isTerminalFile
+	defer func() { isTerminalFile = old }()
+
+	testCases := []struct {
+		name          string
+		terminal      *os.File
+		stdout, error bool
+	}{
+		{"StdoutTerminal", os.Stdout, true, false},
+		{"StderrTerminal", os.Stderr, false, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			isTerminalFile = func(f *os.File) bool { return f == tc.terminal }
+
+			if v := resolveColorPreference(os.Stdout); v != tc.stdout {
+				t.Fatalf("bad stdout: %v", v)
+			}
+			if v := resolveColorPreference(os.Stderr); v != tc.error {
+				t.Fatalf("bad stderr: %v", v)
+			}
+		})
+	}
+}
+
+func TestResolveColorPreference(t *testing.T) {
+	old := isTerminalFile
+	defer func() { isTerminalFile = old }()
+
+	testCases := []struct {
+		name                                         string
+		noColor, cliColor, cliColorForce, forceColor string
+		terminal                                     bool
+		term                                         string
+		expected                                     bool
+	}{
+		{"terminal", "", "", "", "", true, "xterm", true},
+		{"not a terminal", "", "", "", "", false, "xterm", false},
+		{"dumb terminal", "", "", "", "", true, "dumb", false},
+		{"NO_COLOR", "1", "", "", "", true, "xterm", false},
+		{"NO_COLOR beats CLICOLOR_FORCE", "1", "", "1", "", true, "xterm", false},
+		{"CLICOLOR=0", "", "0", "", "", true, "xterm", false},
+		{"CLICOLOR=0 beats CLICOLOR_FORCE", "", "0", "1", "", false, "xterm", false},
+		{"CLICOLOR=1", "", "1", "", "", false, "xterm", false},
+		{"CLICOLOR_FORCE", "", "", "1", "", false, "xterm", true},
+		{"CLICOLOR_FORCE on dumb terminal", "", "", "1", "", true, "dumb", true},
+		{"CLICOLOR_FORCE=0", "", "", "0", "", false, "xterm", false},
+		{"FORCE_COLOR", "", "", "", "true", false, "xterm", true},
+		{"FORCE_COLOR=0", "", "", "", "0", false, "xterm", false},
+		{"NO_COLOR beats FORCE_COLOR", "1", "", "", "1", false, "xterm", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tc.noColor)
+			t.Setenv("CLICOLOR", tc.cliColor)
+			t.Setenv("CLICOLOR_FORCE", tc.cliColorForce)
+			t.Setenv("FORCE_COLOR", tc.forceColor)
+			t.Setenv("TERM", tc.term)
+			isTerminalFile = func(f *os.File) bool { return tc.terminal }
+
+			if v := resolveColorPreference(os.Stdout); v != tc.expected {
+				t.Fatalf("bad: %v", v)
+			}
+		})
+	}
+}
+
+func TestColorFprint_perStream(t *testing.T) {
+	oldNoColor, oldNoColorError, oldColorError := NoColor, NoColorError, ColorError
+	defer func() {
+		NoColor, NoColorError, ColorError = oldNoColor, oldNoColorError, oldColorError
+	}()
+
+	out := new(bytes.Buffer)
+	errOut := new(bytes.Buffer)
+	ColorError = errOut
+
+	c := NewColor(ColorFgRed)
+
+	// stdout is a terminal, stderr is redirected
+	NoColor, NoColorError = false, true
+	c.Fprint(out, "out")
+	c.Fprintln(ColorError, "err")
+	if out.String() != "\x1b[31mout\x1b[0m" {
+		t.Fatalf("bad: %#v", out.String())
+	}
+	if errOut.String() != "err\n" {
+		t.Fatalf("bad: %#v", errOut.String())
+	}
+
+	// stderr is a terminal, stdout is redirected
+	out.Reset()
+	errOut.Reset()
+	NoColor, NoColorError = true, false
+	c.Fprintln(out, "out")
+	c.Fprint(ColorError, "err")
+	if out.String() != "out\n" {
+		t.Fatalf("bad: %#v", out.String())
+	}
+	if errOut.String() != "\x1b[31merr\x1b[0m" {
+		t.Fatalf("bad: %#v", errOut.String())
+	}
+}
+
+// funcWriter is a writer of a type that can't be compared.
+type funcWriter func([]byte) (int, error)
+
+func (f funcWriter) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestColorFprint_uncomparableWriter(t *testing.T) {
+	oldNoColor, oldNoColorError, oldColorError := NoColor, NoColorError, ColorError
+	defer func() {
+		NoColor, NoColorError, ColorError = oldNoColor, oldNoColorError, oldColorError
+	}()
+
+	errOut := new(bytes.Buffer)
+	ColorError = funcWriter(errOut.Write)
+	NoColor, NoColorError = false, true
+
+	out := new(bytes.Buffer)
+	NewColor(ColorFgRed).Fprint(funcWriter(out.Write), "out")
+	if out.String() != "\x1b[31mout\x1b[0m" {
+		t.Fatalf("bad: %#v", out.String())
+	}
+}
+
+func TestColorFprintCtx(t *testing.T) {
+	old := NoColor
+	defer func() { NoColor = old }()
+
+	on, off := true, false
+	testCases := []struct {
+		noColor    bool
+		forceColor *bool
+		expected   string
+	}{
+		{false, &on, "\x1b[31mhello\x1b[0m"},
+		{true, &on, "\x1b[31mhello\x1b[0m"},
+		{false, &off, "hello"},
+		{true, &off, "hello"},
+		{false, nil, "\x1b[31mhello\x1b[0m"},
+		{true, nil, "hello"},
+	}
+
+	for _, tc := range testCases {
+		NoColor = tc.noColor
+
+		w := new(bytes.Buffer)
+		n, err := NewColor(ColorFgRed).FprintCtx(w, tc.forceColor, "hello")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if n != 5 {
+			t.Fatalf("bad n: %d", n)
+		}
+		if w.String() != tc.expected {
+			t.Fatalf("NoColor %v: bad: %#v", tc.noColor, w.String())
+		}
+	}
+}
+
+func TestColorFprintCtx_overridesColor(t *testing.T) {
+	on := true
+
+	c := NewColor(ColorFgRed)
+	c.DisableColor()
+
+	w := new(bytes.Buffer)
+	c.FprintCtx(w, &on, "hello")
+	if w.String() != "\x1b[31mhello\x1b[0m" {
+		t.Fatalf("bad: %#v", w.String())
+	}
+}
+
+func TestColorByName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected ColorAttribute
+	}{
+		{"red", ColorFgRed},
+		{"Green", ColorFgGreen},
+		{" white ", ColorFgWhite},
+		{"bright-red", ColorFgHiRed},
+		{"hi-blue", ColorFgHiBlue},
+		{"bg-yellow", ColorBgYellow},
+		{"bg-bright-cyan", ColorBgHiCyan},
+		{"bg-hi-magenta", ColorBgHiMagenta},
+		{"bold", ColorBold},
+		{"dim", ColorFaint},
+		{"underline", ColorUnderline},
+	}
+
+	for _, tc := range testCases {
+		c, err := ColorByName(tc.name)
+		if err != nil {
+			t.Fatalf("err for %q: %s", tc.name, err)
+		}
+
+		if !c.Equals(NewColor(tc.expected)) {
+			t.Fatalf("bad color for %q: %#v", tc.name, c.params)
+		}
+	}
+}
+
+func TestColorByName_unknown(t *testing.T) {
+	for _, name := range []string{"", "purple", "bright-bold", "bg-"} {
+		if _, err := ColorByName(name); err == nil {
+			t.Fatalf("expected error for %q", name)
+		}
+	}
+}
+
+func TestNewColor256(t *testing.T) {
+	withColor(t)
+
+	testCases := []struct {
+		c        *Color
+		expected string
+	}{
+		{NewColor256(196), "\x1b[38;5;196mhi\x1b[0m"},
+		{NewBgColor256(21), "\x1b[48;5;21mhi\x1b[0m"},
+		{NewColor256(5).Add(ColorBold), "\x1b[38;5;5;1mhi\x1b[0;22m"},
+		{NewColor(ColorUnderline).Add(NewBgColor256(2).params...), "\x1b[4;48;5;2mhi\x1b[24;0m"},
+	}
+
+	for _, tc := range testCases {
+		if actual := tc.c.Sprint("hi"); actual != tc.expected {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
+
+func TestColorEquals_256(t *testing.T) {
+	if NewColor256(5).Equals(NewColor256(196)) {
+		t.Fatal("different palette colors should not be equal")
+	}
+	if !NewColor256(1).Add(ColorBold).Equals(NewColor(ColorBold).Add(NewColor256(1).params...)) {
+		t.Fatal("same attributes should be equal")
+	}
+	if NewColor256(1).Equals(NewBgColor256(1)) {
+		t.Fatal("foreground and background should not be equal")
+	}
+}
+
+func TestNewColorRGB(t *testing.T) {
+	withColor(t)
+
+	testCases := []struct {
+		c        *Color
+		expected string
+	}{
+		{NewColorRGB(255, 136, 0), "\x1b[38;2;255;136;0mhi\x1b[0m"},
+		{NewBgColorRGB(1, 2, 3), "\x1b[48;2;1;2;3mhi\x1b[0m"},
+		{NewColorRGB(5, 5, 5).Add(ColorItalic), "\x1b[38;2;5;5;5;3mhi\x1b[0;23m"},
+	}
+
+	for _, tc := range testCases {
+		if actual := tc.c.Sprint("hi"); actual != tc.expected {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
+
+func TestNewColorRGB_noColor(t *testing.T) {
+	c := NewColorRGB(255, 136, 0)
+	c.DisableColor()
+
+	if actual := c.Sprint("hi"); actual != "hi" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestNewColorHex(t *testing.T) {
+	for _, hex := range []string{"#ff8800", "ff8800", "#FF8800"} {
+		c, err := NewColorHex(hex)
+		if err != nil {
+			t.Fatalf("err for %q: %s", hex, err)
+		}
+
+		if !c.Equals(NewColorRGB(255, 136, 0)) {
+			t.Fatalf("bad color for %q: %#v", hex, c.params)
+		}
+	}
+}
+
+func TestNewColorHex_invalid(t *testing.T) {
+	for _, hex := range []string{"", "#", "#fff", "#ff880", "#ff88001", "#gg8800", "ff 880"} {
+		if _, err := NewColorHex(hex); err == nil {
+			t.Fatalf("expected error for %q", hex)
+		}
+	}
+}
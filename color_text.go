@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sgrRegexp matches a single SGR escape sequence such as "\x1b[1;31m".
+var sgrRegexp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// StripColor returns s with all SGR escape sequences removed, for example
+// to write captured output to a log file. Strings without escape sequences
+// are returned unchanged.
+func StripColor(s string) string {
+	return sgrRegexp.ReplaceAllString(s, "")
+}
+
+// IndentColored indents every non-empty line of s by the given number of
+// spaces. Colors that are still active at the end of a line are reset
+// before the line break and opened again after the indentation of the
+// next line, so the indentation itself is never colored.
+func IndentColored(s string, spaces int) string {
+	indent := strings.Repeat(" ", spaces)
+	reset := colorEscape + "[0m"
+
+	lines := strings.Split(s, "\n")
+	var active []string
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		prefix := indent + strings.Join(active, "")
+		for _, seq := range sgrRegexp.FindAllString(line, -1) {
+			if sgrIsReset(seq) {
+				active = active[:0]
+			} else {
+				active = append(active, seq)
+			}
+		}
+
+		suffix := ""
+		if len(active) > 0 && i < len(lines)-1 {
+			suffix = reset
+		}
+
+		lines[i] = prefix + line + suffix
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// sgrIsReset returns true if the SGR sequence resets all attributes.
+func sgrIsReset(seq string) bool {
+	params := strings.Split(seq[2:len(seq)-1], ";")
+	for i := 0; i < len(params); i++ {
+		switch params[i] {
+		case "", "0":
+			return true
+		case "38", "48":
+			// Extended colors, skip their arguments.
+			if i+1 < len(params) && params[i+1] == "5" {
+				i += 2
+			} else if i+1 < len(params) && params[i+1] == "2" {
+				i += 4
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestIndentColored(t *testing.T) {
+	red := "\x1b[31m"
+	bold := "\x1b[1m"
+	reset := "\x1b[0m"
+
+	testCases := []struct {
+		name     string
+		s        string
+		spaces   int
+		expected string
+	}{
+		{
+			"Plain",
+			"foo\nbar\n", 2,
+			"  foo\n  bar\n",
+		},
+		{
+			"ColorPerLine",
+			red + "foo" + reset + "\nbar", 4,
+			"    " + red + "foo" + reset + "\n    bar",
+		},
+		{
+			"ColorSpansLines",
+			red + "foo\nbar" + reset + "\nbaz", 2,
+			"  " + red + "foo" + reset + "\n  " + red + "bar" + reset + "\n  baz",
+		},
+		{
+			"NestedSpansLines",
+			red + bold + "foo\n\nbar\x1b[22;0m", 3,
+			"   " + red + bold + "foo" + reset + "\n\n   " + red + bold + "bar\x1b[22;0m",
+		},
+		{
+			"Extended",
+			"\x1b[38;5;0mfoo\nbar" + reset, 1,
+			" \x1b[38;5;0mfoo" + reset + "\n \x1b[38;5;0mbar" + reset,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := IndentColored(tc.s, tc.spaces)
+			if result != tc.expected {
+				t.Fatalf("bad: %#v", result)
+			}
+		})
+	}
+}
+
+func TestStripColor(t *testing.T) {
+	testCases := []struct {
+		s        string
+		expected string
+	}{
+		{"", ""},
+		{"plain text", "plain text"},
+		{"\x1b[31mred\x1b[0m", "red"},
+		{"\x1b[1m\x1b[31m\x1b[4mbold\x1b[0m\x1b[0m and \x1b[38;5;196mmore\x1b[0m", "bold and more"},
+		{"\x1b[38;2;255;136;0mrgb\x1b[m\n", "rgb\n"},
+	}
+
+	for _, tc := range testCases {
+		if actual := StripColor(tc.s); actual != tc.expected {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
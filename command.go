@@ -1,9 +1,20 @@
 package cli
 
+import (
+	"context"
+	"flag"
+	"io"
+)
+
 const (
 	// RunResultHelp is a value that can be returned from Run to signal
 	// to the CLI to render the help output.
 	RunResultHelp = -18511
+
+	// RunResultUsage is like RunResultHelp, but signals that the command
+	// was used incorrectly, for example with invalid arguments. The CLI
+	// renders the help output and exits with 2 instead of 1.
+	RunResultUsage = -18512
 )
 
 // A command is a runnable sub-command of a CLI.
@@ -40,6 +51,211 @@ type CommandHelpTemplate interface {
 	HelpTemplate() string
 }
 
+// CommandDestructive is an extension of Command for commands that must be
+// confirmed by the user before they run.
+//
+// The CLI asks for confirmation using its Ui. If the user declines, the
+// command is not run and the exit code is 0. The prompt is skipped if the
+// global "--yes" or "--force" flag is given and CLI.YesFlag is set.
+type CommandDestructive interface {
+	// DestructiveConfirm returns the prompt to confirm running the command,
+	// such as "Really delete all data?". An empty prompt skips the
+	// confirmation.
+	DestructiveConfirm() string
+}
+
+// CommandDeprecatedSince is an extension of Command for commands that are
+// deprecated and scheduled for removal.
+//
+// When the command is run, the CLI writes a warning such as "deprecated
+// since 1.2; will be removed in 2.0." to its ErrorWriter before running
+// it. If the CLI's Version is at or past the removal version, the command
+// is refused with exit code 3 instead.
+type CommandDeprecatedSince interface {
+	// DeprecatedSince returns the version the command was deprecated in
+	// and the version it will be removed in. Either may be empty.
+	DeprecatedSince() (since, removeIn string)
+}
+
+// CommandDeprecated is an extension of Command for commands that are
+// deprecated, for example because they were renamed.
+//
+// When the command is run, the CLI writes the deprecation message to its
+// ErrorWriter and then runs the command as usual. The help listings show
+// "(deprecated)" after the synopsis of the command.
+type CommandDeprecated interface {
+	// DeprecationMessage returns the message to warn with, such as
+	// "'old' is deprecated, use 'new' instead.". An empty message only
+	// marks the command as deprecated in the help.
+	DeprecationMessage() string
+}
+
+// CommandRequiresEnv is an extension of Command for commands that need
+// environment variables to be set. Before running the command, the CLI
+// writes an error to its ErrorWriter for each of them that is unset and
+// returns 2 without running it. Variables that are set to an empty value
+// count as set.
+type CommandRequiresEnv interface {
+	// RequiredEnv returns the names of the required environment
+	// variables.
+	RequiredEnv() []string
+}
+
+// CommandContext is an extension of Command for commands that can be
+// cancelled. If a command implements it, CLI.RunContext calls RunContext
+// with its context instead of Run.
+type CommandContext interface {
+	Command
+
+	// RunContext is like Run, but should stop early and return a non-zero
+	// exit status once ctx is done.
+	RunContext(ctx context.Context, args []string) int
+}
+
+// CommandWithError is an extension of Command for commands that report
+// errors to the CLI instead of handling them themselves. If a command
+// implements it, CLI.Run calls RunE instead of Run. A non-nil error is
+// written to the CLI's ErrorWriter and returned from CLI.Run along with
+// the exit status.
+type CommandWithError interface {
+	Command
+
+	// RunE is like Run but also returns an error.
+	RunE(args []string) (int, error)
+}
+
+// CommandWithFlags is an extension of Command for commands that parse
+// flags with the flag package. If a command implements it, the CLI parses
+// the arguments of the command with the FlagSet returned by Flags and
+// passes only the remaining positional arguments to Run. If the flags
+// can't be parsed, the CLI prints the error and the help of the command
+// and returns 1 without running it.
+//
+// The FlagSet should use flag.ContinueOnError, otherwise a parse error
+// exits the process.
+type CommandWithFlags interface {
+	Command
+
+	// Flags returns the flags of the command.
+	Flags() *flag.FlagSet
+}
+
+// CommandStdin is an extension of Command for commands that read standard
+// input. The CLI calls SetStdin with its Stdin before running the command,
+// and the command must read from r instead of os.Stdin, which allows tests
+// to inject input. See also ResolveStdinArg.
+type CommandStdin interface {
+	Command
+
+	// SetStdin sets the reader that the command reads its input from.
+	SetStdin(r io.Reader)
+}
+
+// CommandStdout is an extension of Command for commands whose standard
+// output can be redirected. The CLI calls SetStdout before running the
+// command when the global "--output-file" flag is given, and the command
+// must then write its regular output to w. Errors and prompts should still
+// go to the console.
+type CommandStdout interface {
+	Command
+
+	// SetStdout sets the writer that the command writes its output to.
+	SetStdout(w io.Writer)
+}
+
+// CommandBuiltin is an extension of Command for commands that are part of
+// the plumbing of the application rather than its features, such as help,
+// version or completion commands. BasicHelpFunc dims the names of built-in
+// commands to reduce clutter. The built-in commands of this package, such
+// as the one enabled with CLI.DiagnosticsCommand, implement it.
+type CommandBuiltin interface {
+	// Builtin returns true if the command is a built-in command.
+	Builtin() bool
+}
+
+// CommandWithCategory is an extension of Command for commands that are
+// listed under a category, such as "Database", in the root help of
+// BasicHelpFunc. Commands without a category are listed under "General".
+type CommandWithCategory interface {
+	// Category returns the category of the command. An empty category is
+	// the same as not implementing CommandWithCategory.
+	Category() string
+}
+
+// CommandCompletion is an extension of Command that contributes custom
+// fragments to generated shell completion scripts, for example to complete
+// file paths with a specific extension.
+//
+// If CommandCompletion isn't implemented, only the default completions are
+// generated for the command.
+type CommandCompletion interface {
+	// CompletionScript returns the snippet to splice into the completion
+	// script for the given shell ("bash", "zsh" or "fish") when completing
+	// arguments for this command. An empty string adds nothing.
+	//
+	// For bash and zsh the snippet runs in the case branch of the command,
+	// after the default candidates are set. For fish it is added as is
+	// after the generated lines and should be complete commands. See
+	// BashCompletion, ZshCompletion and FishCompletion.
+	CompletionScript(shell string) string
+}
+
+// CommandAutocomplete is an extension of Command for commands whose
+// arguments or flags can be completed with values that are only known at
+// run time, such as the names of the environments to deploy to.
+//
+// The hooks are called by the hidden "__complete" command that the CLI
+// registers if Autocomplete is set, which the generated completion
+// scripts call back into.
+type CommandAutocomplete interface {
+	// AutocompleteArgs returns the candidates for the arguments of the
+	// command.
+	AutocompleteArgs() []string
+
+	// AutocompleteFlags returns the candidates for the flags of the
+	// command, mapped to their description. The keys are the flags as
+	// they are typed, such as "-env".
+	AutocompleteFlags() map[string]string
+}
+
+// CommandAutocompleteFlagValues is an extension of CommandAutocomplete for
+// commands with flags that take one of a known set of values, such as a
+// "-format" flag taking "json" or "yaml".
+//
+// The values are completed after the flag, both in a separate word and
+// after an "=" as in "-format=j".
+type CommandAutocompleteFlagValues interface {
+	CommandAutocomplete
+
+	// AutocompleteFlagValues returns the values the flags take, keyed by
+	// the flags as they are typed, such as "-format".
+	AutocompleteFlagValues() map[string][]string
+}
+
+// CommandAutocompleteDescribed is an extension of CommandAutocomplete for
+// commands whose argument candidates have a description, shown by zsh
+// and fish next to them.
+type CommandAutocompleteDescribed interface {
+	CommandAutocomplete
+
+	// AutocompleteArgsDescribed returns the candidates for the arguments
+	// of the command with their description. It is called instead of
+	// AutocompleteArgs.
+	AutocompleteArgsDescribed() []Completion
+}
+
+// CommandAutocompleteDirective is an extension of CommandAutocomplete for
+// commands that change how the shell completes their arguments, for
+// example to keep it from adding a space after a candidate or from
+// completing files.
+type CommandAutocompleteDirective interface {
+	CommandAutocomplete
+
+	// AutocompleteDirective returns the directive for completing the
+	// arguments of the command. See CompletionDirective.
+	AutocompleteDirective() CompletionDirective
+}
+
 // CommandFactory is a type of function that is a factory for commands.
 // We need a factory because we may need to setup some state on the
 // struct that implements the command itself.
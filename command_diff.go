@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+)
+
+// DiffCommands compares the commands of two CLIs, for example the previous
+// and the current release, so that upgrade tooling can generate changelog
+// entries. It returns the commands only next has (added), the commands
+// only prev has (removed) and the commands both have but with a different
+// synopsis (changed). Each list is sorted by name.
+//
+// Names are trimmed like the CLI does when it builds its command tree, so
+// " foo" and "foo" are the same command. Hidden commands are compared as
+// well. A command whose factory fails is treated as having an empty
+// synopsis.
+func DiffCommands(prev, next *CLI) (added, removed, changed []string) {
+	prevCommands := trimmedCommands(prev)
+	nextCommands := trimmedCommands(next)
+
+	for k, f := range nextCommands {
+		prevF, ok := prevCommands[k]
+		if !ok {
+			added = append(added, k)
+			continue
+		}
+
+		if commandSynopsis(prevF) != commandSynopsis(f) {
+			changed = append(changed, k)
+		}
+	}
+
+	for k := range prevCommands {
+		if _, ok := nextCommands[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// trimmedCommands returns the commands of c keyed by their trimmed name.
+func trimmedCommands(c *CLI) map[string]CommandFactory {
+	result := make(map[string]CommandFactory, len(c.Commands))
+	for k, f := range c.Commands {
+		result[strings.TrimSpace(k)] = f
+	}
+
+	return result
+}
+
+// commandSynopsis instantiates the command from f and returns its synopsis.
+func commandSynopsis(f CommandFactory) string {
+	if f == nil {
+		return ""
+	}
+
+	command, err := f()
+	if err != nil || command == nil {
+		return ""
+	}
+
+	return command.Synopsis()
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDiffCommands(t *testing.T) {
+	synopsis := func(s string) CommandFactory {
+		return func() (Command, error) {
+			return &MockCommand{SynopsisText: s}, nil
+		}
+	}
+
+	prev := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo":     synopsis("Foo"),
+			"foo bar": synopsis("Bar"),
+			"zip":     synopsis("Zip"),
+			"broken": func() (Command, error) {
+				return nil, errors.New("broken")
+			},
+		},
+	}
+	next := &CLI{
+		Commands: map[string]CommandFactory{
+			" foo ":   synopsis("Foo"),
+			"foo bar": synopsis("Bar, but better"),
+			"zap":     synopsis("Zap"),
+			"broken": func() (Command, error) {
+				return nil, errors.New("still broken")
+			},
+		},
+	}
+
+	added, removed, changed := DiffCommands(prev, next)
+	if !reflect.DeepEqual(added, []string{"zap"}) {
+		t.Fatalf("bad added: %#v", added)
+	}
+	if !reflect.DeepEqual(removed, []string{"zip"}) {
+		t.Fatalf("bad removed: %#v", removed)
+	}
+	if !reflect.DeepEqual(changed, []string{"foo bar"}) {
+		t.Fatalf("bad changed: %#v", changed)
+	}
+}
+
+func TestDiffCommands_same(t *testing.T) {
+	c := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Foo"}, nil
+			},
+		},
+	}
+
+	added, removed, changed := DiffCommands(c, c)
+	if added != nil || removed != nil || changed != nil {
+		t.Fatalf("bad: %#v %#v %#v", added, removed, changed)
+	}
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CommandInfo describes a registered command, as returned by CommandList.
+type CommandInfo struct {
+	// Name is the full name of the command, such as "foo bar".
+	Name string
+
+	// Synopsis and Help are the synopsis and help text of the command.
+	Synopsis string
+	Help     string
+
+	// Hidden is true if the command is listed in HiddenCommands.
+	Hidden bool
+
+	// AutoParent is true if the command wasn't registered but was created
+	// automatically as the parent of nested commands.
+	AutoParent bool
+}
+
+// CommandList returns every command of the CLI sorted by name, including
+// hidden commands, automatically created parents and enabled built-in
+// commands, for example to generate external documentation. Each factory
+// is called once to get the synopsis, and the first error of a factory is
+// returned. No command is run.
+//
+// See CommandsJSON for the same list in JSON.
+func (c *CLI) CommandList() ([]CommandInfo, error) {
+	c.once.Do(c.init)
+
+	var result []CommandInfo
+	var err error
+	c.commandTree.Walk(func(k string, raw interface{}) bool {
+		command, ferr := raw.(CommandFactory)()
+		if ferr != nil {
+			err = fmt.Errorf("error instantiating %q: %s", k, ferr)
+			return true
+		}
+
+		_, hidden := c.commandHidden[k]
+		_, parent := c.commandParents[k]
+		result = append(result, CommandInfo{
+			Name:       k,
+			Synopsis:   command.Synopsis(),
+			Help:       command.Help(),
+			Hidden:     hidden,
+			AutoParent: parent,
+		})
+
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// commandJSON is a command in the output of CommandsJSON.
+type commandJSON struct {
+	Name     string `json:"name"`
+	Synopsis string `json:"synopsis"`
+	Help     string `json:"help"`
+	Hidden   bool   `json:"hidden"`
+	Nested   bool   `json:"nested"`
+	Parent   string `json:"parent,omitempty"`
+}
+
+// CommandsJSON returns every command of the CLI as a JSON array of objects
+// with the name, synopsis, help and whether the command is hidden or
+// nested, for tools such as a command palette. Nested commands also have
+// the name of their parent. Hidden commands are included so the tool can
+// decide whether to show them. See CommandList.
+func (c *CLI) CommandsJSON() ([]byte, error) {
+	infos, err := c.CommandList()
+	if err != nil {
+		return nil, err
+	}
+
+	commands := make([]commandJSON, 0, len(infos))
+	for _, info := range infos {
+		command := commandJSON{
+			Name:     info.Name,
+			Synopsis: info.Synopsis,
+			Help:     info.Help,
+			Hidden:   info.Hidden,
+		}
+		if idx := strings.LastIndex(info.Name, " "); idx != -1 {
+			command.Nested = true
+			command.Parent = info.Name[:idx]
+		}
+
+		commands = append(commands, command)
+	}
+
+	return json.Marshal(commands)
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCLICommandList(t *testing.T) {
+	synopsis := func(s string) CommandFactory {
+		return func() (Command, error) {
+			return &MockCommand{SynopsisText: s}, nil
+		}
+	}
+
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo":        synopsis("Foo"),
+			"foo bar":    synopsis("Bar"),
+			"foo hidden": synopsis("Hidden"),
+			"zip zap":    synopsis("Zap"),
+		},
+		HiddenCommands: []string{"foo hidden"},
+	}
+
+	result, err := cli.CommandList()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []CommandInfo{
+		{Name: "foo", Synopsis: "Foo"},
+		{Name: "foo bar", Synopsis: "Bar"},
+		{Name: "foo hidden", Synopsis: "Hidden", Hidden: true},
+		{
+			Name:       "zip",
+			Help:       "This command is accessed by using one of the subcommands below.",
+			AutoParent: true,
+		},
+		{Name: "zip zap", Synopsis: "Zap"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestCLICommandList_factoryError(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return nil, errors.New("broken")
+			},
+		},
+	}
+
+	if _, err := cli.CommandList(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestCLICommandsJSON(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Foo", HelpText: "Usage: foo"}, nil
+			},
+			"foo bar": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Bar"}, nil
+			},
+		},
+		HiddenCommands: []string{"foo bar"},
+	}
+
+	result, err := cli.CommandsJSON()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := `[{"name":"foo","synopsis":"Foo","help":"Usage: foo","hidden":false,"nested":false},` +
+		`{"name":"foo bar","synopsis":"Bar","help":"","hidden":true,"nested":true,"parent":"foo"}]`
+	if string(result) != expected {
+		t.Fatalf("bad: %s", result)
+	}
+}
+
+func TestCLICommandsJSON_empty(t *testing.T) {
+	result, err := new(CLI).CommandsJSON()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if string(result) != "[]" {
+		t.Fatalf("bad: %s", result)
+	}
+}
@@ -1,5 +1,11 @@
 package cli
 
+import (
+	"context"
+	"flag"
+	"io"
+)
+
 // MockCommand is an implementation of Command that can be used for tests.
 // It is publicly exported from this package in case you want to use it
 // externally.
@@ -40,3 +46,224 @@ type MockCommandHelpTemplate struct {
 func (c *MockCommandHelpTemplate) HelpTemplate() string {
 	return c.HelpTemplateText
 }
+
+// MockCommandCompletion is an implementation of CommandCompletion.
+type MockCommandCompletion struct {
+	MockCommand
+
+	// Settable
+	CompletionScripts map[string]string
+}
+
+func (c *MockCommandCompletion) CompletionScript(shell string) string {
+	return c.CompletionScripts[shell]
+}
+
+// MockCommandAutocomplete is an implementation of CommandAutocomplete.
+type MockCommandAutocomplete struct {
+	MockCommand
+
+	// Settable
+	Args  []string
+	Flags map[string]string
+}
+
+func (c *MockCommandAutocomplete) AutocompleteArgs() []string {
+	return c.Args
+}
+
+func (c *MockCommandAutocomplete) AutocompleteFlags() map[string]string {
+	return c.Flags
+}
+
+// MockCommandAutocompleteFlagValues is an implementation of
+// CommandAutocompleteFlagValues.
+type MockCommandAutocompleteFlagValues struct {
+	MockCommandAutocomplete
+
+	// Settable
+	FlagValues map[string][]string
+}
+
+func (c *MockCommandAutocompleteFlagValues) AutocompleteFlagValues() map[string][]string {
+	return c.FlagValues
+}
+
+// MockCommandAutocompleteDescribed is an implementation of
+// CommandAutocompleteDescribed.
+type MockCommandAutocompleteDescribed struct {
+	MockCommandAutocomplete
+
+	// Settable
+	Described []Completion
+}
+
+func (c *MockCommandAutocompleteDescribed) AutocompleteArgsDescribed() []Completion {
+	return c.Described
+}
+
+// MockCommandAutocompleteDirective is an implementation of
+// CommandAutocompleteDirective.
+type MockCommandAutocompleteDirective struct {
+	MockCommandAutocomplete
+
+	// Settable
+	Directive CompletionDirective
+}
+
+func (c *MockCommandAutocompleteDirective) AutocompleteDirective() CompletionDirective {
+	return c.Directive
+}
+
+// MockCommandDestructive is an implementation of CommandDestructive.
+type MockCommandDestructive struct {
+	MockCommand
+
+	// Settable
+	DestructiveConfirmText string
+}
+
+func (c *MockCommandDestructive) DestructiveConfirm() string {
+	return c.DestructiveConfirmText
+}
+
+// MockCommandDeprecatedSince is an implementation of CommandDeprecatedSince.
+type MockCommandDeprecatedSince struct {
+	MockCommand
+
+	// Settable
+	Since    string
+	RemoveIn string
+}
+
+func (c *MockCommandDeprecatedSince) DeprecatedSince() (string, string) {
+	return c.Since, c.RemoveIn
+}
+
+// MockCommandDeprecated is an implementation of CommandDeprecated.
+type MockCommandDeprecated struct {
+	MockCommand
+
+	// Settable
+	DeprecationMessageText string
+}
+
+func (c *MockCommandDeprecated) DeprecationMessage() string {
+	return c.DeprecationMessageText
+}
+
+// MockCommandRequiresEnv is an implementation of CommandRequiresEnv.
+type MockCommandRequiresEnv struct {
+	MockCommand
+
+	// Settable
+	Env []string
+}
+
+func (c *MockCommandRequiresEnv) RequiredEnv() []string {
+	return c.Env
+}
+
+// MockCommandStdout is an implementation of CommandStdout.
+type MockCommandStdout struct {
+	MockCommand
+
+	// Settable
+	OutputText string
+
+	// Set by the CLI
+	Stdout io.Writer
+}
+
+func (c *MockCommandStdout) Run(args []string) int {
+	if c.Stdout != nil {
+		io.WriteString(c.Stdout, c.OutputText)
+	}
+
+	return c.MockCommand.Run(args)
+}
+
+func (c *MockCommandStdout) SetStdout(w io.Writer) {
+	c.Stdout = w
+}
+
+// MockCommandContext is an implementation of CommandContext.
+type MockCommandContext struct {
+	MockCommand
+
+	// Set by the command
+	RunContextCalled bool
+	RunContextCtx    context.Context
+}
+
+func (c *MockCommandContext) RunContext(ctx context.Context, args []string) int {
+	c.RunContextCalled = true
+	c.RunContextCtx = ctx
+
+	return c.MockCommand.Run(args)
+}
+
+// MockCommandWithError is an implementation of CommandWithError.
+type MockCommandWithError struct {
+	MockCommand
+
+	// Settable
+	RunError error
+
+	// Set by the command
+	RunECalled bool
+}
+
+func (c *MockCommandWithError) RunE(args []string) (int, error) {
+	c.RunECalled = true
+
+	return c.MockCommand.Run(args), c.RunError
+}
+
+// MockCommandStdin is an implementation of CommandStdin.
+type MockCommandStdin struct {
+	MockCommand
+
+	// Set by the CLI
+	Stdin io.Reader
+}
+
+func (c *MockCommandStdin) SetStdin(r io.Reader) {
+	c.Stdin = r
+}
+
+// MockCommandBuiltin is an implementation of CommandBuiltin.
+type MockCommandBuiltin struct {
+	MockCommand
+
+	// Settable
+	BuiltinResult bool
+}
+
+func (c *MockCommandBuiltin) Builtin() bool {
+	return c.BuiltinResult
+}
+
+// MockCommandWithFlags is an implementation of CommandWithFlags.
+type MockCommandWithFlags struct {
+	MockCommand
+
+	// Settable
+	FlagSet *flag.FlagSet
+}
+
+func (c *MockCommandWithFlags) Flags() *flag.FlagSet {
+	return c.FlagSet
+}
+
+// MockCommandWithCategory is an implementation of CommandWithCategory.
+type MockCommandWithCategory struct {
+	MockCommand
+
+	// Settable
+	CategoryText string
+}
+
+func (c *MockCommandWithCategory) Category() string {
+	return c.CategoryText
+}
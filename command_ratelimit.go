@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// RunResultRateLimited is the exit code returned by a RateLimitedCommand
+// when it is invoked more often than its limit allows. It is the same as
+// EX_TEMPFAIL from sysexits.h.
+const RunResultRateLimited = 75
+
+// RateLimitedCommand is a Command that wraps another command and limits how
+// often it can be run, for example when commands are invoked repeatedly
+// from a REPL or another host loop.
+//
+// The limit is a token bucket: up to Burst runs are allowed at once, and
+// one more run is allowed every Every interval. When the limit is exceeded
+// a message is written to ErrorWriter and RunResultRateLimited is returned
+// without running the command. Every and Burst must be positive, or Run
+// panics.
+//
+// Only the methods of Command are passed on to the wrapped command. The
+// optional interfaces it implements, such as CommandFlags or
+// CommandAutocomplete, are not seen through a RateLimitedCommand.
+type RateLimitedCommand struct {
+	Command Command
+	Every   time.Duration
+	Burst   int
+
+	// ErrorWriter is where the rate limited message is written. Defaults
+	// to os.Stderr.
+	ErrorWriter io.Writer
+
+	l      sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// RateLimited returns a RateLimitedCommand that allows burst runs of cmd
+// at once and one more run every interval. It panics if every or burst
+// isn't positive.
+func RateLimited(cmd Command, every time.Duration, burst int) *RateLimitedCommand {
+	c := &RateLimitedCommand{
+		Command: cmd,
+		Every:   every,
+		Burst:   burst,
+	}
+	c.validate()
+
+	return c
+}
+
+func (c *RateLimitedCommand) Help() string {
+	return c.Command.Help()
+}
+
+func (c *RateLimitedCommand) Run(args []string) int {
+	if !c.allow() {
+		w := c.ErrorWriter
+		if w == nil {
+			w = os.Stderr
+		}
+
+		fmt.Fprintln(w, "rate limited, try again later")
+		return RunResultRateLimited
+	}
+
+	return c.Command.Run(args)
+}
+
+func (c *RateLimitedCommand) Synopsis() string {
+	return c.Command.Synopsis()
+}
+
+// allow takes a token from the bucket if one is available.
+func (c *RateLimitedCommand) allow() bool {
+	c.validate()
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
+
+	if c.last.IsZero() {
+		c.tokens = float64(c.Burst)
+	} else {
+		c.tokens += float64(now.Sub(c.last)) / float64(c.Every)
+		if c.tokens > float64(c.Burst) {
+			c.tokens = float64(c.Burst)
+		}
+	}
+	c.last = now
+
+	if c.tokens < 1 {
+		return false
+	}
+
+	c.tokens--
+	return true
+}
+
+// validate panics if the limit would never allow a run or never refill.
+func (c *RateLimitedCommand) validate() {
+	if c.Every <= 0 {
+		panic(fmt.Sprintf("cli: RateLimitedCommand interval must be positive, got %s", c.Every))
+	}
+	if c.Burst <= 0 {
+		panic(fmt.Sprintf("cli: RateLimitedCommand burst must be positive, got %d", c.Burst))
+	}
+}
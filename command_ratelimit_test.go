@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedCommand_implements(t *testing.T) {
+	var _ Command = new(RateLimitedCommand)
+}
+
+func TestRateLimitedCommand(t *testing.T) {
+	now := time.Now()
+	buf := new(bytes.Buffer)
+	command := &MockCommand{RunResult: 42}
+
+	c := RateLimited(command, time.Second, 2)
+	c.ErrorWriter = buf
+	c.now = func() time.Time { return now }
+
+	// Burst of two is allowed, the third is throttled
+	for i, expected := range []int{42, 42, RunResultRateLimited} {
+		if code := c.Run(nil); code != expected {
+			t.Fatalf("run %d: bad code: %d", i, code)
+		}
+	}
+	if buf.String() != "rate limited, try again later\n" {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+
+	// Half an interval later still nothing is available
+	now = now.Add(500 * time.Millisecond)
+	if code := c.Run(nil); code != RunResultRateLimited {
+		t.Fatalf("bad code: %d", code)
+	}
+
+	// A full interval refills a single token
+	now = now.Add(500 * time.Millisecond)
+	for i, expected := range []int{42, RunResultRateLimited} {
+		if code := c.Run(nil); code != expected {
+			t.Fatalf("run %d: bad code: %d", i, code)
+		}
+	}
+
+	// Waiting long refills only up to the burst
+	now = now.Add(time.Minute)
+	for i, expected := range []int{42, 42, RunResultRateLimited} {
+		if code := c.Run(nil); code != expected {
+			t.Fatalf("run %d: bad code: %d", i, code)
+		}
+	}
+}
+
+func TestRateLimitedCommand_invalid(t *testing.T) {
+	testCases := []struct {
+		every time.Duration
+		burst int
+	}{
+		{0, 1},
+		{-time.Second, 1},
+		{time.Second, 0},
+	}
+
+	for _, tc := range testCases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected panic for %s/%d", tc.every, tc.burst)
+				}
+			}()
+
+			RateLimited(new(MockCommand), tc.every, tc.burst)
+		}()
+	}
+
+	// Set directly, the limit is checked when the command is run
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+
+	c := &RateLimitedCommand{Command: new(MockCommand), Burst: 1}
+	c.Run(nil)
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CommandSpec lists help-only commands to register with AddCommandSpec,
+// for example to build the documentation of a CLI from metadata kept in
+// the repository. It can be decoded from any format, such as JSON or YAML,
+// since the keys are the lowercase field names.
+type CommandSpec struct {
+	Commands []CommandSpecEntry
+}
+
+// CommandSpecEntry is a command in a CommandSpec.
+type CommandSpecEntry struct {
+	// Name is the full name of the command, such as "foo bar".
+	Name string
+
+	// Synopsis and Help are returned by the Synopsis and Help methods of
+	// the command.
+	Synopsis string
+	Help     string
+
+	// Hidden adds the command to HiddenCommands.
+	Hidden bool
+}
+
+// AddCommandSpec registers the commands listed in spec. Running one of
+// them prints its help. The real implementation can be attached afterwards
+// by replacing the factory of its name in Commands. Commands that are
+// already registered are kept as they are.
+//
+// Like AddCommand, AddCommandSpec panics if it is called once the CLI has
+// been initialized. A spec with an entry without a name or a name listed
+// more than once returns an error and registers nothing.
+func (c *CLI) AddCommandSpec(spec *CommandSpec) error {
+	if c.initialized {
+		panic("cli: AddCommandSpec called after the CLI was initialized")
+	}
+
+	seen := make(map[string]struct{}, len(spec.Commands))
+	for i, s := range spec.Commands {
+		name := strings.Join(strings.Fields(s.Name), " ")
+		if name == "" {
+			return fmt.Errorf("command spec entry %d has no name", i+1)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("command spec lists %q more than once", name)
+		}
+		seen[name] = struct{}{}
+	}
+
+	if c.Commands == nil {
+		c.Commands = make(map[string]CommandFactory)
+	}
+	for _, s := range spec.Commands {
+		name := strings.Join(strings.Fields(s.Name), " ")
+		if _, ok := c.Commands[name]; ok {
+			continue
+		}
+
+		help, synopsis := strings.TrimRight(s.Help, "\n"), s.Synopsis
+		c.Commands[name] = func() (Command, error) {
+			return &MockCommand{
+				HelpText:     help,
+				SynopsisText: synopsis,
+				RunResult:    RunResultHelp,
+			}, nil
+		}
+		if s.Hidden {
+			c.HiddenCommands = append(c.HiddenCommands, name)
+		}
+	}
+
+	return nil
+}
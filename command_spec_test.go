@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testCommandSpec() *CommandSpec {
+	return &CommandSpec{
+		Commands: []CommandSpecEntry{
+			{
+				Name:     "deploy",
+				Synopsis: "Deploys the application",
+				Help:     "Usage: app deploy [options]\n\n  Deploys the application.\n",
+			},
+			{Name: "deploy rollback", Synopsis: "Rolls back a deployment"},
+			{Name: "debug", Synopsis: "Internal debugging", Hidden: true},
+		},
+	}
+}
+
+func TestCLIAddCommandSpec(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args:       []string{"--help"},
+		HelpWriter: buf,
+	}
+
+	if err := cli.AddCommandSpec(testCommandSpec()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := "Available commands are:\n" +
+		"    deploy    Deploys the application\n"
+	if !strings.HasSuffix(buf.String(), expected+"\n") {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+}
+
+func TestCLIAddCommandSpec_helpOnly(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args:              []string{"deploy"},
+		CommandHelpWriter: buf,
+	}
+
+	if err := cli.AddCommandSpec(testCommandSpec()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if !strings.HasPrefix(buf.String(), "Usage: app deploy [options]\n\n  Deploys the application.\n") {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+}
+
+func TestCLIAddCommandSpec_keepsRegistered(t *testing.T) {
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"deploy"},
+		Commands: map[string]CommandFactory{
+			"deploy": func() (Command, error) {
+				return command, nil
+			},
+		},
+	}
+
+	if err := cli.AddCommandSpec(testCommandSpec()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !command.RunCalled {
+		t.Fatal("registered command should run")
+	}
+}
+
+func TestCLIAddCommandSpec_invalid(t *testing.T) {
+	testCases := [][]CommandSpecEntry{
+		{{Synopsis: "No name"}},
+		{{Name: "foo"}, {Name: " foo "}},
+	}
+
+	for _, tc := range testCases {
+		cli := new(CLI)
+		if err := cli.AddCommandSpec(&CommandSpec{Commands: tc}); err == nil {
+			t.Fatalf("expected error for %#v", tc)
+		}
+		if len(cli.Commands) != 0 {
+			t.Fatalf("bad: %#v", cli.Commands)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// commandsMatchColor is the color of the matches of the --grep term in the
+// output of the built-in commands command.
+var commandsMatchColor = NewColor(ColorFgYellow, ColorBold)
+
+// newCommandsCommand is the factory of the built-in command enabled with
+// CLI.CommandsCommand.
+func (c *CLI) newCommandsCommand() (Command, error) {
+	return &commandsCommand{cli: c}, nil
+}
+
+// commandsCommand lists all commands of the CLI, optionally only those
+// matching a term. See CLI.CommandsCommand.
+type commandsCommand struct {
+	cli *CLI
+}
+
+func (l *commandsCommand) Help() string {
+	return strings.TrimSpace(fmt.Sprintf(`
+Usage: %s [--grep=term]
+
+  Lists all commands, including nested ones, with their synopsis.
+
+Options:
+
+  --grep=term    Only list the commands whose name or synopsis contains
+                 term, ignoring case, and highlight the matches.
+`, strings.TrimSpace(l.cli.Name+" "+l.cli.CommandsCommand)))
+}
+
+func (l *commandsCommand) Run(args []string) int {
+	flags := flag.NewFlagSet(l.cli.CommandsCommand, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	grep := flags.String("grep", "", "")
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return RunResultHelp
+		}
+
+		l.cli.Ui.Error(fmt.Sprintf("Error: %s", err))
+		return RunResultUsage
+	}
+
+	listing, err := l.cli.commandsListing(*grep)
+	if err != nil {
+		l.cli.Ui.Error(fmt.Sprintf("Error: %s", err))
+		return 1
+	}
+	if listing == "" {
+		l.cli.Ui.Error(fmt.Sprintf("No commands match %q.", *grep))
+		return 1
+	}
+
+	l.cli.Ui.Output(strings.TrimSuffix(listing, "\n"))
+	return 0
+}
+
+func (l *commandsCommand) Builtin() bool {
+	return true
+}
+
+func (l *commandsCommand) Synopsis() string {
+	return "Lists all commands"
+}
+
+// commandsListing returns the aligned list of all commands that aren't
+// hidden with their synopsis, one per line. If filter isn't empty, only
+// the commands whose name or synopsis contains it, ignoring case, are
+// listed, with the matches highlighted.
+func (c *CLI) commandsListing(filter string) (string, error) {
+	infos, err := c.CommandList()
+	if err != nil {
+		return "", err
+	}
+
+	var matches []CommandInfo
+	longest := 0
+	for _, info := range infos {
+		if info.Name == "" || info.Hidden || info.AutoParent {
+			continue
+		}
+		if !commandMatches(info, filter) {
+			continue
+		}
+
+		matches = append(matches, info)
+		if w := VisibleWidth(info.Name); w > longest {
+			longest = w
+		}
+	}
+
+	match := commandsMatchColor.forced(c.ForceColor)
+	opts := HighlightOptions{IgnoreCase: true}
+	var b strings.Builder
+	for _, info := range matches {
+		name := HighlightMatchesOpts(info.Name, filter, match, opts)
+		synopsis := HighlightMatchesOpts(info.Synopsis, filter, match, opts)
+		fmt.Fprintf(&b, "    %s%s    %s\n",
+			name, strings.Repeat(" ", longest-VisibleWidth(info.Name)), synopsis)
+	}
+
+	return b.String(), nil
+}
+
+// commandMatches returns true if the name or synopsis of the command
+// contains filter, ignoring case. Every command matches an empty filter.
+func commandMatches(info CommandInfo, filter string) bool {
+	filter = strings.ToLower(filter)
+	return strings.Contains(strings.ToLower(info.Name), filter) ||
+		strings.Contains(strings.ToLower(info.Synopsis), filter)
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testCommandsCLI(args ...string) (*CLI, *MockUi) {
+	factory := func(synopsis string) CommandFactory {
+		return func() (Command, error) {
+			return &MockCommand{SynopsisText: synopsis}, nil
+		}
+	}
+
+	ui := NewMockUi()
+	return &CLI{
+		Name: "app",
+		Args: append([]string{"commands"}, args...),
+		Commands: map[string]CommandFactory{
+			"net up":   factory("Brings the Network up"),
+			"net down": factory("Takes it down"),
+			"ping":     factory("Checks the network"),
+			"build":    factory("Builds the app"),
+			"internal": factory("Network internals"),
+		},
+		HiddenCommands:  []string{"internal"},
+		CommandsCommand: "commands",
+		Ui:              ui,
+	}, ui
+}
+
+func TestCLIRun_commands(t *testing.T) {
+	cli, ui := testCommandsCLI()
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	expected := "    build       Builds the app\n" +
+		"    commands    Lists all commands\n" +
+		"    net down    Takes it down\n" +
+		"    net up      Brings the Network up\n" +
+		"    ping        Checks the network\n"
+	if ui.OutputWriter.String() != expected {
+		t.Fatalf("bad:\n%s", ui.OutputWriter.String())
+	}
+}
+
+func TestCLIRun_commandsGrep(t *testing.T) {
+	withColor(t)
+
+	cli, ui := testCommandsCLI("--grep", "net")
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	match := func(s string) string {
+		return NewColor(ColorFgYellow, ColorBold).Sprint(s)
+	}
+	expected := "    " + match("net") + " down    Takes it down\n" +
+		"    " + match("net") + " up      Brings the " + match("Net") + "work up\n" +
+		"    ping        Checks the " + match("net") + "work\n"
+	if ui.OutputWriter.String() != expected {
+		t.Fatalf("bad: %#v", ui.OutputWriter.String())
+	}
+}
+
+func TestCLIRun_commandsGrepNoMatch(t *testing.T) {
+	cli, ui := testCommandsCLI("--grep=nope")
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if ui.ErrorWriter.String() != "No commands match \"nope\".\n" {
+		t.Fatalf("bad: %#v", ui.ErrorWriter.String())
+	}
+}
+
+func TestCLIRun_helpFilter(t *testing.T) {
+	withColor(t)
+
+	buf := new(bytes.Buffer)
+	cli, _ := testCommandsCLI()
+	cli.Args = []string{"--help", "work"}
+	cli.HelpWriter = buf
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	match := NewColor(ColorFgYellow, ColorBold).Sprint("work")
+	expected := "Commands matching \"work\":\n\n" +
+		"    net up    Brings the Net" + match + " up\n" +
+		"    ping      Checks the net" + match + "\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIRun_helpFilterNoMatch(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli, _ := testCommandsCLI()
+	cli.Args = []string{"--help", "nope"}
+	cli.HelpWriter = new(bytes.Buffer)
+	cli.ErrorWriter = buf
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 127 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if !strings.Contains(buf.String(), "Available commands are:") {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,706 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BashCompletion returns a bash completion script for the CLI, to be
+// sourced by the shell, for example from the output of a "completion bash"
+// command. The script completes the commands at the root along with
+// --help and --version, and the subcommands of nested commands based on
+// the words before the cursor. Hidden commands are not completed. After a
+// "--" argument only files are completed.
+//
+// The "bash" snippet of commands that implement CommandCompletion is run
+// when completing the arguments of the command, after the words to
+// complete have been set in the variable candidates, which the snippet
+// can add to.
+//
+// The completion function and the completed command are named after Name,
+// so it must be set. An error is returned if a factory fails.
+func (c *CLI) BashCompletion() (string, error) {
+	c.once.Do(c.init)
+
+	name := strings.TrimSpace(c.Name)
+	if name == "" {
+		return "", errors.New("the CLI must have a Name to generate completions")
+	}
+
+	fn := "_" + bashIdentifier(name) + "_completions"
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# bash completion for %s\n", name)
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	b.WriteString(`    local cur="${COMP_WORDS[COMP_CWORD]}"
+`)
+	if c.Autocomplete {
+		// The value after "-flag=" is a word of its own after the "="
+		b.WriteString(`    [[ "$cur" == "=" ]] && cur=""
+`)
+	}
+	b.WriteString(`    local path=""
+    local i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            --)
+                COMPREPLY=($(compgen -f -- "$cur"))
+                return
+                ;;
+            -*) ;;
+            *) path="${path:+$path }${COMP_WORDS[i]}" ;;
+        esac
+    done
+
+    local candidates=""
+    case "$path" in
+`)
+
+	snippets, err := c.completionSnippets("bash")
+	if err != nil {
+		return "", err
+	}
+
+	levels, _ := c.completionLevels("", false)
+	isLevel := make(map[string]bool, len(levels))
+	for _, l := range levels {
+		isLevel[l.prefix] = true
+
+		words := l.names
+		if l.prefix == "" {
+			words = append([]string{"--help", "--version"}, words...)
+		}
+
+		snippet, ok := snippets[l.prefix]
+		if !ok {
+			fmt.Fprintf(&b, "        %s) candidates=%s ;;\n",
+				bashQuote(l.prefix), bashQuote(strings.Join(words, " ")))
+			continue
+		}
+
+		fmt.Fprintf(&b, "        %s)\n", bashQuote(l.prefix))
+		fmt.Fprintf(&b, "            candidates=%s\n", bashQuote(strings.Join(words, " ")))
+		b.WriteString(indentSnippet(snippet, 12))
+		b.WriteString("            ;;\n")
+	}
+
+	// The arguments of commands with a snippet come after the levels, so
+	// that subcommands still match first
+	for _, k := range sortedKeys(snippets) {
+		pattern := bashQuote(k+" ") + "*"
+		if !isLevel[k] {
+			pattern = bashQuote(k) + "|" + pattern
+		}
+
+		fmt.Fprintf(&b, "        %s)\n", pattern)
+		b.WriteString(indentSnippet(snippets[k], 12))
+		b.WriteString("            ;;\n")
+	}
+
+	b.WriteString(`    esac
+`)
+	if c.Autocomplete {
+		b.WriteString("    local dynamic directive=0\n")
+		fmt.Fprintf(&b, "    dynamic=\"$(%s %s \"${COMP_WORDS[@]:1:COMP_CWORD}\" 2>/dev/null)\"\n",
+			bashQuote(name), autocompleteCommandName)
+		b.WriteString(`    if [[ "${dynamic##*$'\n'}" =~ ^:([0-9]+)$ ]]; then
+        directive="${BASH_REMATCH[1]}"
+        dynamic="${dynamic%:*}"
+    fi
+    dynamic="$(printf '%s\n' "$dynamic" | cut -f 1)"
+    if (( directive & 4 )); then
+        local ext
+        COMPREPLY=()
+        for ext in $dynamic; do
+            COMPREPLY+=($(compgen -f -X "!*.$ext" -- "$cur"))
+        done
+        return
+    fi
+    candidates="$candidates $dynamic"
+`)
+	}
+	b.WriteString(`
+    COMPREPLY=($(compgen -W "$candidates" -- "$cur"))
+`)
+	if c.Autocomplete {
+		b.WriteString(`    (( directive & 1 )) && compopt -o nospace
+    (( directive & 2 || ${#COMPREPLY[@]} )) || compopt -o default
+`)
+	}
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "complete -F %s %s\n", fn, bashQuote(name))
+
+	return b.String(), nil
+}
+
+// ZshCompletion returns a zsh completion script for the CLI, to be saved
+// as "_" followed by Name in a directory on the fpath. Like BashCompletion
+// it completes the commands at the root along with --help and --version,
+// and the subcommands of nested commands, showing the synopsis of each
+// command as its description. Hidden commands are not completed, and
+// after a "--" argument only files are.
+//
+// The "zsh" snippet of commands that implement CommandCompletion is run
+// when completing the arguments of the command, instead of completing
+// files. For commands with subcommands it runs after the subcommands have
+// been offered.
+//
+// Every command is instantiated to get its synopsis, so an error is
+// returned if a factory fails. Name must be set.
+func (c *CLI) ZshCompletion() (string, error) {
+	c.once.Do(c.init)
+
+	name := strings.TrimSpace(c.Name)
+	if name == "" {
+		return "", errors.New("the CLI must have a Name to generate completions")
+	}
+
+	levels, err := c.completionLevels("", true)
+	if err != nil {
+		return "", err
+	}
+
+	snippets, err := c.completionSnippets("zsh")
+	if err != nil {
+		return "", err
+	}
+
+	fn := "_" + bashIdentifier(name)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#compdef %s\n\n", name)
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	b.WriteString(`    local cmd=""
+    local word
+    for word in "${(@)words[2,CURRENT-1]}"; do
+        if [[ "$word" == "--" ]]; then
+            _files
+            return
+        fi
+        [[ "$word" == -* ]] || cmd="${cmd:+$cmd }$word"
+    done
+
+`)
+	if c.Autocomplete {
+		b.WriteString("    local -a dynamic\n")
+		b.WriteString("    local directive=0\n")
+		fmt.Fprintf(&b, "    dynamic=(${(f)\"$(%s %s \"${(@)words[2,CURRENT]}\" 2>/dev/null)\"})\n",
+			bashQuote(name), autocompleteCommandName)
+		b.WriteString(`    if [[ "${dynamic[-1]}" == :<-> ]]; then
+        directive="${dynamic[-1]#:}"
+        dynamic=("${(@)dynamic[1,-2]}")
+    fi
+    if (( directive & 4 )); then
+        _files -g "*.(${(j:|:)${(@)dynamic%%$'\t'*}})"
+        return
+    fi
+    if (( ${#dynamic} )); then
+        local -a described
+        local line
+        for line in "${(@)dynamic}"; do
+            if [[ "$line" == *$'\t'* ]]; then
+                described+=("${${line%%$'\t'*}//:/\\:}:${line#*$'\t'}")
+            else
+                described+=("${line//:/\\:}")
+            fi
+        done
+        if (( directive & 1 )); then
+            _describe 'value' described -S ''
+        else
+            _describe 'value' described
+        fi
+        return
+    fi
+
+`)
+	}
+	b.WriteString(`    local -a commands
+    case "$cmd" in
+`)
+
+	isLevel := make(map[string]bool, len(levels))
+	for _, l := range levels {
+		fmt.Fprintf(&b, "        %s)\n", bashQuote(l.prefix))
+		b.WriteString("            commands=(\n")
+		for i, n := range l.names {
+			entry := strings.Replace(n, ":", `\:`, -1)
+			if l.synopses[i] != "" {
+				entry += ":" + l.synopses[i]
+			}
+			fmt.Fprintf(&b, "                %s\n", bashQuote(entry))
+		}
+		b.WriteString("            )\n")
+
+		b.WriteString("            _arguments \\\n")
+		if l.prefix == "" {
+			b.WriteString("                '--help[Show help]' \\\n")
+			b.WriteString("                '--version[Show version]' \\\n")
+		}
+		b.WriteString("                '*: :{_describe command commands}'\n")
+		if snippet, ok := snippets[l.prefix]; ok {
+			b.WriteString(indentSnippet(snippet, 12))
+		}
+		b.WriteString("            ;;\n")
+		isLevel[l.prefix] = true
+	}
+
+	// The arguments of commands with a snippet come after the levels, so
+	// that subcommands still match first
+	for _, k := range sortedKeys(snippets) {
+		pattern := bashQuote(k+" ") + "*"
+		if !isLevel[k] {
+			pattern = bashQuote(k) + "|" + pattern
+		}
+
+		fmt.Fprintf(&b, "        %s)\n", pattern)
+		b.WriteString(indentSnippet(snippets[k], 12))
+		b.WriteString("            ;;\n")
+	}
+
+	files := "_files"
+	if c.Autocomplete {
+		files = "(( directive & 2 )) || _files"
+	}
+	fmt.Fprintf(&b, `        *)
+            %s
+            ;;
+    esac
+}
+
+`, files)
+	fmt.Fprintf(&b, "%s \"$@\"\n", fn)
+
+	return b.String(), nil
+}
+
+// FishCompletion returns a fish completion script for the CLI, to be saved
+// as Name followed by ".fish" in a fish completions directory. It
+// completes the commands at the root along with --help and --version, and
+// the subcommands of nested commands once their parents are on the
+// command line, with the synopsis of each command as its description.
+// Hidden commands are not completed, and after a "--" argument only files
+// are.
+//
+// Fish has no per-command branches, so the "fish" snippet of commands that
+// implement CommandCompletion is added as is after the generated lines,
+// under a comment naming the command. It is expected to consist of
+// complete commands of its own.
+//
+// Every command is instantiated to get its synopsis, so an error is
+// returned if a factory fails. Name must be set.
+func (c *CLI) FishCompletion() (string, error) {
+	c.once.Do(c.init)
+
+	name := strings.TrimSpace(c.Name)
+	if name == "" {
+		return "", errors.New("the CLI must have a Name to generate completions")
+	}
+
+	levels, err := c.completionLevels("", true)
+	if err != nil {
+		return "", err
+	}
+
+	snippets, err := c.completionSnippets("fish")
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# fish completion for %s\n", name)
+	fmt.Fprintf(&b, "complete -c %s -n %s -l help -d 'Show help'\n",
+		fishQuote(name), fishQuote("__fish_use_subcommand; and "+fishNoDashDash))
+	fmt.Fprintf(&b, "complete -c %s -n %s -l version -d 'Show version'\n",
+		fishQuote(name), fishQuote("__fish_use_subcommand; and "+fishNoDashDash))
+	fmt.Fprintf(&b, "complete -c %s -F -n %s\n",
+		fishQuote(name), fishQuote("contains -- -- (commandline -opc)"))
+
+	if c.Autocomplete {
+		fn := "__" + bashIdentifier(name) + "_complete"
+		fmt.Fprintf(&b, "function %s\n", fn)
+		fmt.Fprintf(&b, "    set -l out (%s %s (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)\n",
+			fishQuote(name), autocompleteCommandName)
+		b.WriteString(`    set -l directive 0
+    if string match -qr '^:[0-9]+$' -- $out[-1]
+        set directive (string sub -s 2 -- $out[-1])
+        set -e out[-1]
+    end
+    if test (math "bitand($directive, 4)") -ne 0
+        for ext in (string replace -r '\t.*' '' -- $out)
+            __fish_complete_suffix .$ext
+        end
+    else if set -q out[1]
+        printf '%s\n' $out
+    else if test (math "bitand($directive, 2)") -eq 0
+        __fish_complete_path (commandline -ct)
+    end
+end
+`)
+		fmt.Fprintf(&b, "complete -c %s -f -n 'not __fish_use_subcommand' -a %s\n",
+			fishQuote(name), fishQuote("("+fn+")"))
+	}
+
+	for _, l := range levels {
+		condition := "__fish_use_subcommand"
+		if l.prefix != "" {
+			var conditions []string
+			for _, w := range strings.Fields(l.prefix) {
+				conditions = append(conditions, "__fish_seen_subcommand_from "+w)
+			}
+			conditions = append(conditions,
+				"not __fish_seen_subcommand_from "+strings.Join(l.names, " "))
+			condition = strings.Join(conditions, "; and ")
+		}
+		condition += "; and " + fishNoDashDash
+
+		for i, n := range l.names {
+			fmt.Fprintf(&b, "complete -c %s -f -n %s -a %s",
+				fishQuote(name), fishQuote(condition), fishQuote(n))
+			if l.synopses[i] != "" {
+				fmt.Fprintf(&b, " -d %s", fishQuote(l.synopses[i]))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	for _, k := range sortedKeys(snippets) {
+		fmt.Fprintf(&b, "\n# %s\n", k)
+		b.WriteString(indentSnippet(snippets[k], 0))
+	}
+
+	return b.String(), nil
+}
+
+// fishNoDashDash is the fish condition that holds until a "--" argument
+// is on the command line.
+const fishNoDashDash = "not contains -- -- (commandline -opc)"
+
+// Completion is a candidate to complete an argument with, along with its
+// description. See CommandAutocompleteDescribed.
+type Completion struct {
+	Value       string
+	Description string
+}
+
+// CompletionDirective tells the shell how to complete the word being
+// completed besides offering the candidates printed by "__complete". It is
+// printed after them on a line of its own, as a colon followed by the
+// number, such as ":1". See CommandAutocompleteDirective.
+type CompletionDirective int
+
+const (
+	// CompletionNoSpace keeps the shell from adding a space after the
+	// completed word, for candidates that are only the start of a word
+	// such as "key=". Fish ignores it.
+	CompletionNoSpace CompletionDirective = 1 << iota
+
+	// CompletionNoFileComp keeps the shell from completing files when
+	// there are no candidates.
+	CompletionNoFileComp
+
+	// CompletionFilterFileExt makes the shell complete files with the
+	// extensions given as the candidates, such as "yaml", instead.
+	CompletionFilterFileExt
+)
+
+// autocompleteCommandName is the name of the built-in command enabled with
+// CLI.Autocomplete.
+const autocompleteCommandName = "__complete"
+
+// newAutocompleteCommand is the factory of the built-in command enabled
+// with CLI.Autocomplete.
+func (c *CLI) newAutocompleteCommand() (Command, error) {
+	return &autocompleteCommand{cli: c}, nil
+}
+
+// autocompleteCommand prints the candidates of the CommandAutocomplete
+// hooks of the command on the command line. See CLI.Autocomplete.
+type autocompleteCommand struct {
+	cli *CLI
+}
+
+func (a *autocompleteCommand) Help() string {
+	return strings.TrimSpace(fmt.Sprintf(`
+Usage: %s [words...] current
+
+  Prints the candidates to complete the word current with, one per line,
+  for the command named by the words before it, followed by a line with
+  the completion directive such as ":0". Candidates with a description
+  are followed by a tab and the description. This is called by the
+  generated shell completion scripts.
+`, strings.TrimSpace(a.cli.Name+" "+autocompleteCommandName)))
+}
+
+func (a *autocompleteCommand) Run(args []string) int {
+	candidates, directive, err := a.cli.autocomplete(args)
+	if err != nil {
+		a.cli.Ui.Error(fmt.Sprintf("Error: %s", err))
+		return 1
+	}
+
+	if len(candidates) > 0 {
+		lines := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			lines[i] = candidate.Value
+			if candidate.Description != "" {
+				lines[i] += "\t" + candidate.Description
+			}
+		}
+		a.cli.Ui.Output(strings.Join(lines, "\n"))
+	}
+	a.cli.Ui.Output(fmt.Sprintf(":%d", directive))
+	return 0
+}
+
+func (a *autocompleteCommand) Builtin() bool {
+	return true
+}
+
+func (a *autocompleteCommand) Synopsis() string {
+	return "Prints completion candidates for the shell"
+}
+
+// autocomplete returns the sorted candidates of the CommandAutocomplete
+// hooks of the command named by the words before the last one that start
+// with the last one, the word being completed. Flags are completed if the
+// word starts with a dash and arguments otherwise, unless it is the value
+// of a flag of CommandAutocompleteFlagValues. There are no candidates after
+// a "--" argument, where the shell falls back to completing files.
+//
+// Flags are described by AutocompleteFlags, and arguments by the
+// CommandAutocompleteDescribed hook if the command implements it.
+//
+// The directive of CommandAutocompleteDirective is returned along with the
+// candidates of the arguments. With CompletionFilterFileExt those are the
+// extensions, which are not matched against the word.
+func (c *CLI) autocomplete(words []string) ([]Completion, CompletionDirective, error) {
+	if len(words) == 0 {
+		return nil, 0, nil
+	}
+
+	tokens, current := words[:len(words)-1], words[len(words)-1]
+	for _, t := range tokens {
+		if t == "--" {
+			return nil, 0, nil
+		}
+	}
+	if canonical, consumed, ok := c.matchAlias(tokens); ok {
+		tokens = append(strings.Fields(canonical), tokens[consumed:]...)
+	}
+
+	k, _, ok := c.matchCommand(tokens)
+	if !ok {
+		return nil, 0, nil
+	}
+
+	raw, ok := c.commandTree.Get(k)
+	if !ok {
+		return nil, 0, nil
+	}
+
+	command, err := raw.(CommandFactory)()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error instantiating %q: %s", k, err)
+	}
+
+	hooks, ok := command.(CommandAutocomplete)
+	if !ok {
+		return nil, 0, nil
+	}
+
+	var values map[string][]string
+	if v, ok := command.(CommandAutocompleteFlagValues); ok {
+		values = v.AutocompleteFlagValues()
+	}
+
+	var all []Completion
+	var directive CompletionDirective
+	n := len(tokens)
+	switch {
+	case strings.HasPrefix(current, "-") && strings.Contains(current, "="):
+		idx := strings.IndexByte(current, '=')
+		for _, v := range values[current[:idx]] {
+			all = append(all, Completion{Value: current[:idx+1] + v})
+		}
+	case strings.HasPrefix(current, "-"):
+		for flag, description := range hooks.AutocompleteFlags() {
+			all = append(all, Completion{Value: flag, Description: description})
+		}
+	case n > 0 && values[tokens[n-1]] != nil:
+		// Bash splits "-format=" into "-format" and "=", which is then
+		// the word being completed
+		all = plainCompletions(values[tokens[n-1]])
+		if current == "=" {
+			current = ""
+		}
+	case n > 1 && tokens[n-1] == "=" && values[tokens[n-2]] != nil:
+		all = plainCompletions(values[tokens[n-2]])
+	default:
+		if d, ok := command.(CommandAutocompleteDescribed); ok {
+			all = d.AutocompleteArgsDescribed()
+		} else {
+			all = plainCompletions(hooks.AutocompleteArgs())
+		}
+		if d, ok := command.(CommandAutocompleteDirective); ok {
+			directive = d.AutocompleteDirective()
+		}
+	}
+
+	if directive&CompletionFilterFileExt != 0 {
+		return all, directive, nil
+	}
+
+	var candidates []Completion
+	for _, candidate := range all {
+		if strings.HasPrefix(candidate.Value, current) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Value < candidates[j].Value
+	})
+
+	return candidates, directive, nil
+}
+
+// plainCompletions returns the values as completions without a
+// description.
+func plainCompletions(values []string) []Completion {
+	result := make([]Completion, len(values))
+	for i, v := range values {
+		result[i] = Completion{Value: v}
+	}
+
+	return result
+}
+
+// completionLevel is a command, or the root, with the subcommands to
+// complete after it.
+type completionLevel struct {
+	prefix   string
+	names    []string
+	synopses []string
+}
+
+// completionLevels returns the level of prefix followed by the levels of
+// its subcommands, depth first, in sorted order. Hidden commands are
+// omitted, as are commands without subcommands other than the root. The
+// names are the last word of each subcommand. The synopses are only
+// filled in if synopses is true, since they require instantiating every
+// command.
+func (c *CLI) completionLevels(prefix string, synopses bool) ([]completionLevel, error) {
+	commands := c.helpCommands(prefix)
+	delete(commands, "")
+	if len(commands) == 0 && prefix != "" {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(commands))
+	for k := range commands {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	level := completionLevel{prefix: prefix}
+	for _, k := range keys {
+		level.names = append(level.names, k[strings.LastIndex(k, " ")+1:])
+
+		if synopses {
+			command, err := commands[k]()
+			if err != nil {
+				return nil, fmt.Errorf("error instantiating %q: %s", k, err)
+			}
+
+			level.synopses = append(level.synopses, command.Synopsis())
+		}
+	}
+
+	levels := []completionLevel{level}
+	for _, k := range keys {
+		sub, err := c.completionLevels(k, synopses)
+		if err != nil {
+			return nil, err
+		}
+
+		levels = append(levels, sub...)
+	}
+
+	return levels, nil
+}
+
+// completionSnippets returns the snippets for shell of the commands that
+// implement CommandCompletion, keyed by the name of the command. Hidden
+// commands and empty snippets are left out.
+func (c *CLI) completionSnippets(shell string) (map[string]string, error) {
+	snippets := make(map[string]string)
+	var err error
+	c.commandTree.Walk(func(k string, raw interface{}) bool {
+		if _, ok := c.commandHidden[k]; ok || k == "" {
+			return false
+		}
+
+		command, ferr := raw.(CommandFactory)()
+		if ferr != nil {
+			err = fmt.Errorf("error instantiating %q: %s", k, ferr)
+			return true
+		}
+
+		if cc, ok := command.(CommandCompletion); ok {
+			if snippet := strings.TrimSpace(cc.CompletionScript(shell)); snippet != "" {
+				snippets[k] = snippet
+			}
+		}
+
+		return false
+	})
+
+	return snippets, err
+}
+
+// indentSnippet indents every line of the completion snippet s by the
+// given number of spaces and ends it with a newline.
+func indentSnippet(s string, spaces int) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = strings.Repeat(" ", spaces) + line
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// bashQuote quotes s as a single word for bash or zsh.
+func bashQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// fishQuote quotes s as a single word for fish.
+func fishQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+// bashIdentifier replaces the characters of s that aren't allowed in the
+// name of a bash or zsh function.
+func bashIdentifier(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,594 @@
+package cli
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testBashCompletion = `# bash completion for my-app
+_my_app_completions() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local path=""
+    local i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            --)
+                COMPREPLY=($(compgen -f -- "$cur"))
+                return
+                ;;
+            -*) ;;
+            *) path="${path:+$path }${COMP_WORDS[i]}" ;;
+        esac
+    done
+
+    local candidates=""
+    case "$path" in
+        '') candidates='--help --version foo zap' ;;
+        'foo') candidates='bar zip' ;;
+        'foo zip') candidates='zop' ;;
+    esac
+
+    COMPREPLY=($(compgen -W "$candidates" -- "$cur"))
+}
+complete -F _my_app_completions 'my-app'
+`
+
+func TestCLIBashCompletion(t *testing.T) {
+	factory := func() (Command, error) {
+		return new(MockCommand), nil
+	}
+
+	cli := &CLI{
+		Name: "my-app",
+		Commands: map[string]CommandFactory{
+			"foo":         factory,
+			"foo bar":     factory,
+			"foo zip zop": factory,
+			"foo hidden":  factory,
+			"zap":         factory,
+		},
+		HiddenCommands: []string{"foo hidden"},
+	}
+
+	result, err := cli.BashCompletion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != testBashCompletion {
+		t.Fatalf("bad:\n%s", result)
+	}
+}
+
+func TestCLIBashCompletion_noName(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+	}
+
+	if _, err := cli.BashCompletion(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+const testBashCompletionSnippets = `# bash completion for my-app
+_my_app_completions() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local path=""
+    local i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            --)
+                COMPREPLY=($(compgen -f -- "$cur"))
+                return
+                ;;
+            -*) ;;
+            *) path="${path:+$path }${COMP_WORDS[i]}" ;;
+        esac
+    done
+
+    local candidates=""
+    case "$path" in
+        '') candidates='--help --version deploy empty foo' ;;
+        'foo')
+            candidates='bar'
+            candidates="$candidates $(ls)"
+            ;;
+        'deploy'|'deploy '*)
+            candidates="$candidates production staging"
+            ;;
+        'foo '*)
+            candidates="$candidates $(ls)"
+            ;;
+    esac
+
+    COMPREPLY=($(compgen -W "$candidates" -- "$cur"))
+}
+complete -F _my_app_completions 'my-app'
+`
+
+// testCompletionSnippetsCLI returns a CLI with commands that implement
+// CommandCompletion with the given snippet for each shell.
+func testCompletionSnippetsCLI() *CLI {
+	snippet := func(scripts map[string]string) CommandFactory {
+		return func() (Command, error) {
+			return &MockCommandCompletion{CompletionScripts: scripts}, nil
+		}
+	}
+
+	return &CLI{
+		Name: "my-app",
+		Commands: map[string]CommandFactory{
+			"deploy": snippet(map[string]string{
+				"bash": `candidates="$candidates production staging"`,
+				"zsh":  "_values 'environment' production staging",
+				"fish": "complete -c my-app -n '__fish_seen_subcommand_from deploy' -a 'production staging'",
+			}),
+			"foo": snippet(map[string]string{
+				"bash": `candidates="$candidates $(ls)"`,
+				"zsh":  "_files -g '*.txt'",
+			}),
+			"foo bar": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"empty":  snippet(map[string]string{"bash": " ", "zsh": " ", "fish": " "}),
+			"hidden": snippet(map[string]string{"bash": "hidden", "zsh": "hidden", "fish": "hidden"}),
+		},
+		HiddenCommands: []string{"hidden"},
+	}
+}
+
+func TestCLIBashCompletion_snippets(t *testing.T) {
+	cli := testCompletionSnippetsCLI()
+
+	result, err := cli.BashCompletion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != testBashCompletionSnippets {
+		t.Fatalf("bad:\n%s", result)
+	}
+}
+
+const testZshCompletion = `#compdef my-app
+
+_my_app() {
+    local cmd=""
+    local word
+    for word in "${(@)words[2,CURRENT-1]}"; do
+        if [[ "$word" == "--" ]]; then
+            _files
+            return
+        fi
+        [[ "$word" == -* ]] || cmd="${cmd:+$cmd }$word"
+    done
+
+    local -a commands
+    case "$cmd" in
+        '')
+            commands=(
+                'foo:Foo'\''s things'
+                'zap'
+            )
+            _arguments \
+                '--help[Show help]' \
+                '--version[Show version]' \
+                '*: :{_describe command commands}'
+            ;;
+        'foo')
+            commands=(
+                'bar:Bar: the sequel'
+            )
+            _arguments \
+                '*: :{_describe command commands}'
+            ;;
+        *)
+            _files
+            ;;
+    esac
+}
+
+_my_app "$@"
+`
+
+func TestCLIZshCompletion(t *testing.T) {
+	synopsis := func(s string) CommandFactory {
+		return func() (Command, error) {
+			return &MockCommand{SynopsisText: s}, nil
+		}
+	}
+
+	cli := &CLI{
+		Name: "my-app",
+		Commands: map[string]CommandFactory{
+			"foo":        synopsis("Foo's things"),
+			"foo bar":    synopsis("Bar: the sequel"),
+			"foo hidden": synopsis("Hidden"),
+			"zap":        synopsis(""),
+		},
+		HiddenCommands: []string{"foo hidden"},
+	}
+
+	result, err := cli.ZshCompletion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != testZshCompletion {
+		t.Fatalf("bad:\n%s", result)
+	}
+}
+
+func TestCLIZshCompletion_snippets(t *testing.T) {
+	cli := testCompletionSnippetsCLI()
+
+	result, err := cli.ZshCompletion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, expected := range []string{
+		"                '*: :{_describe command commands}'\n" +
+			"            _files -g '*.txt'\n" +
+			"            ;;\n",
+		"        'deploy'|'deploy '*)\n" +
+			"            _values 'environment' production staging\n" +
+			"            ;;\n" +
+			"        'foo '*)\n" +
+			"            _files -g '*.txt'\n" +
+			"            ;;\n" +
+			"        *)\n",
+	} {
+		if !strings.Contains(result, expected) {
+			t.Fatalf("missing %q:\n%s", expected, result)
+		}
+	}
+
+	if strings.Contains(result, "hidden") {
+		t.Fatalf("bad:\n%s", result)
+	}
+}
+
+func TestCLIZshCompletion_factoryError(t *testing.T) {
+	cli := &CLI{
+		Name: "my-app",
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return nil, errors.New("broken")
+			},
+		},
+	}
+
+	if _, err := cli.ZshCompletion(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+const testFishCompletion = `# fish completion for my-app
+complete -c 'my-app' -n '__fish_use_subcommand; and not contains -- -- (commandline -opc)' -l help -d 'Show help'
+complete -c 'my-app' -n '__fish_use_subcommand; and not contains -- -- (commandline -opc)' -l version -d 'Show version'
+complete -c 'my-app' -F -n 'contains -- -- (commandline -opc)'
+complete -c 'my-app' -f -n '__fish_use_subcommand; and not contains -- -- (commandline -opc)' -a 'image' -d 'Manage images'
+complete -c 'my-app' -f -n '__fish_use_subcommand; and not contains -- -- (commandline -opc)' -a 'zap'
+complete -c 'my-app' -f -n '__fish_seen_subcommand_from image; and not __fish_seen_subcommand_from ls rm; and not contains -- -- (commandline -opc)' -a 'ls' -d 'List images'
+complete -c 'my-app' -f -n '__fish_seen_subcommand_from image; and not __fish_seen_subcommand_from ls rm; and not contains -- -- (commandline -opc)' -a 'rm' -d 'Remove an image\'s tags'
+`
+
+func TestCLIFishCompletion(t *testing.T) {
+	synopsis := func(s string) CommandFactory {
+		return func() (Command, error) {
+			return &MockCommand{SynopsisText: s}, nil
+		}
+	}
+
+	cli := &CLI{
+		Name: "my-app",
+		Commands: map[string]CommandFactory{
+			"image":        synopsis("Manage images"),
+			"image ls":     synopsis("List images"),
+			"image rm":     synopsis("Remove an image's tags"),
+			"image hidden": synopsis("Hidden"),
+			"zap":          synopsis(""),
+		},
+		HiddenCommands: []string{"image hidden"},
+	}
+
+	result, err := cli.FishCompletion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != testFishCompletion {
+		t.Fatalf("bad:\n%s", result)
+	}
+}
+
+func TestCLIFishCompletion_snippets(t *testing.T) {
+	cli := testCompletionSnippetsCLI()
+
+	result, err := cli.FishCompletion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := "\n# deploy\n" +
+		"complete -c my-app -n '__fish_seen_subcommand_from deploy' -a 'production staging'\n"
+	if !strings.HasSuffix(result, expected) {
+		t.Fatalf("bad:\n%s", result)
+	}
+	if strings.Contains(result, "hidden") || strings.Contains(result, "# empty") {
+		t.Fatalf("bad:\n%s", result)
+	}
+}
+
+func TestCLIRun_autocomplete(t *testing.T) {
+	deploy := &MockCommandAutocomplete{
+		Args:  []string{"production", "preview", "staging"},
+		Flags: map[string]string{"-env": "Environment", "-force": "", "-dry-run": ""},
+	}
+
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"deploy", "p"}, "preview\nproduction\n:0\n"},
+		{[]string{"deploy", ""}, "preview\nproduction\nstaging\n:0\n"},
+		{[]string{"deploy", "-force", "st"}, "staging\n:0\n"},
+		{[]string{"deploy", "-"}, "-dry-run\n-env\tEnvironment\n-force\n:0\n"},
+		{[]string{"app", "deploy", "p"}, "preview\nproduction\n:0\n"},
+		{[]string{"dp", "s"}, "staging\n:0\n"},
+		{[]string{"deploy", "-force", "-"}, "-dry-run\n-env\tEnvironment\n-force\n:0\n"},
+		{[]string{"deploy", "--", "-"}, ":0\n"},
+		{[]string{"deploy", "--", "p"}, ":0\n"},
+		{[]string{"deploy", "-force", "--", ""}, ":0\n"},
+		{[]string{"other", "p"}, ":0\n"},
+		{[]string{"nope", "p"}, ":0\n"},
+		{[]string{""}, ":0\n"},
+	}
+
+	for _, tc := range testCases {
+		ui := NewMockUi()
+		cli := &CLI{
+			Name: "my-app",
+			Args: append([]string{"__complete"}, tc.args...),
+			Commands: map[string]CommandFactory{
+				"deploy": func() (Command, error) {
+					return deploy, nil
+				},
+				"app deploy": func() (Command, error) {
+					return deploy, nil
+				},
+				"other": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+			},
+			Aliases:      map[string]string{"dp": "deploy"},
+			Autocomplete: true,
+			Ui:           ui,
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("Args: %#v. err: %s", tc.args, err)
+		}
+		if exitCode != 0 {
+			t.Fatalf("Args: %#v. bad: %d", tc.args, exitCode)
+		}
+
+		if ui.OutputWriter.String() != tc.expected {
+			t.Fatalf("Args: %#v. bad: %#v", tc.args, ui.OutputWriter.String())
+		}
+	}
+}
+
+func TestCLIRun_autocompleteFlagValues(t *testing.T) {
+	export := &MockCommandAutocompleteFlagValues{
+		MockCommandAutocomplete: MockCommandAutocomplete{
+			Args:  []string{"all", "latest"},
+			Flags: map[string]string{"-format": "Output format", "-force": ""},
+		},
+		FlagValues: map[string][]string{"-format": {"json", "yaml", "json-lines"}},
+	}
+
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"export", "-format="}, "-format=json\n-format=json-lines\n-format=yaml\n:0\n"},
+		{[]string{"export", "-format=j"}, "-format=json\n-format=json-lines\n:0\n"},
+		{[]string{"export", "-force=t"}, ":0\n"},
+		{[]string{"export", "-format", ""}, "json\njson-lines\nyaml\n:0\n"},
+		{[]string{"export", "-format", "y"}, "yaml\n:0\n"},
+		{[]string{"export", "-format", "="}, "json\njson-lines\nyaml\n:0\n"},
+		{[]string{"export", "-format", "=", "y"}, "yaml\n:0\n"},
+		{[]string{"export", "-format", "json", "l"}, "latest\n:0\n"},
+		{[]string{"export", "-f"}, "-force\n-format\tOutput format\n:0\n"},
+	}
+
+	for _, tc := range testCases {
+		ui := NewMockUi()
+		cli := &CLI{
+			Name: "my-app",
+			Args: append([]string{"__complete"}, tc.args...),
+			Commands: map[string]CommandFactory{
+				"export": func() (Command, error) {
+					return export, nil
+				},
+			},
+			Autocomplete: true,
+			Ui:           ui,
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("Args: %#v. err: %s", tc.args, err)
+		}
+		if exitCode != 0 {
+			t.Fatalf("Args: %#v. bad: %d", tc.args, exitCode)
+		}
+
+		if ui.OutputWriter.String() != tc.expected {
+			t.Fatalf("Args: %#v. bad: %#v", tc.args, ui.OutputWriter.String())
+		}
+	}
+}
+
+func TestCLIRun_autocompleteDirective(t *testing.T) {
+	set := &MockCommandAutocompleteDirective{
+		MockCommandAutocomplete: MockCommandAutocomplete{
+			Args:  []string{"name=", "email="},
+			Flags: map[string]string{"-global": ""},
+		},
+		Directive: CompletionNoSpace,
+	}
+	apply := &MockCommandAutocompleteDirective{
+		MockCommandAutocomplete: MockCommandAutocomplete{
+			Args: []string{"yaml", "json"},
+		},
+		Directive: CompletionFilterFileExt | CompletionNoFileComp,
+	}
+
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"set", ""}, "email=\nname=\n:1\n"},
+		{[]string{"set", "n"}, "name=\n:1\n"},
+		{[]string{"set", "x"}, ":1\n"},
+		{[]string{"set", "-"}, "-global\n:0\n"},
+		{[]string{"set", "--", ""}, ":0\n"},
+		{[]string{"apply", "conf"}, "yaml\njson\n:6\n"},
+	}
+
+	for _, tc := range testCases {
+		ui := NewMockUi()
+		cli := &CLI{
+			Name: "my-app",
+			Args: append([]string{"__complete"}, tc.args...),
+			Commands: map[string]CommandFactory{
+				"set": func() (Command, error) {
+					return set, nil
+				},
+				"apply": func() (Command, error) {
+					return apply, nil
+				},
+			},
+			Autocomplete: true,
+			Ui:           ui,
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("Args: %#v. err: %s", tc.args, err)
+		}
+		if exitCode != 0 {
+			t.Fatalf("Args: %#v. bad: %d", tc.args, exitCode)
+		}
+
+		if ui.OutputWriter.String() != tc.expected {
+			t.Fatalf("Args: %#v. bad: %#v", tc.args, ui.OutputWriter.String())
+		}
+	}
+}
+
+func TestCLIRun_autocompleteDescribed(t *testing.T) {
+	checkout := &MockCommandAutocompleteDescribed{
+		MockCommandAutocomplete: MockCommandAutocomplete{
+			Args: []string{"ignored"},
+		},
+		Described: []Completion{
+			{Value: "main", Description: "Default branch"},
+			{Value: "feature:login", Description: "Login form"},
+			{Value: "fix"},
+		},
+	}
+
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"checkout", ""}, "feature:login\tLogin form\nfix\nmain\tDefault branch\n:0\n"},
+		{[]string{"checkout", "f"}, "feature:login\tLogin form\nfix\n:0\n"},
+		{[]string{"checkout", "m"}, "main\tDefault branch\n:0\n"},
+		{[]string{"checkout", "i"}, ":0\n"},
+	}
+
+	for _, tc := range testCases {
+		ui := NewMockUi()
+		cli := &CLI{
+			Name: "my-app",
+			Args: append([]string{"__complete"}, tc.args...),
+			Commands: map[string]CommandFactory{
+				"checkout": func() (Command, error) {
+					return checkout, nil
+				},
+			},
+			Autocomplete: true,
+			Ui:           ui,
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("Args: %#v. err: %s", tc.args, err)
+		}
+		if exitCode != 0 {
+			t.Fatalf("Args: %#v. bad: %d", tc.args, exitCode)
+		}
+
+		if ui.OutputWriter.String() != tc.expected {
+			t.Fatalf("Args: %#v. bad: %#v", tc.args, ui.OutputWriter.String())
+		}
+	}
+}
+
+func TestCLICompletion_autocomplete(t *testing.T) {
+	cli := &CLI{
+		Name: "my-app",
+		Commands: map[string]CommandFactory{
+			"deploy": func() (Command, error) {
+				return new(MockCommandAutocomplete), nil
+			},
+		},
+		Autocomplete: true,
+	}
+
+	bash, err := cli.BashCompletion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	zsh, err := cli.ZshCompletion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fish, err := cli.FishCompletion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, expected := range []struct{ script, callback string }{
+		{bash, `$('my-app' __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)`},
+		{bash, `[[ "$cur" == "=" ]] && cur=""`},
+		{bash, `(( directive & 1 )) && compopt -o nospace`},
+		{bash, `dynamic="$(printf '%s\n' "$dynamic" | cut -f 1)"`},
+		{zsh, `_describe 'value' described -S ''`},
+		{zsh, `(( directive & 2 )) || _files`},
+		{fish, `__fish_complete_suffix .$ext`},
+		{zsh, `$('my-app' __complete "${(@)words[2,CURRENT]}" 2>/dev/null)`},
+		{fish, `set -l out ('my-app' __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)`},
+		{fish, `-a '(__my_app_complete)'`},
+	} {
+		if !strings.Contains(expected.script, expected.callback) {
+			t.Fatalf("missing %q:\n%s", expected.callback, expected.script)
+		}
+	}
+
+	// The hidden command is never completed itself
+	if strings.Contains(bash, "'__complete") || strings.Contains(zsh, "'__complete") {
+		t.Fatalf("bad:\n%s\n%s", bash, zsh)
+	}
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// diagnosticsEnv are the environment variables that are always included
+// in the diagnostics since they affect the output of the CLI.
+var diagnosticsEnv = []string{
+	"TERM", "COLORTERM", "NO_COLOR", "CLICOLOR", "CLICOLOR_FORCE", "FORCE_COLOR",
+}
+
+// diagnosticsSecretSuffixes are the suffixes of environment variable names
+// whose values are redacted in the diagnostics.
+var diagnosticsSecretSuffixes = []string{"TOKEN", "KEY", "SECRET"}
+
+// newDiagnosticsCommand is the factory of the built-in command enabled
+// with CLI.DiagnosticsCommand.
+func (c *CLI) newDiagnosticsCommand() (Command, error) {
+	return &diagnosticsCommand{cli: c}, nil
+}
+
+// diagnosticsCommand prints information about the CLI and its environment
+// that is useful in bug reports. See CLI.DiagnosticsCommand.
+type diagnosticsCommand struct {
+	cli *CLI
+}
+
+func (d *diagnosticsCommand) Help() string {
+	return strings.TrimSpace(fmt.Sprintf(`
+Usage: %s
+
+  Prints the version of the application, the Go version, the OS and
+  architecture, the detected terminal and color support and the relevant
+  environment variables. Include this output when reporting a bug.
+
+  Values of environment variables ending in TOKEN, KEY or SECRET are
+  redacted.
+`, strings.TrimSpace(d.cli.Name+" "+d.cli.DiagnosticsCommand)))
+}
+
+func (d *diagnosticsCommand) Run(args []string) int {
+	d.cli.Ui.Output(d.text())
+	return 0
+}
+
+func (d *diagnosticsCommand) Builtin() bool {
+	return true
+}
+
+func (d *diagnosticsCommand) Synopsis() string {
+	return "Prints diagnostic information for bug reports"
+}
+
+// text returns the diagnostics.
+func (d *diagnosticsCommand) text() string {
+	version := d.cli.Version
+	if version == "" {
+		version = "unknown"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Version: %s\n", version)
+	fmt.Fprintf(&b, "Go version: %s\n", runtime.Version())
+	fmt.Fprintf(&b, "OS/Arch: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "Stdout is a terminal: %t\n", isTerminalFile(os.Stdout))
+	fmt.Fprintf(&b, "Stderr is a terminal: %t\n", isTerminalFile(os.Stderr))
+	fmt.Fprintf(&b, "Color output: %t\n", !NoColor)
+	fmt.Fprintf(&b, "Color error output: %t\n", !NoColorError)
+
+	b.WriteString("Environment:\n")
+	for _, kv := range diagnosticsEnvironment(d.cli.Name) {
+		fmt.Fprintf(&b, "  %s\n", kv)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// diagnosticsEnvironment returns the environment variables relevant to the
+// application with the given name as sorted "KEY=value" pairs: the ones
+// in diagnosticsEnv and the ones prefixed with the upper cased name.
+// Values of variables that look like secrets are redacted.
+func diagnosticsEnvironment(name string) []string {
+	prefix := strings.ToUpper(strings.Replace(name, "-", "_", -1)) + "_"
+
+	var result []string
+	for _, kv := range os.Environ() {
+		k, v := kv, ""
+		if idx := strings.Index(kv, "="); idx > -1 {
+			k, v = kv[:idx], kv[idx+1:]
+		}
+
+		relevant := name != "" && strings.HasPrefix(k, prefix)
+		for _, e := range diagnosticsEnv {
+			if k == e {
+				relevant = true
+			}
+		}
+		if !relevant {
+			continue
+		}
+
+		for _, suffix := range diagnosticsSecretSuffixes {
+			if strings.HasSuffix(strings.ToUpper(k), suffix) {
+				v = "[redacted]"
+				break
+			}
+		}
+
+		result = append(result, k+"="+v)
+	}
+
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCLIRun_diagnostics(t *testing.T) {
+	t.Setenv("MY_APP_API_TOKEN", "hunter2")
+	t.Setenv("MY_APP_REGION", "eu-west-1")
+	t.Setenv("UNRELATED", "nope")
+
+	ui := NewMockUi()
+	cli := &CLI{
+		Name:    "my-app",
+		Version: "1.2.3",
+		Args:    []string{"env"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		DiagnosticsCommand: "env",
+		Ui:                 ui,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	out := ui.OutputWriter.String()
+	for _, expected := range []string{
+		"Version: 1.2.3\n",
+		"Go version: " + runtime.Version() + "\n",
+		"OS/Arch: " + runtime.GOOS + "/" + runtime.GOARCH + "\n",
+		"Stdout is a terminal: ",
+		"Color output: ",
+		"  MY_APP_API_TOKEN=[redacted]\n",
+		"  MY_APP_REGION=eu-west-1\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("missing %q:\n%s", expected, out)
+		}
+	}
+
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "UNRELATED") {
+		t.Fatalf("bad:\n%s", out)
+	}
+}
+
+func TestCLIRun_diagnosticsOverridden(t *testing.T) {
+	command := new(MockCommand)
+	ui := NewMockUi()
+	cli := &CLI{
+		Args: []string{"env"},
+		Commands: map[string]CommandFactory{
+			"env": func() (Command, error) {
+				return command, nil
+			},
+		},
+		DiagnosticsCommand: "env",
+		Ui:                 ui,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !command.RunCalled {
+		t.Fatal("run should be called")
+	}
+	if ui.OutputWriter.String() != "" {
+		t.Fatalf("bad: %#v", ui.OutputWriter.String())
+	}
+}
+
+func TestCLIRun_diagnosticsDisabled(t *testing.T) {
+	cli := &CLI{
+		Args: []string{"env"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		Ui: NewMockUi(),
+
+		HelpWriter: new(strings.Builder),
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 127 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+}
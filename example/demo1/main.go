@@ -1,7 +1,6 @@
 package main
 
 import (
-	"log"
 	"os"
 
 	"mlib.com/cli"
@@ -51,10 +50,5 @@ func main() {
 		"bar": barCommandFactory,
 	}
 
-	exitStatus, err := c.Run()
-	if err != nil {
-		log.Println(err)
-	}
-
-	os.Exit(exitStatus)
+	c.Main()
 }
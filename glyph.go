@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"os"
+	"strings"
+)
+
+// NoUnicode defines if BoolGlyph falls back to ASCII. It is set to true
+// unless the locale in LC_ALL, LC_CTYPE or LANG, whichever is set first,
+// uses UTF-8. Like NoColor, it is a global option.
+var NoUnicode = !localeIsUTF8()
+
+// localeIsUTF8 returns true if the locale of the environment uses UTF-8.
+func localeIsUTF8() bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			v = strings.ToLower(v)
+			return strings.Contains(v, "utf-8") || strings.Contains(v, "utf8")
+		}
+	}
+
+	return false
+}
+
+// BoolGlyph returns a green "✓" if ok is true and a red "✗" otherwise, for
+// example to show the status of checks in a summary. If NoUnicode is set,
+// "OK" and "X" are used instead. The glyph is only colored if NoColor isn't
+// set.
+func BoolGlyph(ok bool) string {
+	glyph, attr := "✗", ColorFgRed
+	if NoUnicode {
+		glyph = "X"
+	}
+	if ok {
+		glyph, attr = "✓", ColorFgGreen
+		if NoUnicode {
+			glyph = "OK"
+		}
+	}
+
+	return getCachedColor(attr).Sprint(glyph)
+}
+
+// BoolGlyphString returns the glyph of BoolGlyph followed by a space and
+// the uncolored text, such as "✓ tests", to embed in a line of output.
+func BoolGlyphString(ok bool, text string) string {
+	return BoolGlyph(ok) + " " + text
+}
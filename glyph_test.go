@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestBoolGlyph(t *testing.T) {
+	oldNoColor, oldNoUnicode := NoColor, NoUnicode
+	defer func() { NoColor, NoUnicode = oldNoColor, oldNoUnicode }()
+
+	testCases := []struct {
+		noColor   bool
+		noUnicode bool
+		ok        bool
+		expected  string
+	}{
+		{false, false, true, "\x1b[32m✓\x1b[0m"},
+		{false, false, false, "\x1b[31m✗\x1b[0m"},
+		{true, false, true, "✓"},
+		{true, false, false, "✗"},
+		{false, true, true, "\x1b[32mOK\x1b[0m"},
+		{false, true, false, "\x1b[31mX\x1b[0m"},
+		{true, true, true, "OK"},
+		{true, true, false, "X"},
+	}
+
+	for _, tc := range testCases {
+		NoColor, NoUnicode = tc.noColor, tc.noUnicode
+
+		if actual := BoolGlyph(tc.ok); actual != tc.expected {
+			t.Fatalf("%#v: bad: %#v", tc, actual)
+		}
+	}
+}
+
+func TestBoolGlyphString(t *testing.T) {
+	oldNoColor, oldNoUnicode := NoColor, NoUnicode
+	defer func() { NoColor, NoUnicode = oldNoColor, oldNoUnicode }()
+
+	NoColor, NoUnicode = true, false
+	if actual := BoolGlyphString(true, "tests"); actual != "✓ tests" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	NoColor, NoUnicode = false, true
+	if actual := BoolGlyphString(false, "lint"); actual != "\x1b[31mX\x1b[0m lint" {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestLocaleIsUTF8(t *testing.T) {
+	testCases := []struct {
+		lcAll, lcCtype, lang string
+		expected             bool
+	}{
+		{"", "", "en_US.UTF-8", true},
+		{"", "", "de_DE.utf8", true},
+		{"C", "", "en_US.UTF-8", false},
+		{"", "en_US.UTF-8", "C", true},
+		{"", "", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Setenv("LC_ALL", tc.lcAll)
+		t.Setenv("LC_CTYPE", tc.lcCtype)
+		t.Setenv("LANG", tc.lang)
+
+		if actual := localeIsUTF8(); actual != tc.expected {
+			t.Fatalf("%#v: bad: %v", tc, actual)
+		}
+	}
+}
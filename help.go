@@ -14,27 +14,56 @@ type HelpFunc func(map[string]CommandFactory) string
 
 // BasicHelpFunc generates some basic help output that is usually good enough
 // for most CLI applications.
+//
+// The names of commands that implement CommandBuiltin are dimmed. If any
+// command implements CommandWithCategory, the commands are listed under a
+// header for their category, with the commands without one listed first
+// under "General".
+//
+// The usage line is synthesized from the commands: "<command>" is only
+// shown when there are commands to choose from, and it is optional when
+// there is a default command. The usage line of the help func the CLI
+// sets up itself also includes "[<subcommand>]" when commands are nested.
 func BasicHelpFunc(app string) HelpFunc {
+	return basicHelpFunc(app, nil)
+}
+
+// basicHelpFunc is BasicHelpFunc for the commands of cli, if it isn't nil,
+// so that the usage line shows whether they are nested, the colors follow
+// its ForceColor and the aliases are listed with its ShowAliasesInHelp.
+func basicHelpFunc(app string, cli *CLI) HelpFunc {
 	return func(commands map[string]CommandFactory) string {
+		var forceColor *bool
+		var aliases map[string][]string
+		if cli != nil {
+			forceColor = cli.ForceColor
+			aliases = cli.helpAliases()
+		}
+		builtinColor := NewColor(ColorFaint).forced(forceColor)
+
 		var buf bytes.Buffer
-		buf.WriteString(fmt.Sprintf(
-			"Usage: %s [--version] [--help] <command> [<args>]\n\n",
-			app))
+		buf.WriteString(basicHelpUsage(app, commands, cli != nil && cli.hasNestedCommands()))
+		buf.WriteString("\n\n")
 		buf.WriteString("Available commands are:\n")
 
 		// Get the list of keys so we can sort them, and also get the maximum
-		// key length so they can be aligned properly.
+		// name length, including any aliases, so they can be aligned
+		// properly.
 		keys := make([]string, 0, len(commands))
+		names := make(map[string]string, len(commands))
 		maxKeyLen := 0
 		for key := range commands {
-			if len(key) > maxKeyLen {
-				maxKeyLen = len(key)
+			names[key] = strings.Join(append([]string{key}, aliases[key]...), ", ")
+			if w := VisibleWidth(names[key]); w > maxKeyLen {
+				maxKeyLen = w
 			}
 
 			keys = append(keys, key)
 		}
 		sort.Strings(keys)
 
+		// Load the commands, grouped by their category
+		groups := make(map[string][]basicHelpCommand)
 		for _, key := range keys {
 			commandFunc, ok := commands[key]
 			if !ok {
@@ -50,14 +79,105 @@ func BasicHelpFunc(app string) HelpFunc {
 				continue
 			}
 
-			key = fmt.Sprintf("%s%s", key, strings.Repeat(" ", maxKeyLen-len(key)))
-			buf.WriteString(fmt.Sprintf("    %s    %s\n", key, command.Synopsis()))
+			category := ""
+			if c, ok := command.(CommandWithCategory); ok {
+				category = strings.TrimSpace(c.Category())
+			}
+			groups[category] = append(groups[category], basicHelpCommand{names[key], command})
+		}
+
+		categories := make([]string, 0, len(groups))
+		for category := range groups {
+			if category != "" {
+				categories = append(categories, category)
+			}
+		}
+		sort.Strings(categories)
+
+		if len(categories) == 0 {
+			writeBasicHelpCommands(&buf, groups[""], maxKeyLen, builtinColor)
+			return buf.String()
+		}
+
+		if _, ok := groups[""]; ok {
+			categories = append([]string{""}, categories...)
+		}
+		for _, category := range categories {
+			header := category
+			if header == "" {
+				header = basicHelpGeneralCategory
+			}
+
+			fmt.Fprintf(&buf, "\n%s:\n", header)
+			writeBasicHelpCommands(&buf, groups[category], maxKeyLen, builtinColor)
 		}
 
 		return buf.String()
 	}
 }
 
+// basicHelpGeneralCategory is the header BasicHelpFunc lists the commands
+// without a category under, when other commands have one.
+const basicHelpGeneralCategory = "General"
+
+// basicHelpCommand is a command listed by BasicHelpFunc under name, its
+// key followed by any aliases.
+type basicHelpCommand struct {
+	name    string
+	command Command
+}
+
+// writeBasicHelpCommands writes a line with the name and synopsis of each
+// command, with the names padded to maxKeyLen and those of built-in
+// commands in builtinColor.
+func writeBasicHelpCommands(buf *bytes.Buffer, commands []basicHelpCommand, maxKeyLen int, builtinColor *Color) {
+	for _, c := range commands {
+		name := c.name
+		if b, ok := c.command.(CommandBuiltin); ok && b.Builtin() {
+			name = builtinColor.Sprint(c.name)
+		}
+
+		name = fmt.Sprintf("%s%s", name, strings.Repeat(" ", maxKeyLen-VisibleWidth(c.name)))
+		buf.WriteString(fmt.Sprintf("    %s    %s\n", name, helpSynopsis(c.command)))
+	}
+}
+
+// helpSynopsis returns the synopsis of command as it is listed in the
+// help, with "(deprecated)" appended for commands implementing
+// CommandDeprecated.
+func helpSynopsis(command Command) string {
+	synopsis := command.Synopsis()
+	if _, ok := command.(CommandDeprecated); ok {
+		synopsis = strings.TrimSpace(synopsis + " (deprecated)")
+	}
+
+	return synopsis
+}
+
+// basicHelpUsage returns the usage line for BasicHelpFunc.
+func basicHelpUsage(app string, commands map[string]CommandFactory, nested bool) string {
+	_, hasDefault := commands[""]
+	named := len(commands)
+	if hasDefault {
+		named--
+	}
+
+	usage := fmt.Sprintf("Usage: %s [--version] [--help]", app)
+	if named > 0 {
+		command := "<command>"
+		if nested {
+			command += " [<subcommand>]"
+		}
+		if hasDefault {
+			command = "[" + command + "]"
+		}
+
+		usage += " " + command
+	}
+
+	return usage + " [<args>]"
+}
+
 // FilteredHelpFunc will filter the commands to only include the keys
 // in the include parameter.
 func FilteredHelpFunc(include []string, f HelpFunc) HelpFunc {
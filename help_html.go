@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+)
+
+// HTMLDocs renders the command tree as nested HTML lists, for example to
+// embed the documentation of the CLI in a web page. Each command is a list
+// item with its full name in a <code> element followed by its synopsis and
+// its help in a <pre> element. Subcommands are nested in a list within
+// their parent's item.
+//
+// Hidden commands are omitted and commands are sorted by name so the
+// output is deterministic. All text is HTML escaped.
+func (c *CLI) HTMLDocs() (string, error) {
+	c.once.Do(c.init)
+
+	var b strings.Builder
+	if err := c.writeHTMLDocs(&b, ""); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+func (c *CLI) writeHTMLDocs(b *strings.Builder, prefix string) error {
+	commands := c.helpCommands(prefix)
+	delete(commands, "")
+	if len(commands) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(commands))
+	for k := range commands {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b.WriteString("<ul>\n")
+	for _, k := range keys {
+		command, err := commands[k]()
+		if err != nil {
+			return fmt.Errorf("error instantiating %q: %s", k, err)
+		}
+
+		fmt.Fprintf(b, "<li><code>%s</code>", html.EscapeString(k))
+		if synopsis := command.Synopsis(); synopsis != "" {
+			fmt.Fprintf(b, " - %s", html.EscapeString(synopsis))
+		}
+		b.WriteString("\n")
+		if help := strings.TrimSpace(command.Help()); help != "" {
+			fmt.Fprintf(b, "<pre>%s</pre>\n", html.EscapeString(help))
+		}
+
+		if err := c.writeHTMLDocs(b, k); err != nil {
+			return err
+		}
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</ul>\n")
+
+	return nil
+}
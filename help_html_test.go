@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+)
+
+const testHTMLDocs = `<ul>
+<li><code>foo</code> - Foo &amp; friends
+<pre>Usage: foo &lt;command&gt;</pre>
+<ul>
+<li><code>foo bar</code> - Bar
+<pre>Usage: foo bar [-x=&#34;y&#34;]</pre>
+</li>
+<li><code>foo zip</code>
+</li>
+</ul>
+</li>
+<li><code>zap</code> - Zap
+</li>
+</ul>
+`
+
+func TestCLIHTMLDocs(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{
+					HelpText:     "Usage: foo <command>\n",
+					SynopsisText: "Foo & friends",
+				}, nil
+			},
+			"foo bar": func() (Command, error) {
+				return &MockCommand{
+					HelpText:     `Usage: foo bar [-x="y"]`,
+					SynopsisText: "Bar",
+				}, nil
+			},
+			"foo zip": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"foo hidden": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Hidden"}, nil
+			},
+			"zap": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Zap"}, nil
+			},
+		},
+		HiddenCommands: []string{"foo hidden"},
+	}
+
+	result, err := cli.HTMLDocs()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != testHTMLDocs {
+		t.Fatalf("bad:\n%s", result)
+	}
+}
+
+func TestCLIHTMLDocs_factoryError(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return nil, errors.New("broken")
+			},
+		},
+	}
+
+	if _, err := cli.HTMLDocs(); err == nil {
+		t.Fatal("should error")
+	}
+}
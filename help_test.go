@@ -0,0 +1,225 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBasicHelpFunc_alignWide(t *testing.T) {
+	f := BasicHelpFunc("app")
+	result := f(map[string]CommandFactory{
+		"日本": func() (Command, error) {
+			return &MockCommand{SynopsisText: "wide"}, nil
+		},
+		"foobar": func() (Command, error) {
+			return &MockCommand{SynopsisText: "narrow"}, nil
+		},
+	})
+
+	expected := "    foobar    narrow\n    日本      wide\n"
+	if !strings.HasSuffix(result, expected) {
+		t.Fatalf("bad:\n%s", result)
+	}
+}
+
+func TestBasicHelpFunc_usage(t *testing.T) {
+	factory := func() (Command, error) {
+		return new(MockCommand), nil
+	}
+
+	testCases := []struct {
+		name     string
+		commands map[string]CommandFactory
+		expected string
+	}{
+		{
+			"flat",
+			map[string]CommandFactory{"foo": factory, "bar": factory},
+			"Usage: app [--version] [--help] <command> [<args>]\n",
+		},
+		{
+			"nested",
+			map[string]CommandFactory{"foo": factory, "foo bar": factory},
+			"Usage: app [--version] [--help] <command> [<subcommand>] [<args>]\n",
+		},
+		{
+			"default only",
+			map[string]CommandFactory{"": factory},
+			"Usage: app [--version] [--help] [<args>]\n",
+		},
+		{
+			"default and commands",
+			map[string]CommandFactory{"": factory, "foo": factory},
+			"Usage: app [--version] [--help] [<command>] [<args>]\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cli := NewCLI("app", "")
+			cli.Commands = tc.commands
+			cli.once.Do(cli.init)
+
+			result := cli.helpText("")
+			if !strings.HasPrefix(result, tc.expected) {
+				t.Fatalf("bad: %#v", result)
+			}
+		})
+	}
+}
+
+func TestBasicHelpFunc_dimBuiltin(t *testing.T) {
+	withColor(t)
+
+	f := BasicHelpFunc("app")
+	result := f(map[string]CommandFactory{
+		"completion": func() (Command, error) {
+			return &MockCommandBuiltin{
+				MockCommand:   MockCommand{SynopsisText: "Completion"},
+				BuiltinResult: true,
+			}, nil
+		},
+		"deploy": func() (Command, error) {
+			return &MockCommandBuiltin{
+				MockCommand: MockCommand{SynopsisText: "Deploy"},
+			}, nil
+		},
+	})
+
+	expected := "    \x1b[2mcompletion\x1b[22m    Completion\n" +
+		"    deploy        Deploy\n"
+	if !strings.HasSuffix(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestBasicHelpFunc_categories(t *testing.T) {
+	category := func(synopsis, category string) CommandFactory {
+		return func() (Command, error) {
+			return &MockCommandWithCategory{
+				MockCommand:  MockCommand{SynopsisText: synopsis},
+				CategoryText: category,
+			}, nil
+		}
+	}
+
+	f := BasicHelpFunc("app")
+	result := f(map[string]CommandFactory{
+		"version": category("Version", ""),
+		"migrate": category("Migrate", "Database"),
+		"backup":  category("Backup", "Database"),
+		"deploy":  category("Deploy", "Apps"),
+		"init":    category("Init", ""),
+	})
+
+	expected := "Available commands are:\n" +
+		"\nGeneral:\n" +
+		"    init       Init\n" +
+		"    version    Version\n" +
+		"\nApps:\n" +
+		"    deploy     Deploy\n" +
+		"\nDatabase:\n" +
+		"    backup     Backup\n" +
+		"    migrate    Migrate\n"
+	if !strings.HasSuffix(result, expected) {
+		t.Fatalf("bad:\n%s", result)
+	}
+}
+
+func TestCLIRun_helpCategoriesHidden(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"--help"},
+		Commands: map[string]CommandFactory{
+			"migrate": func() (Command, error) {
+				return &MockCommandWithCategory{CategoryText: "Database"}, nil
+			},
+			"debug": func() (Command, error) {
+				return &MockCommandWithCategory{CategoryText: "Internal"}, nil
+			},
+		},
+		HiddenCommands: []string{"debug"},
+		HelpWriter:     buf,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if strings.Contains(buf.String(), "Internal") || strings.Contains(buf.String(), "debug") {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "\nDatabase:\n    migrate    \n") {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+}
+
+const testHelpShowAliases = `Usage: app [--version] [--help] <command> [<args>]
+
+Available commands are:
+    commit, ci          Record changes
+    init                Create a repository
+    status, st, stat    Show the working tree status
+
+`
+
+func TestCLIRun_helpShowAliases(t *testing.T) {
+	synopsis := func(s string) CommandFactory {
+		return func() (Command, error) {
+			return &MockCommand{SynopsisText: s}, nil
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"--help"},
+		Commands: map[string]CommandFactory{
+			"commit": synopsis("Record changes"),
+			"init":   synopsis("Create a repository"),
+			"status": synopsis("Show the working tree status"),
+		},
+		Aliases: map[string]string{
+			"ci":   "commit",
+			"s":    "status",
+			"st":   "status",
+			"stat": "status",
+		},
+		HiddenCommands:    []string{"s"},
+		ShowAliasesInHelp: true,
+		HelpWriter:        buf,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if buf.String() != testHelpShowAliases {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+	if len(cli.Lint()) != 0 {
+		t.Fatalf("bad: %#v", cli.Lint())
+	}
+}
+
+func TestCLIRun_helpAliasesHiddenByDefault(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"--help"},
+		Commands: map[string]CommandFactory{
+			"status": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		Aliases:    map[string]string{"st": "status"},
+		HelpWriter: buf,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.Contains(buf.String(), "\n    status    \n") {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// HighlightOptions control how HighlightMatchesOpts finds and colors the
+// occurrences of a term.
+type HighlightOptions struct {
+	// IgnoreCase matches the term regardless of case.
+	IgnoreCase bool
+
+	// Overlapping also finds occurrences that start inside a previous
+	// occurrence, such as both "aa" in "aaa". Overlapping occurrences are
+	// colored as a single span.
+	Overlapping bool
+
+	// MergeAdjacent colors occurrences that directly follow each other as
+	// a single span instead of one span per occurrence.
+	MergeAdjacent bool
+}
+
+// HighlightMatches wraps each occurrence of term in s with the color c,
+// leaving the rest of s plain. Like all colored output this respects
+// NoColor and the color's own settings.
+func HighlightMatches(s, term string, c *Color) string {
+	return HighlightMatchesOpts(s, term, c, HighlightOptions{})
+}
+
+// HighlightMatchesOpts is like HighlightMatches but with the matching
+// behavior controlled by opts.
+func HighlightMatchesOpts(s, term string, c *Color, opts HighlightOptions) string {
+	if term == "" {
+		return s
+	}
+
+	find := func(s string) []int {
+		idx := strings.Index(s, term)
+		if idx == -1 {
+			return nil
+		}
+
+		return []int{idx, idx + len(term)}
+	}
+	if opts.IgnoreCase {
+		find = regexp.MustCompile("(?i)" + regexp.QuoteMeta(term)).FindStringIndex
+	}
+
+	var spans [][]int
+	for from := 0; from < len(s); {
+		loc := find(s[from:])
+		if loc == nil {
+			break
+		}
+
+		start, end := from+loc[0], from+loc[1]
+		spans = append(spans, []int{start, end})
+
+		from = end
+		if opts.Overlapping {
+			_, size := utf8.DecodeRuneInString(s[start:])
+			from = start + size
+		}
+	}
+
+	return highlightSpans(s, spans, c, opts.MergeAdjacent)
+}
+
+// HighlightRegexp wraps each match of re in s with the color c, leaving
+// the rest of s plain.
+func HighlightRegexp(s string, re *regexp.Regexp, c *Color) string {
+	return highlightSpans(s, re.FindAllStringIndex(s, -1), c, false)
+}
+
+// highlightSpans colors the given sorted [start, end) byte ranges of s.
+// Overlapping ranges are always merged since colors can't nest, touching
+// ranges only if mergeAdjacent is set.
+func highlightSpans(s string, spans [][]int, c *Color, mergeAdjacent bool) string {
+	var merged [][]int
+	for _, span := range spans {
+		if span[0] == span[1] {
+			continue
+		}
+
+		if n := len(merged); n > 0 {
+			last := merged[n-1]
+			if span[0] < last[1] || (mergeAdjacent && span[0] == last[1]) {
+				if span[1] > last[1] {
+					last[1] = span[1]
+				}
+				continue
+			}
+		}
+
+		merged = append(merged, []int{span[0], span[1]})
+	}
+
+	var b strings.Builder
+	prev := 0
+	for _, span := range merged {
+		b.WriteString(s[prev:span[0]])
+		b.WriteString(c.Sprint(s[span[0]:span[1]]))
+		prev = span[1]
+	}
+	b.WriteString(s[prev:])
+
+	return b.String()
+}
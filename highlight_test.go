@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestHighlightMatches(t *testing.T) {
+	c := NewColor(ColorFgRed)
+	c.EnableColor()
+
+	testCases := []struct {
+		name     string
+		s, term  string
+		opts     HighlightOptions
+		expected string
+	}{
+		{
+			"Multiple",
+			"net-a net-b", "net", HighlightOptions{},
+			"\x1b[31mnet\x1b[0m-a \x1b[31mnet\x1b[0m-b",
+		},
+		{
+			"NoMatch",
+			"network", "disk", HighlightOptions{},
+			"network",
+		},
+		{
+			"EmptyTerm",
+			"network", "", HighlightOptions{},
+			"network",
+		},
+		{
+			"CaseSensitive",
+			"Net net", "net", HighlightOptions{},
+			"Net \x1b[31mnet\x1b[0m",
+		},
+		{
+			"IgnoreCase",
+			"Net nET", "net", HighlightOptions{IgnoreCase: true},
+			"\x1b[31mNet\x1b[0m \x1b[31mnET\x1b[0m",
+		},
+		{
+			"Adjacent",
+			"abab", "ab", HighlightOptions{},
+			"\x1b[31mab\x1b[0m\x1b[31mab\x1b[0m",
+		},
+		{
+			"MergeAdjacent",
+			"abab", "ab", HighlightOptions{MergeAdjacent: true},
+			"\x1b[31mabab\x1b[0m",
+		},
+		{
+			"Overlapping",
+			"aaab", "aa", HighlightOptions{Overlapping: true},
+			"\x1b[31maaa\x1b[0mb",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := HighlightMatchesOpts(tc.s, tc.term, c, tc.opts)
+			if result != tc.expected {
+				t.Fatalf("bad: %#v", result)
+			}
+		})
+	}
+}
+
+func TestHighlightMatches_noColor(t *testing.T) {
+	c := NewColor(ColorFgRed)
+	c.DisableColor()
+
+	if result := HighlightMatches("net-a net-b", "net", c); result != "net-a net-b" {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestHighlightRegexp(t *testing.T) {
+	c := NewColor(ColorFgRed)
+	c.EnableColor()
+
+	result := HighlightRegexp("v1.2 and v3.4", regexp.MustCompile(`v\d+`), c)
+	expected := "\x1b[31mv1\x1b[0m.2 and \x1b[31mv3\x1b[0m.4"
+	if result != expected {
+		t.Fatalf("bad: %#v", result)
+	}
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatPanic formats a recovered panic value and the stack trace captured
+// with runtime/debug.Stack for display. The panic message is shown in bold
+// red and the stack frames are dimmed, unless NoColor is set. The stack
+// passed in is not modified so the raw trace stays available for crash
+// reports.
+func FormatPanic(recovered interface{}, stack []byte) string {
+	message := NewColor(ColorFgRed, ColorBold)
+	frame := NewColor(ColorFaint)
+
+	var b strings.Builder
+	b.WriteString(message.Sprint(fmt.Sprintf("panic: %v", recovered)))
+	b.WriteString("\n")
+
+	trace := strings.TrimRight(string(stack), "\n")
+	if trace == "" {
+		return b.String()
+	}
+
+	b.WriteString("\n")
+	for _, line := range strings.Split(trace, "\n") {
+		b.WriteString(frame.Sprint(line))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// PanicError is the value that CLI.RunContext re-raises the panic of a
+// command with when the command ran on its own goroutine because
+// ShutdownGrace is set. It keeps the original panic value along with the
+// stack of the goroutine that panicked, which would be lost otherwise.
+type PanicError struct {
+	// Value is the value the command panicked with.
+	Value interface{}
+
+	// Stack is the stack trace of the panic as returned by
+	// runtime/debug.Stack.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", e.Value, e.Stack)
+}
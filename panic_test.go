@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"testing"
+)
+
+const testPanicStack = `goroutine 1 [running]:
+main.main()
+	/tmp/main.go:5 +0x1d
+`
+
+func TestFormatPanic(t *testing.T) {
+	withColor(t)
+
+	expected := "\x1b[31;1mpanic: boom\x1b[0;22m\n\n" +
+		"\x1b[2mgoroutine 1 [running]:\x1b[22m\n" +
+		"\x1b[2mmain.main()\x1b[22m\n" +
+		"\x1b[2m\t/tmp/main.go:5 +0x1d\x1b[22m\n"
+	if result := FormatPanic("boom", []byte(testPanicStack)); result != expected {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestFormatPanic_noColor(t *testing.T) {
+	old := NoColor
+	NoColor = true
+	defer func() { NoColor = old }()
+
+	expected := "panic: boom\n\n" + testPanicStack
+	if result := FormatPanic("boom", []byte(testPanicStack)); result != expected {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	if result := FormatPanic("boom", nil); result != "panic: boom\n" {
+		t.Fatalf("bad: %#v", result)
+	}
+}
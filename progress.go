@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	// progressBarWidth is the number of columns of the bar itself.
+	progressBarWidth = 30
+
+	// progressLineStep is the percentage a bar must advance before another
+	// plain line is printed for it when not rendering in place.
+	progressLineStep = 10
+)
+
+// MultiProgress renders several progress bars that are updated
+// independently, for example one per parallel download.
+//
+// When InPlace is true all bars are redrawn in place on every update,
+// moving the cursor up over the previously drawn bars, which is what you
+// want on a terminal. Otherwise a plain line is printed for a bar every
+// time it advances by another 10% and when it is done, so that log files
+// and pipes stay readable.
+//
+// A MultiProgress and its bars are safe for concurrent use.
+type MultiProgress struct {
+	Writer  io.Writer
+	InPlace bool
+
+	l     sync.Mutex
+	bars  []*ProgressBar
+	drawn int
+}
+
+// NewMultiProgress returns a MultiProgress writing to w that renders the
+// bars in place if w is a terminal.
+func NewMultiProgress(w io.Writer) *MultiProgress {
+	return &MultiProgress{
+		Writer:  w,
+		InPlace: isTerminalWriter(w),
+	}
+}
+
+// AddBar adds a bar for a task of total units, shown with label, below the
+// existing bars.
+func (m *MultiProgress) AddBar(total int64, label string) *ProgressBar {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	b := &ProgressBar{m: m, label: label, total: total}
+	m.bars = append(m.bars, b)
+	m.draw(b)
+
+	return b
+}
+
+// ProgressBar is a single bar added with MultiProgress.AddBar.
+type ProgressBar struct {
+	m       *MultiProgress
+	label   string
+	total   int64
+	current int64
+	printed int
+	done    bool
+}
+
+// Add advances the bar by n units.
+func (b *ProgressBar) Add(n int64) {
+	b.m.l.Lock()
+	defer b.m.l.Unlock()
+
+	b.set(b.current + n)
+}
+
+// Set sets the progress of the bar to n units.
+func (b *ProgressBar) Set(n int64) {
+	b.m.l.Lock()
+	defer b.m.l.Unlock()
+
+	b.set(n)
+}
+
+// Done marks the bar as complete. Any further updates are ignored.
+func (b *ProgressBar) Done() {
+	b.m.l.Lock()
+	defer b.m.l.Unlock()
+
+	if b.done {
+		return
+	}
+	if b.total > 0 {
+		b.current = b.total
+	}
+	b.done = true
+	b.m.draw(b)
+}
+
+func (b *ProgressBar) set(n int64) {
+	if b.done {
+		return
+	}
+
+	if n < 0 {
+		n = 0
+	}
+	if b.total > 0 && n > b.total {
+		n = b.total
+	}
+	b.current = n
+	b.m.draw(b)
+}
+
+// percent returns how far the bar is, from 0 to 100.
+func (b *ProgressBar) percent() int {
+	if b.total <= 0 {
+		if b.done {
+			return 100
+		}
+		return 0
+	}
+
+	return int(b.current * 100 / b.total)
+}
+
+// draw renders the update of b. The lock must be held.
+func (m *MultiProgress) draw(b *ProgressBar) {
+	labelWidth := 0
+	for _, bar := range m.bars {
+		if w := VisibleWidth(bar.label); w > labelWidth {
+			labelWidth = w
+		}
+	}
+
+	if !m.InPlace {
+		// Only print a line when the bar has advanced far enough.
+		step := b.percent() / progressLineStep
+		if step <= b.printed && !b.done {
+			return
+		}
+		if step < progressLineStep && b.done {
+			step = progressLineStep
+		}
+		b.printed = step
+
+		fmt.Fprintf(m.Writer, "%s\n", m.line(b, labelWidth))
+		return
+	}
+
+	if m.drawn > 0 {
+		fmt.Fprintf(m.Writer, "%s[%dA", colorEscape, m.drawn)
+	}
+	for _, bar := range m.bars {
+		fmt.Fprintf(m.Writer, "\r%s[K%s\n", colorEscape, m.line(bar, labelWidth))
+	}
+	m.drawn = len(m.bars)
+}
+
+// line returns the rendered bar, with the label padded to labelWidth.
+func (m *MultiProgress) line(b *ProgressBar, labelWidth int) string {
+	label := b.label + strings.Repeat(" ", labelWidth-VisibleWidth(b.label))
+	percent := b.percent()
+
+	if !m.InPlace {
+		return fmt.Sprintf("%s  %3d%% (%d/%d)", label, percent, b.current, b.total)
+	}
+
+	filled := percent * progressBarWidth / 100
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+
+	return fmt.Sprintf("%s [%s] %3d%% (%d/%d)", label, bar, percent, b.current, b.total)
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMultiProgress_inPlace(t *testing.T) {
+	buf := new(bytes.Buffer)
+	m := &MultiProgress{Writer: buf, InPlace: true}
+
+	a := m.AddBar(100, "a.tar")
+	b := m.AddBar(10, "b.iso")
+
+	buf.Reset()
+	a.Add(50)
+
+	expected := "\x1b[2A" +
+		"\r\x1b[Ka.tar [===============>              ]  50% (50/100)\n" +
+		"\r\x1b[Kb.iso [>                             ]   0% (0/10)\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+
+	buf.Reset()
+	b.Done()
+	if !strings.Contains(buf.String(), "b.iso [==============================] 100% (10/10)\n") {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestMultiProgress_inPlaceLineCount(t *testing.T) {
+	buf := new(bytes.Buffer)
+	m := &MultiProgress{Writer: buf, InPlace: true}
+
+	var bars []*ProgressBar
+	for _, label := range []string{"a", "b", "c"} {
+		bars = append(bars, m.AddBar(4, label))
+	}
+
+	var wg sync.WaitGroup
+	for _, bar := range bars {
+		wg.Add(1)
+		go func(bar *ProgressBar) {
+			defer wg.Done()
+			for i := 0; i < 4; i++ {
+				bar.Add(1)
+			}
+			bar.Done()
+		}(bar)
+	}
+	wg.Wait()
+
+	// Adding the bars draws 1+2+3 lines, then each Add and Done redraws
+	// all 3 bars after moving the cursor up over them.
+	updates := 12 + len(bars)
+	if n := strings.Count(buf.String(), "\n"); n != 6+3*updates {
+		t.Fatalf("bad line count: %d", n)
+	}
+	if n := strings.Count(buf.String(), "\x1b[3A"); n != updates {
+		t.Fatalf("bad cursor up count: %d", n)
+	}
+}
+
+func TestMultiProgress_lines(t *testing.T) {
+	buf := new(bytes.Buffer)
+	m := NewMultiProgress(buf)
+	if m.InPlace {
+		t.Fatal("buffer should not render in place")
+	}
+
+	a := m.AddBar(100, "a")
+	b := m.AddBar(100, "bb")
+	a.Add(5)
+	a.Add(10)
+	a.Add(4)
+	b.Set(25)
+	a.Done()
+	a.Add(1)
+
+	expected := "a    15% (15/100)\n" +
+		"bb   25% (25/100)\n" +
+		"a   100% (100/100)\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"io"
+	"os"
+)
+
+// ResolveStdinArg implements the convention of treating an argument of "-"
+// as standard input: it returns stdin if arg is "-" and opens the file arg
+// otherwise. Commands should pass the reader given to them through
+// CommandStdin as stdin.
+//
+// If the result is a file, it is an *os.File that the caller must close.
+// Closing stdin is left to its owner.
+func ResolveStdinArg(arg string, stdin io.Reader) (io.Reader, error) {
+	if arg == "-" {
+		return stdin, nil
+	}
+
+	f, err := os.Open(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveStdinArg(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input")
+	if err := os.WriteFile(path, []byte("from file"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testCases := []struct {
+		arg      string
+		expected string
+	}{
+		{"-", "from stdin"},
+		{path, "from file"},
+	}
+
+	for _, tc := range testCases {
+		r, err := ResolveStdinArg(tc.arg, strings.NewReader("from stdin"))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+
+		if string(data) != tc.expected {
+			t.Fatalf("%q: bad: %#v", tc.arg, string(data))
+		}
+	}
+}
+
+func TestResolveStdinArg_missing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing")
+	if _, err := ResolveStdinArg(path, strings.NewReader("")); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestCLIRun_stdin(t *testing.T) {
+	var input string
+	command := &stdinCommand{}
+	command.run = func(stdin io.Reader) int {
+		r, err := ResolveStdinArg("-", stdin)
+		if err != nil {
+			return 1
+		}
+
+		data, _ := io.ReadAll(r)
+		input = string(data)
+		return 0
+	}
+
+	cli := &CLI{
+		Args: []string{"foo", "-"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		Stdin: strings.NewReader("hello"),
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+	if input != "hello" {
+		t.Fatalf("bad: %#v", input)
+	}
+}
+
+func TestCLIRun_stdinDefault(t *testing.T) {
+	command := new(MockCommandStdin)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if command.Stdin != io.Reader(os.Stdin) {
+		t.Fatalf("bad: %#v", command.Stdin)
+	}
+}
+
+// stdinCommand is a command that runs a function with its stdin.
+type stdinCommand struct {
+	MockCommandStdin
+
+	run func(stdin io.Reader) int
+}
+
+func (c *stdinCommand) Run(args []string) int {
+	c.MockCommandStdin.Run(args)
+	return c.run(c.Stdin)
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"strings"
+)
+
+// suggestCommand returns the visible command closest to the unknown
+// command that was attempted, if it is within SuggestDistance edits.
+// The attempted command is the subcommand and the arguments following it
+// up to the first flag, so that nested commands can be compared by their
+// full name.
+func (c *CLI) suggestCommand() (string, bool) {
+	if c.SuggestDistance <= 0 || c.Subcommand() == "" {
+		return "", false
+	}
+
+	attempted := strings.Fields(c.Subcommand())
+	for _, arg := range c.SubcommandArgs() {
+		if arg == "" || arg[0] == '-' || strings.ContainsRune(arg, ' ') {
+			break
+		}
+
+		attempted = append(attempted, arg)
+	}
+
+	var best string
+	bestDistance := c.SuggestDistance + 1
+	c.commandTree.Walk(func(k string, raw interface{}) bool {
+		if _, ok := c.commandHidden[k]; ok || k == "" {
+			return false
+		}
+
+		words := strings.Fields(k)
+		if len(words) > len(attempted) {
+			return false
+		}
+
+		d := levenshtein(strings.Join(attempted[:len(words)], " "), k)
+
+		// Prefer the closest command, and the most specific one if
+		// several are just as close.
+		if d < bestDistance || (best != "" && d == bestDistance &&
+			len(words) > len(strings.Fields(best))) {
+			best, bestDistance = k, d
+		}
+
+		return false
+	})
+
+	return best, best != ""
+}
+
+// levenshtein returns the number of single character insertions,
+// deletions and substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+
+	return a
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"foo", "foo", 0},
+		{"foo", "", 3},
+		{"", "foo", 3},
+		{"kitten", "sitting", 3},
+		{"lsit", "list", 2},
+		{"stauts", "status", 2},
+		{"héllo", "hello", 1},
+	}
+
+	for _, tc := range testCases {
+		if d := levenshtein(tc.a, tc.b); d != tc.distance {
+			t.Fatalf("%q, %q: bad: %d", tc.a, tc.b, d)
+		}
+	}
+}
+
+func TestCLIRun_suggest(t *testing.T) {
+	testCases := []struct {
+		args       []string
+		distance   int
+		suggestion string
+	}{
+		{[]string{"stauts"}, 2, "status"},
+		{[]string{"stat"}, 2, "status"},
+		{[]string{"remot", "add", "-f"}, 2, "remote add"},
+		{[]string{"remot", "ad"}, 2, "remote"},
+		{[]string{"remot", "zzz"}, 2, "remote"},
+		{[]string{"xyz"}, 2, ""},
+		{[]string{"secrte"}, 2, ""},
+		{[]string{"stauts"}, 0, ""},
+		{[]string{"stat"}, 1, ""},
+	}
+
+	for _, tc := range testCases {
+		buf := new(bytes.Buffer)
+		cli := &CLI{
+			Args: tc.args,
+			Commands: map[string]CommandFactory{
+				"status": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+				"remote add": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+				"secret": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+			},
+			HiddenCommands:  []string{"secret"},
+			SuggestDistance: tc.distance,
+			ErrorWriter:     buf,
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if exitCode != 127 {
+			t.Fatalf("Args: %#v. Bad: %d", tc.args, exitCode)
+		}
+
+		hasSuggestion := strings.HasPrefix(buf.String(), "Did you mean")
+		if tc.suggestion == "" && hasSuggestion {
+			t.Fatalf("Args: %#v. Bad: %#v", tc.args, buf.String())
+		}
+		if tc.suggestion != "" && !strings.HasPrefix(buf.String(),
+			"Did you mean '"+tc.suggestion+"'?\n\nUsage: ") {
+			t.Fatalf("Args: %#v. Bad: %#v", tc.args, buf.String())
+		}
+	}
+}
+
+func TestNewCLI_suggestDistance(t *testing.T) {
+	if cli := NewCLI("app", "1.0.0"); cli.SuggestDistance != 2 {
+		t.Fatalf("bad: %d", cli.SuggestDistance)
+	}
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// terminalBackgroundQuery asks the terminal for its background color with
+// the OSC 11 sequence and returns the response. It is a variable so tests
+// can replace it.
+var terminalBackgroundQuery = queryTerminalBackground
+
+// TerminalBackgroundIsDark reports whether the background of the terminal
+// is dark, so that colors that are readable on it can be picked. The second
+// result is false if that can't be determined, in which case the first is
+// meaningless.
+//
+// The terminal is asked for its background color first, waiting briefly
+// for an answer. If it doesn't answer, or stdin and stdout aren't both a
+// terminal, the COLORFGBG environment variable set by some terminals is
+// used instead.
+func TerminalBackgroundIsDark() (bool, bool) {
+	if response, ok := terminalBackgroundQuery(); ok {
+		if rgb, ok := parseOSC11Response(response); ok {
+			return !badgeIsLight(rgb), true
+		}
+	}
+
+	return colorFGBGIsDark(os.Getenv("COLORFGBG"))
+}
+
+// queryTerminalBackground sends the OSC 11 query to the terminal and reads
+// the response, giving up after about a tenth of a second of silence.
+func queryTerminalBackground() (string, bool) {
+	if !isTerminalFile(os.Stdin) || !isTerminalFile(os.Stdout) {
+		return "", false
+	}
+
+	restore, err := terminalRawMode(os.Stdin, "min", "0", "time", "1")
+	if err != nil {
+		return "", false
+	}
+	defer restore()
+
+	if _, err := os.Stdout.WriteString(colorEscape + "]11;?\a"); err != nil {
+		return "", false
+	}
+
+	var response []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n == 0 || err != nil {
+			return "", false
+		}
+
+		response = append(response, b[0])
+		if b[0] == '\a' || strings.HasSuffix(string(response), colorEscape+"\\") {
+			return string(response), true
+		}
+	}
+}
+
+// parseOSC11Response parses a response to the OSC 11 query such as
+// "\x1b]11;rgb:ffff/ffff/ffff\x07" into the color it reports.
+func parseOSC11Response(response string) ([3]uint8, bool) {
+	var rgb [3]uint8
+
+	idx := strings.Index(response, "rgb:")
+	if idx == -1 {
+		return rgb, false
+	}
+	value := strings.TrimRight(response[idx+len("rgb:"):], "\a\\"+colorEscape)
+
+	parts := strings.Split(value, "/")
+	if len(parts) != 3 {
+		return rgb, false
+	}
+
+	for i, part := range parts {
+		if len(part) == 0 || len(part) > 4 {
+			return rgb, false
+		}
+
+		v, err := strconv.ParseUint(part, 16, 16)
+		if err != nil {
+			return rgb, false
+		}
+
+		// Each component has 1 to 4 hex digits, scale it to 8 bits.
+		max := uint64(1)<<(4*uint(len(part))) - 1
+		rgb[i] = uint8(v * 255 / max)
+	}
+
+	return rgb, true
+}
+
+// colorFGBGIsDark reports whether the background in a COLORFGBG value such
+// as "15;0" is dark. The background is the last field, a number of one of
+// the 16 base colors where 0 to 6 and 8 are dark.
+func colorFGBGIsDark(value string) (bool, bool) {
+	if value == "" {
+		return false, false
+	}
+
+	fields := strings.Split(value, ";")
+	bg, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || bg < 0 || bg > 15 {
+		return false, false
+	}
+
+	return bg <= 6 || bg == 8, true
+}
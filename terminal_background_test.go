@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestTerminalBackgroundIsDark(t *testing.T) {
+	old := terminalBackgroundQuery
+	defer func() { terminalBackgroundQuery = old }()
+
+	testCases := []struct {
+		response  string
+		colorFGBG string
+		dark      bool
+		known     bool
+	}{
+		// The terminal answers
+		{"\x1b]11;rgb:0000/0000/0000\x07", "", true, true},
+		{"\x1b]11;rgb:ffff/ffff/ffff\x1b\\", "15;0", false, true},
+		{"\x1b]11;rgb:28/2c/34\x07", "", true, true},
+		{"\x1b]11;rgb:fdf6/f6f6/e3e3\x07", "", false, true},
+
+		// COLORFGBG
+		{"", "15;0", true, true},
+		{"", "0;15", false, true},
+		{"", "12;8", true, true},
+		{"", "0;7", false, true},
+		{"", "15;default;0", true, true},
+		{"garbage", "0;11", false, true},
+
+		// Unknown
+		{"", "", false, false},
+		{"", "15;default", false, false},
+		{"", "0;42", false, false},
+	}
+
+	for _, tc := range testCases {
+		terminalBackgroundQuery = func() (string, bool) {
+			return tc.response, tc.response != ""
+		}
+		t.Setenv("COLORFGBG", tc.colorFGBG)
+
+		dark, known := TerminalBackgroundIsDark()
+		if dark != tc.dark || known != tc.known {
+			t.Fatalf("%q, %q: bad: %v, %v", tc.response, tc.colorFGBG, dark, known)
+		}
+	}
+}
+
+func TestParseOSC11Response(t *testing.T) {
+	testCases := []struct {
+		response string
+		rgb      [3]uint8
+		ok       bool
+	}{
+		{"\x1b]11;rgb:ffff/8080/0000\x07", [3]uint8{255, 128, 0}, true},
+		{"\x1b]11;rgb:ff/80/00\x1b\\", [3]uint8{255, 128, 0}, true},
+		{"\x1b]11;rgb:f/8/0\x07", [3]uint8{255, 136, 0}, true},
+		{"\x1b]11;rgb:ffff/ffff\x07", [3]uint8{}, false},
+		{"\x1b]11;rgb:xyz/0/0\x07", [3]uint8{}, false},
+		{"\x1b]11;?\x07", [3]uint8{}, false},
+	}
+
+	for _, tc := range testCases {
+		rgb, ok := parseOSC11Response(tc.response)
+		if ok != tc.ok || (ok && rgb != tc.rgb) {
+			t.Fatalf("%q: bad: %v, %v", tc.response, rgb, ok)
+		}
+	}
+}
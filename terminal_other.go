@@ -0,0 +1,20 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris || zos)
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!zos
+
+package cli
+
+import (
+	"errors"
+	"os"
+)
+
+// terminalRawMode isn't supported on this platform, so ReadlineUi always
+// reads lines like BasicUi and the terminal can't be queried.
+func terminalRawMode(f *os.File, args ...string) (func(), error) {
+	return nil, errors.New("raw terminal input is not supported on this platform")
+}
+
+// terminalMode isn't supported on this platform.
+func terminalMode(f *os.File, args ...string) (func(), error) {
+	return nil, errors.New("terminal modes are not supported on this platform")
+}
@@ -0,0 +1,44 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris || zos
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris zos
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// terminalRawMode switches the terminal f to pass on every key as it is
+// typed, without echoing it and without generating signals, and returns a
+// function that restores the previous mode. The args are passed on to stty
+// to configure how reads wait for input, such as "min", "1".
+func terminalRawMode(f *os.File, args ...string) (func(), error) {
+	return terminalMode(f, append([]string{"-icanon", "-echo", "-isig"}, args...)...)
+}
+
+// terminalMode applies the stty args to the terminal f and returns a
+// function that restores the previous mode.
+func terminalMode(f *os.File, args ...string) (func(), error) {
+	state, err := stty(f, "-g")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := stty(f, args...); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		stty(f, strings.TrimSpace(state))
+	}, nil
+}
+
+// stty runs stty with the given arguments on the terminal f.
+func stty(f *os.File, args ...string) (string, error) {
+	cmd := exec.Command(sttyBin, args...)
+	cmd.Stdin = f
+
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"io"
+	"strings"
+)
+
+const (
+	// titlePush and titlePop save and restore the terminal title using the
+	// xterm title stack.
+	titlePush = colorEscape + "[22;0t"
+	titlePop  = colorEscape + "[23;0t"
+)
+
+// SetTerminalTitle sets the title of the terminal window or tab to title
+// using the OSC 0 escape sequence. It does nothing if w isn't a terminal
+// or colored output is disabled, since the sequence would end up as
+// garbage in files and pipes.
+func SetTerminalTitle(w io.Writer, title string) {
+	if !isTerminalWriter(w) || globalNoColorFor(w) {
+		return
+	}
+
+	io.WriteString(w, terminalTitleSequence(title))
+}
+
+// terminalTitleSequence returns the escape sequence setting the title.
+// Control characters are removed from the title so that it can't end the
+// sequence early.
+func terminalTitleSequence(title string) string {
+	title = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+
+		return r
+	}, title)
+
+	return colorEscape + "]0;" + title + "\a"
+}
+
+// pushTerminalTitle saves the current title of the terminal and sets a new
+// one. It returns a function that restores the saved title.
+func pushTerminalTitle(w io.Writer, title string) func() {
+	if !isTerminalWriter(w) || globalNoColorFor(w) {
+		return func() {}
+	}
+
+	io.WriteString(w, titlePush+terminalTitleSequence(title))
+	return func() {
+		io.WriteString(w, titlePop)
+	}
+}
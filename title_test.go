@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTerminalTitleSequence(t *testing.T) {
+	testCases := []struct {
+		title    string
+		expected string
+	}{
+		{"app foo - running", "\x1b]0;app foo - running\a"},
+		{"bad\a\x1b]0;title\n", "\x1b]0;bad]0;title\a"},
+	}
+
+	for _, tc := range testCases {
+		if result := terminalTitleSequence(tc.title); result != tc.expected {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+}
+
+func TestSetTerminalTitle_notTerminal(t *testing.T) {
+	withColor(t)
+
+	buf := new(bytes.Buffer)
+	SetTerminalTitle(buf, "app")
+	pushTerminalTitle(buf, "app")()
+
+	if buf.Len() != 0 {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
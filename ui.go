@@ -42,10 +42,22 @@ type Ui interface {
 // BasicUi is an implementation of Ui that just outputs to the given
 // writer. This UI is not threadsafe by default, but you can wrap it
 // in a ConcurrentUi to make it safe.
+//
+// AskSecret turns off the echo of the terminal while reading if Reader is
+// a terminal, and reads from Reader like Ask otherwise.
+//
+// Input is read through a buffer that is kept across calls, so answers
+// that arrive together, such as from a pipe, are all returned in turn.
+// A Reader of a type that can't be compared, such as a func, can't be
+// told apart from a new one, so it gets a new buffer on every call. The
+// query is followed by a space, and not shown at all if it is empty.
 type BasicUi struct {
 	Reader      io.Reader
 	Writer      io.Writer
 	ErrorWriter io.Writer
+
+	reader *bufio.Reader
+	input  io.Reader
 }
 
 func (u *BasicUi) Ask(query string) (string, error) {
@@ -57,10 +69,20 @@ func (u *BasicUi) AskSecret(query string) (string, error) {
 }
 
 func (u *BasicUi) ask(query string, secret bool) (string, error) {
-	if _, err := fmt.Fprint(u.Writer, query+" "); err != nil {
-		return "", err
+	if query != "" {
+		if _, err := fmt.Fprint(u.Writer, query+" "); err != nil {
+			return "", err
+		}
 	}
 
+	// Keep the reader across calls so that input it buffered ahead isn't
+	// lost for the next question.
+	if u.reader == nil || !sameValue(u.input, u.Reader) {
+		u.reader = bufio.NewReader(u.Reader)
+		u.input = u.Reader
+	}
+	r := u.reader
+
 	// Register for interrupts so that we can catch it and immediately
 	// return...
 	sigCh := make(chan os.Signal, 1)
@@ -73,13 +95,14 @@ func (u *BasicUi) ask(query string, secret bool) (string, error) {
 	go func() {
 		var line string
 		var err error
-		if secret && IsTerminal(os.Stdin.Fd()) {
-			line, err = SpeakAsk("")
+		if f, ok := u.Reader.(*os.File); ok && secret && isTerminalFile(f) {
+			line, err = u.readSecret(f)
 		} else {
-			r := bufio.NewReader(u.Reader)
 			line, err = r.ReadString('\n')
 		}
-		if err != nil {
+
+		// A last line without a newline is still an answer.
+		if err != nil && (err != io.EOF || line == "") {
 			errCh <- err
 			return
 		}
@@ -93,6 +116,10 @@ func (u *BasicUi) ask(query string, secret bool) (string, error) {
 	case line := <-lineCh:
 		return line, nil
 	case <-sigCh:
+		// The read is still going on in the background, so the next
+		// question gets a reader of its own.
+		u.reader = nil
+
 		// Print a newline so that any further output starts properly
 		// on a new line.
 		fmt.Fprintln(u.Writer)
@@ -101,6 +128,25 @@ func (u *BasicUi) ask(query string, secret bool) (string, error) {
 	}
 }
 
+// readSecret reads a line from the terminal f with echo turned off.
+func (u *BasicUi) readSecret(f *os.File) (string, error) {
+	if f == os.Stdin {
+		return SpeakAsk("")
+	}
+
+	restore, err := terminalMode(f, "-echo")
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+
+	// The newline typed by the user isn't echoed either.
+	fmt.Fprintln(u.Writer)
+	return line, err
+}
+
 func (u *BasicUi) Error(message string) {
 	w := u.Writer
 	if u.ErrorWriter != nil {
@@ -124,7 +170,10 @@ func (u *BasicUi) Warn(message string) {
 	u.Error(message)
 }
 
-// PrefixedUi is an implementation of Ui that prefixes messages.
+// PrefixedUi is an implementation of Ui that prefixes messages, for
+// example to tag the output of one of several subsystems sharing a
+// terminal with "[db] ". Every line of a multi-line message is prefixed.
+// Empty messages are passed on without a prefix.
 type PrefixedUi struct {
 	AskPrefix       string
 	AskSecretPrefix string
@@ -136,49 +185,66 @@ type PrefixedUi struct {
 }
 
 func (u *PrefixedUi) Ask(query string) (string, error) {
-	if query != "" {
-		query = fmt.Sprintf("%s%s", u.AskPrefix, query)
-	}
+	query = prefixLines(u.AskPrefix, query)
 
 	return u.Ui.Ask(query)
 }
 
 func (u *PrefixedUi) AskSecret(query string) (string, error) {
-	if query != "" {
-		query = fmt.Sprintf("%s%s", u.AskSecretPrefix, query)
-	}
+	query = prefixLines(u.AskSecretPrefix, query)
 
 	return u.Ui.AskSecret(query)
 }
 
 func (u *PrefixedUi) Error(message string) {
-	if message != "" {
-		message = fmt.Sprintf("%s%s", u.ErrorPrefix, message)
-	}
+	message = prefixLines(u.ErrorPrefix, message)
 
 	u.Ui.Error(message)
 }
 
 func (u *PrefixedUi) Info(message string) {
-	if message != "" {
-		message = fmt.Sprintf("%s%s", u.InfoPrefix, message)
-	}
+	message = prefixLines(u.InfoPrefix, message)
 
 	u.Ui.Info(message)
 }
 
 func (u *PrefixedUi) Output(message string) {
-	if message != "" {
-		message = fmt.Sprintf("%s%s", u.OutputPrefix, message)
-	}
+	message = prefixLines(u.OutputPrefix, message)
 
 	u.Ui.Output(message)
 }
 
 func (u *PrefixedUi) Warn(message string) {
-	if message != "" {
-		message = fmt.Sprintf("%s%s", u.WarnPrefix, message)
-	}
+	message = prefixLines(u.WarnPrefix, message)
 
 	u.Ui.Warn(message)
 }
+
+// prefixLines prefixes every line of message with prefix. A trailing
+// newline doesn't start another line.
+func prefixLines(prefix, message string) string {
+	if message == "" || prefix == "" {
+		return message
+	}
+
+	lines := strings.Split(message, "\n")
+	for i, line := range lines {
+		if i == len(lines)-1 && line == "" {
+			break
+		}
+
+		lines[i] = prefix + line
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// isTerminalWriter returns true if w is a file that refers to a terminal.
+func isTerminalWriter(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	return isTerminalFile(f)
+}
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"io"
+	"strings"
+)
+
+// AskMultiline asks the user for input that spans several lines, such as
+// the body of a message, using ui. The query is shown before the first
+// line, and the following lines are asked for with an empty query. Lines
+// are read until a line equal to terminator, such as ".", or the end of
+// the input, and returned joined with newlines, without the terminator
+// line.
+func AskMultiline(ui Ui, query, terminator string) (string, error) {
+	var lines []string
+	for {
+		line, err := ui.Ask(query)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if line == terminator {
+			break
+		}
+
+		lines = append(lines, line)
+		query = ""
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
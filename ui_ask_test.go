@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAskMultiline(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"terminator", "first line\n\nthird line\n.\nignored\n", "first line\n\nthird line"},
+		{"eof", "first line\nsecond line\n", "first line\nsecond line"},
+		{"eof without newline", "first line\nsecond line", "first line\nsecond line"},
+		{"empty", ".\n", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ui := NewMockUi()
+			ui.InputReader = strings.NewReader(tc.input)
+
+			result, err := AskMultiline(ui, "Message:", ".")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if result != tc.expected {
+				t.Fatalf("bad: %#v", result)
+			}
+			if ui.OutputWriter.String() != "Message:" {
+				t.Fatalf("bad: %#v", ui.OutputWriter.String())
+			}
+		})
+	}
+}
+
+func TestAskMultiline_basicUi(t *testing.T) {
+	writer := new(bytes.Buffer)
+	ui := &BasicUi{
+		Reader: strings.NewReader("first line\nsecond line"),
+		Writer: writer,
+	}
+
+	result, err := AskMultiline(ui, "Message:", ".")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != "first line\nsecond line" {
+		t.Fatalf("bad: %#v", result)
+	}
+	if writer.String() != "Message: " {
+		t.Fatalf("bad: %#v", writer.String())
+	}
+}
+
+func TestAskMultiline_uncomparableReader(t *testing.T) {
+	input := strings.NewReader("first line\n.\n")
+	reader := funcReader(input.Read)
+
+	mock := NewMockUi()
+	mock.InputReader = reader
+	for _, ui := range []Ui{mock, &BasicUi{Reader: reader, Writer: new(bytes.Buffer)}} {
+		input.Reset("first line\n.\n")
+
+		// The reader can't be compared, so every line gets a new buffer
+		// and the input the first one read ahead is lost, but nothing
+		// panics.
+		result, err := AskMultiline(ui, "Message:", ".")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if result != "first line" {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+}
+
+func TestAskMultiline_error(t *testing.T) {
+	ui := NewMockUi()
+	ui.InputReader = &errReader{err: errors.New("broken")}
+
+	if _, err := AskMultiline(ui, "Message:", "."); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+// funcReader is a reader of a type that can't be compared.
+type funcReader func([]byte) (int, error)
+
+func (f funcReader) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// errReader fails every read with err.
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
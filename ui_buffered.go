@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"sync"
+)
+
+// BufferedUi is a wrapper around a Ui (and implements that interface)
+// that holds back all output until Flush is called, so that a command can
+// emit its output all-or-nothing. Discard drops the held back output, for
+// example when the command fails halfway.
+//
+// Ask and AskSecret flush the held back output before prompting, so that
+// the user sees everything that led up to the question.
+type BufferedUi struct {
+	Ui Ui
+
+	l       sync.Mutex
+	pending []bufferedMessage
+}
+
+// bufferedMessage is a single held back call on the Ui.
+type bufferedMessage struct {
+	fn      func(Ui, string)
+	message string
+}
+
+func (u *BufferedUi) Ask(query string) (string, error) {
+	u.Flush()
+	return u.Ui.Ask(query)
+}
+
+func (u *BufferedUi) AskSecret(query string) (string, error) {
+	u.Flush()
+	return u.Ui.AskSecret(query)
+}
+
+func (u *BufferedUi) Error(message string) {
+	u.add(Ui.Error, message)
+}
+
+func (u *BufferedUi) Info(message string) {
+	u.add(Ui.Info, message)
+}
+
+func (u *BufferedUi) Output(message string) {
+	u.add(Ui.Output, message)
+}
+
+func (u *BufferedUi) Warn(message string) {
+	u.add(Ui.Warn, message)
+}
+
+// Flush writes all held back output to the wrapped Ui in order.
+func (u *BufferedUi) Flush() {
+	u.l.Lock()
+	pending := u.pending
+	u.pending = nil
+	u.l.Unlock()
+
+	for _, m := range pending {
+		m.fn(u.Ui, m.message)
+	}
+}
+
+// Discard drops all held back output.
+func (u *BufferedUi) Discard() {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	u.pending = nil
+}
+
+func (u *BufferedUi) add(fn func(Ui, string), message string) {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	u.pending = append(u.pending, bufferedMessage{fn: fn, message: message})
+}
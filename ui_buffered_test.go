@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBufferedUi_impl(t *testing.T) {
+	var _ Ui = new(BufferedUi)
+}
+
+func TestBufferedUi_Flush(t *testing.T) {
+	ui := NewMockUi()
+	b := &BufferedUi{Ui: ui}
+
+	b.Output("foo")
+	b.Error("bar")
+	b.Info("baz")
+	b.Warn("qux")
+
+	if ui.OutputWriter.String() != "" || ui.ErrorWriter.String() != "" {
+		t.Fatal("output should be held back")
+	}
+
+	b.Flush()
+	if ui.OutputWriter.String() != "foo\nbaz\n" {
+		t.Fatalf("bad: %#v", ui.OutputWriter.String())
+	}
+	if ui.ErrorWriter.String() != "bar\nqux\n" {
+		t.Fatalf("bad: %#v", ui.ErrorWriter.String())
+	}
+
+	// A second flush has nothing left to write
+	b.Flush()
+	if ui.OutputWriter.String() != "foo\nbaz\n" {
+		t.Fatalf("bad: %#v", ui.OutputWriter.String())
+	}
+}
+
+func TestBufferedUi_Discard(t *testing.T) {
+	ui := NewMockUi()
+	b := &BufferedUi{Ui: ui}
+
+	b.Output("foo")
+	b.Error("bar")
+	b.Discard()
+	b.Output("baz")
+	b.Flush()
+
+	if ui.OutputWriter.String() != "baz\n" {
+		t.Fatalf("bad: %#v", ui.OutputWriter.String())
+	}
+	if ui.ErrorWriter.String() != "" {
+		t.Fatalf("bad: %#v", ui.ErrorWriter.String())
+	}
+}
+
+func TestBufferedUi_AskFlushesFirst(t *testing.T) {
+	ui := NewMockUi()
+	ui.InputReader = strings.NewReader("yes\n")
+	b := &BufferedUi{Ui: ui}
+
+	b.Output("about to ask")
+	result, err := b.Ask("Continue?")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != "yes" {
+		t.Fatalf("bad: %#v", result)
+	}
+	if ui.OutputWriter.String() != "about to ask\nContinue?" {
+		t.Fatalf("bad: %#v", ui.OutputWriter.String())
+	}
+}
@@ -1,5 +1,10 @@
 package cli
 
+import (
+	"os"
+	"strings"
+)
+
 const (
 	noColor = -1
 )
@@ -21,6 +26,39 @@ var (
 	UiColorCyan            = UiColor{int(ColorFgHiCyan), false}
 )
 
+// ColoredUiFromEnv returns a ColoredUi wrapping base whose colors are read
+// from the PREFIX_COLOR_OUTPUT, PREFIX_COLOR_INFO, PREFIX_COLOR_WARN and
+// PREFIX_COLOR_ERROR environment variables, where PREFIX is the given
+// prefix such as "APP". The values are color names as accepted by
+// ColorByName, such as "red" or "bright-blue".
+//
+// Unset or invalid values fall back to no color for output and info,
+// yellow for warnings and red for errors.
+func ColoredUiFromEnv(base Ui, prefix string) *ColoredUi {
+	return &ColoredUi{
+		OutputColor: uiColorFromEnv(prefix, "OUTPUT", UiColorNone),
+		InfoColor:   uiColorFromEnv(prefix, "INFO", UiColorNone),
+		WarnColor:   uiColorFromEnv(prefix, "WARN", UiColorYellow),
+		ErrorColor:  uiColorFromEnv(prefix, "ERROR", UiColorRed),
+		Ui:          base,
+	}
+}
+
+func uiColorFromEnv(prefix, kind string, def UiColor) UiColor {
+	key := strings.ToUpper(prefix) + "_COLOR_" + kind
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	attr, err := colorAttributeByName(v)
+	if err != nil {
+		return def
+	}
+
+	return UiColor{Code: int(attr)}
+}
+
 // ColoredUi is a Ui implementation that colors its output according
 // to the given color schemes for the given type of output.
 type ColoredUi struct {
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestColoredUi_implements(t *testing.T) {
+	var _ Ui = new(ColoredUi)
+}
+
+func TestColoredUiFromEnv(t *testing.T) {
+	t.Setenv("APP_COLOR_OUTPUT", "")
+	t.Setenv("APP_COLOR_INFO", "bright-blue")
+	t.Setenv("APP_COLOR_WARN", "not-a-color")
+	t.Setenv("APP_COLOR_ERROR", "magenta")
+
+	base := NewMockUi()
+	ui := ColoredUiFromEnv(base, "app")
+
+	if ui.Ui != base {
+		t.Fatal("should wrap the base ui")
+	}
+	if ui.OutputColor != UiColorNone {
+		t.Fatalf("bad output: %#v", ui.OutputColor)
+	}
+	if ui.InfoColor != UiColorBlue {
+		t.Fatalf("bad info: %#v", ui.InfoColor)
+	}
+	if ui.WarnColor != UiColorYellow {
+		t.Fatalf("bad warn: %#v", ui.WarnColor)
+	}
+	if ui.ErrorColor != (UiColor{int(ColorFgMagenta), false}) {
+		t.Fatalf("bad error: %#v", ui.ErrorColor)
+	}
+}
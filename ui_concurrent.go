@@ -6,6 +6,11 @@ import (
 
 // ConcurrentUi is a wrapper around a Ui interface (and implements that
 // interface) making the underlying Ui concurrency safe.
+//
+// Every call holds the lock until it returns, so messages written from
+// several goroutines are never interleaved. Ask and AskSecret hold it
+// across both the prompt and reading the response, so no other output is
+// written between a question and its answer.
 type ConcurrentUi struct {
 	Ui Ui
 	l  sync.Mutex
@@ -1,9 +1,73 @@
 package cli
 
 import (
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestConcurrentUi_impl(t *testing.T) {
 	var _ Ui = new(ConcurrentUi)
 }
+
+// eventUi records the calls made on it. Ask blocks until answer is closed.
+type eventUi struct {
+	MockUi
+
+	l      sync.Mutex
+	events []string
+	asking chan struct{}
+	answer chan struct{}
+}
+
+func (u *eventUi) event(e string) {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	u.events = append(u.events, e)
+}
+
+func (u *eventUi) Ask(query string) (string, error) {
+	u.event("ask " + query)
+	close(u.asking)
+	<-u.answer
+	u.event("answer")
+
+	return "yes", nil
+}
+
+func (u *eventUi) Output(message string) {
+	u.event("output " + message)
+}
+
+func TestConcurrentUi_askHoldsLock(t *testing.T) {
+	ui := &eventUi{
+		asking: make(chan struct{}),
+		answer: make(chan struct{}),
+	}
+	c := &ConcurrentUi{Ui: ui}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.Ask("Continue?")
+	}()
+
+	<-ui.asking
+	go func() {
+		defer wg.Done()
+		c.Output("progress")
+	}()
+
+	// Give the output a chance to sneak in before answering.
+	time.Sleep(10 * time.Millisecond)
+	close(ui.answer)
+	wg.Wait()
+
+	expected := []string{"ask Continue?", "answer", "output progress"}
+	if !reflect.DeepEqual(ui.events, expected) {
+		t.Fatalf("bad: %#v", ui.events)
+	}
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CountingUi is a wrapper around a Ui (and implements that interface)
+// that counts the warnings and errors written through it, for example to
+// print a summary at the end of a command or to fail a CI run on warnings
+// with CLI.WarnAsError.
+type CountingUi struct {
+	Ui Ui
+
+	l        sync.Mutex
+	warnings int
+	errors   int
+}
+
+func (u *CountingUi) Ask(query string) (string, error) {
+	return u.Ui.Ask(query)
+}
+
+func (u *CountingUi) AskSecret(query string) (string, error) {
+	return u.Ui.AskSecret(query)
+}
+
+func (u *CountingUi) Error(message string) {
+	u.l.Lock()
+	u.errors++
+	u.l.Unlock()
+
+	u.Ui.Error(message)
+}
+
+func (u *CountingUi) Info(message string) {
+	u.Ui.Info(message)
+}
+
+func (u *CountingUi) Output(message string) {
+	u.Ui.Output(message)
+}
+
+func (u *CountingUi) Warn(message string) {
+	u.l.Lock()
+	u.warnings++
+	u.l.Unlock()
+
+	u.Ui.Warn(message)
+}
+
+// Warnings returns the number of warnings written so far.
+func (u *CountingUi) Warnings() int {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	return u.warnings
+}
+
+// Errors returns the number of errors written so far.
+func (u *CountingUi) Errors() int {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	return u.errors
+}
+
+// Summary writes the number of errors and warnings written through ui, such
+// as "2 errors, 1 warning", to ui. The summary is green if there were
+// none and red otherwise. If ui isn't a CountingUi nothing is written,
+// since there is nothing to count.
+func Summary(ui Ui) {
+	u, ok := ui.(*CountingUi)
+	if !ok {
+		return
+	}
+
+	writeSummary(u, u.Errors(), u.Warnings(), nil)
+}
+
+// writeSummary writes the summary of the given counts to u, colored as
+// FprintCtx does with forceColor.
+func writeSummary(u *CountingUi, errors, warnings int, forceColor *bool) {
+	summary := fmt.Sprintf("%s, %s",
+		pluralize(errors, "error"), pluralize(warnings, "warning"))
+
+	color := NewColor(ColorFgGreen)
+	if errors > 0 || warnings > 0 {
+		color = NewColor(ColorFgRed)
+	}
+
+	u.Output(color.forced(forceColor).Sprint(summary))
+}
+
+// pluralize returns n followed by noun, with an "s" unless n is 1.
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+
+	return fmt.Sprintf("%d %ss", n, noun)
+}
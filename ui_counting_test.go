@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestCountingUi_impl(t *testing.T) {
+	var _ Ui = new(CountingUi)
+}
+
+func TestCountingUi(t *testing.T) {
+	ui := NewMockUi()
+	c := &CountingUi{Ui: ui}
+
+	c.Output("foo")
+	c.Info("bar")
+	c.Warn("careful")
+	c.Warn("really careful")
+	c.Error("oops")
+
+	if n := c.Warnings(); n != 2 {
+		t.Fatalf("bad warnings: %d", n)
+	}
+	if n := c.Errors(); n != 1 {
+		t.Fatalf("bad errors: %d", n)
+	}
+	if ui.OutputWriter.String() != "foo\nbar\n" {
+		t.Fatalf("bad: %#v", ui.OutputWriter.String())
+	}
+	if ui.ErrorWriter.String() != "careful\nreally careful\noops\n" {
+		t.Fatalf("bad: %#v", ui.ErrorWriter.String())
+	}
+}
+
+func TestSummary(t *testing.T) {
+	withColor(t)
+
+	testCases := []struct {
+		errors, warnings int
+		expected         string
+	}{
+		{0, 0, "\x1b[32m0 errors, 0 warnings\x1b[0m\n"},
+		{2, 1, "\x1b[31m2 errors, 1 warning\x1b[0m\n"},
+		{1, 0, "\x1b[31m1 error, 0 warnings\x1b[0m\n"},
+		{0, 3, "\x1b[31m0 errors, 3 warnings\x1b[0m\n"},
+	}
+
+	for _, tc := range testCases {
+		ui := NewMockUi()
+		c := &CountingUi{Ui: ui}
+		for i := 0; i < tc.errors; i++ {
+			c.Error("error")
+		}
+		for i := 0; i < tc.warnings; i++ {
+			c.Warn("warning")
+		}
+
+		Summary(c)
+		if ui.OutputWriter.String() != tc.expected {
+			t.Fatalf("bad: %#v", ui.OutputWriter.String())
+		}
+	}
+}
+
+func TestSummary_notCounting(t *testing.T) {
+	ui := NewMockUi()
+	Summary(ui)
+
+	if ui.OutputWriter.String() != "" {
+		t.Fatalf("bad: %#v", ui.OutputWriter.String())
+	}
+}
@@ -29,7 +29,10 @@ type MockUi struct {
 	ErrorWriter  *syncBuffer
 	OutputWriter *syncBuffer
 
-	once sync.Once
+	once   sync.Once
+	l      sync.Mutex
+	reader *bufio.Reader
+	input  io.Reader
 }
 
 func (u *MockUi) Ask(query string) (string, error) {
@@ -37,9 +40,17 @@ func (u *MockUi) Ask(query string) (string, error) {
 
 	var result string
 	fmt.Fprint(u.OutputWriter, query)
-	r := bufio.NewReader(u.InputReader)
-	line, err := r.ReadString('\n')
-	if err != nil {
+
+	// Keep the reader across calls so that input it buffered ahead isn't
+	// lost for the next question, as BasicUi does.
+	u.l.Lock()
+	defer u.l.Unlock()
+	if u.reader == nil || !sameValue(u.input, u.InputReader) {
+		u.reader = bufio.NewReader(u.InputReader)
+		u.input = u.InputReader
+	}
+	line, err := u.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
 		return "", err
 	}
 	result = strings.TrimRight(line, "\r\n")
@@ -0,0 +1,358 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultHistoryLimit is the number of entries a ReadlineUi keeps in its
+// history if HistoryLimit isn't set.
+const DefaultHistoryLimit = 1000
+
+// ReadlineUi is an implementation of Ui for interactive programs such as a
+// REPL. When Reader is a terminal, Ask supports basic line editing and
+// recalling earlier answers with the up and down arrow keys. Otherwise, or
+// if the terminal can't be switched to unbuffered input, it behaves just
+// like a BasicUi with the same Reader and writers.
+//
+// Answers to Ask are kept in an in-memory history, which is also
+// persisted to HistoryFile if it is set. Answers to AskSecret never are.
+type ReadlineUi struct {
+	Reader      io.Reader
+	Writer      io.Writer
+	ErrorWriter io.Writer
+
+	// HistoryFile is the file the history is loaded from on the first call
+	// to Ask. Every new entry is appended to it. If empty, the history is
+	// only kept in memory.
+	HistoryFile string
+
+	// HistoryLimit is the maximum number of entries kept in the history.
+	// Defaults to DefaultHistoryLimit.
+	HistoryLimit int
+
+	l             sync.Mutex
+	history       []string
+	historyLoaded bool
+	asker         BasicUi
+}
+
+func (u *ReadlineUi) Ask(query string) (string, error) {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	u.loadHistory()
+
+	var line string
+	var err error
+	if f, ok := u.Reader.(*os.File); ok && isTerminalFile(f) {
+		line, err = u.askTerminal(f, query)
+	} else {
+		line, err = u.ask().Ask(query)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	u.addHistory(line)
+	return line, nil
+}
+
+func (u *ReadlineUi) AskSecret(query string) (string, error) {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	return u.ask().AskSecret(query)
+}
+
+func (u *ReadlineUi) Error(message string) {
+	u.basic().Error(message)
+}
+
+func (u *ReadlineUi) Info(message string) {
+	u.basic().Info(message)
+}
+
+func (u *ReadlineUi) Output(message string) {
+	u.basic().Output(message)
+}
+
+func (u *ReadlineUi) Warn(message string) {
+	u.basic().Warn(message)
+}
+
+// History returns a copy of the entries in the history, oldest first.
+func (u *ReadlineUi) History() []string {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	u.loadHistory()
+	return append([]string(nil), u.history...)
+}
+
+func (u *ReadlineUi) basic() *BasicUi {
+	return &BasicUi{
+		Reader:      u.Reader,
+		Writer:      u.Writer,
+		ErrorWriter: u.ErrorWriter,
+	}
+}
+
+// ask returns the BasicUi that answers are read with if line editing isn't
+// available. It is kept across calls, so input that is read ahead for one
+// answer is left for the next. The caller must hold u.l.
+func (u *ReadlineUi) ask() *BasicUi {
+	u.asker.Reader = u.Reader
+	u.asker.Writer = u.Writer
+	u.asker.ErrorWriter = u.ErrorWriter
+	return &u.asker
+}
+
+func (u *ReadlineUi) askTerminal(f *os.File, query string) (string, error) {
+	restore, err := readlineRawMode(f)
+	if err != nil {
+		// Line editing isn't available, so read the line as usual.
+		return u.ask().Ask(query)
+	}
+	defer restore()
+
+	return readlineEdit(f, u.Writer, query+" ", u.history)
+}
+
+// loadHistory reads the history from HistoryFile once. A missing or
+// unreadable file results in an empty history.
+func (u *ReadlineUi) loadHistory() {
+	if u.historyLoaded {
+		return
+	}
+	u.historyLoaded = true
+
+	if u.HistoryFile == "" {
+		return
+	}
+
+	f, err := os.Open(u.HistoryFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			u.history = append(u.history, line)
+		}
+	}
+
+	u.trimHistory()
+}
+
+// addHistory adds the line to the history unless it is empty or the same
+// as the last entry, and appends it to HistoryFile. Persisting the history
+// is best effort, so errors writing the file are ignored.
+func (u *ReadlineUi) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(u.history); n > 0 && u.history[n-1] == line {
+		return
+	}
+
+	u.history = append(u.history, line)
+	u.trimHistory()
+
+	if u.HistoryFile == "" || strings.ContainsAny(line, "\r\n") {
+		return
+	}
+
+	f, err := os.OpenFile(u.HistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, line)
+}
+
+func (u *ReadlineUi) trimHistory() {
+	limit := u.HistoryLimit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+
+	if len(u.history) > limit {
+		u.history = u.history[len(u.history)-limit:]
+	}
+}
+
+// readlineRawMode switches the terminal f to pass on every key as soon as
+// it is typed, and returns a function that restores the previous mode.
+func readlineRawMode(f *os.File) (func(), error) {
+	return terminalRawMode(f, "min", "1")
+}
+
+// readlineEdit reads a line from r, which must deliver the keys as they
+// are typed without echoing them, and renders the prompt and the line
+// being edited to w. The arrow keys move the cursor and walk through the
+// history.
+func readlineEdit(r io.Reader, w io.Writer, prompt string, history []string) (string, error) {
+	var line []rune
+	var pending []rune
+	pos := 0
+	idx := len(history)
+
+	redraw := func() {
+		fmt.Fprintf(w, "\r%s%s%s[K", prompt, string(line), colorEscape)
+		if n := VisibleWidth(string(line[pos:])); n > 0 {
+			fmt.Fprintf(w, "%s[%dD", colorEscape, n)
+		}
+	}
+	recall := func(entry []rune) {
+		line = append([]rune(nil), entry...)
+		pos = len(line)
+	}
+
+	fmt.Fprint(w, prompt)
+	for {
+		c, err := readlineRune(r)
+		if err != nil {
+			return "", err
+		}
+
+		switch c {
+		case '\r', '\n':
+			fmt.Fprint(w, "\n")
+			return string(line), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(w, "\n")
+			return "", errors.New("interrupted")
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Fprint(w, "\n")
+				return "", io.EOF
+			}
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(line)
+		case 21: // Ctrl-U
+			line = line[pos:]
+			pos = 0
+		case 8, 127: // Backspace
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case 27: // Escape sequence
+			key, err := readlineEscape(r)
+			if err != nil {
+				return "", err
+			}
+
+			switch key {
+			case 'A': // Up
+				if idx > 0 {
+					if idx == len(history) {
+						pending = line
+					}
+					idx--
+					recall([]rune(history[idx]))
+				}
+			case 'B': // Down
+				if idx < len(history) {
+					idx++
+					if idx == len(history) {
+						recall(pending)
+					} else {
+						recall([]rune(history[idx]))
+					}
+				}
+			case 'C': // Right
+				if pos < len(line) {
+					pos++
+				}
+			case 'D': // Left
+				if pos > 0 {
+					pos--
+				}
+			case 'H': // Home
+				pos = 0
+			case 'F': // End
+				pos = len(line)
+			case '~': // Delete
+				if pos < len(line) {
+					line = append(line[:pos], line[pos+1:]...)
+				}
+			}
+		default:
+			if c < 0x20 {
+				continue
+			}
+
+			line = append(line[:pos], append([]rune{c}, line[pos:]...)...)
+			pos++
+		}
+
+		redraw()
+	}
+}
+
+// readlineRune reads a single UTF-8 encoded rune from r a byte at a time,
+// so no input beyond the current line is consumed.
+func readlineRune(r io.Reader) (rune, error) {
+	var buf []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 0 {
+			if err == nil {
+				continue
+			}
+
+			return 0, err
+		}
+
+		buf = append(buf, b[0])
+		if utf8.FullRune(buf) {
+			c, _ := utf8.DecodeRune(buf)
+			return c, nil
+		}
+	}
+}
+
+// readlineEscape reads the rest of an escape sequence after the escape
+// character and returns its final byte, or '~' for the delete key. Unknown
+// sequences are returned as 0.
+func readlineEscape(r io.Reader) (rune, error) {
+	c, err := readlineRune(r)
+	if err != nil {
+		return 0, err
+	}
+	if c != '[' && c != 'O' {
+		return 0, nil
+	}
+
+	var params []rune
+	for {
+		c, err := readlineRune(r)
+		if err != nil {
+			return 0, err
+		}
+
+		if c >= 0x40 && c <= 0x7e {
+			if c == '~' && string(params) != "3" {
+				return 0, nil
+			}
+
+			return c, nil
+		}
+
+		params = append(params, c)
+	}
+}
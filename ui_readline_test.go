@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadlineUi_impl(t *testing.T) {
+	var _ Ui = new(ReadlineUi)
+}
+
+func TestReadlineUi_Ask_notTerminal(t *testing.T) {
+	writer := new(bytes.Buffer)
+	ui := &ReadlineUi{
+		Reader: strings.NewReader("foo bar\n"),
+		Writer: writer,
+	}
+
+	result, err := ui.Ask("Name?")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result != "foo bar" {
+		t.Fatalf("bad: %#v", result)
+	}
+	if writer.String() != "Name? " {
+		t.Fatalf("bad: %#v", writer.String())
+	}
+	if !reflect.DeepEqual(ui.History(), []string{"foo bar"}) {
+		t.Fatalf("bad: %#v", ui.History())
+	}
+}
+
+func TestReadlineUi_Ask_notTerminalPiped(t *testing.T) {
+	in_r, in_w := io.Pipe()
+	defer in_r.Close()
+	defer in_w.Close()
+
+	ui := &ReadlineUi{
+		Reader: in_r,
+		Writer: new(bytes.Buffer),
+	}
+
+	// Both answers arrive in a single read.
+	go in_w.Write([]byte("one\ntwo\n"))
+
+	for _, expected := range []string{"one", "two"} {
+		result, err := ui.Ask("?")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if result != expected {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+}
+
+func TestReadlineUi_historyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	for _, answer := range []string{"one", "two", "two", ""} {
+		ui := &ReadlineUi{
+			Reader:      strings.NewReader(answer + "\n"),
+			Writer:      new(bytes.Buffer),
+			HistoryFile: path,
+		}
+
+		if _, err := ui.Ask("?"); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	ui := &ReadlineUi{HistoryFile: path, HistoryLimit: 1}
+	if !reflect.DeepEqual(ui.History(), []string{"two"}) {
+		t.Fatalf("bad: %#v", ui.History())
+	}
+}
+
+func TestReadlineEdit(t *testing.T) {
+	history := []string{"one", "two"}
+	cases := []struct {
+		Input  string
+		Output string
+	}{
+		{"foo\r", "foo"},
+		{"héllo\n", "héllo"},
+		{"ab\x7fc\r", "ac"},
+		{"ab\x1b[Dc\r", "acb"},
+		{"ab\x01c\x05d\r", "cabd"},
+		{"abc\x1b[D\x1b[D\x1b[3~\r", "ac"},
+
+		// History
+		{"\x1b[A\r", "two"},
+		{"\x1b[A\x1b[A\r", "one"},
+		{"\x1b[A\x1b[A\x1b[A\r", "one"},
+		{"\x1b[A\x1b[A\x1b[B\r", "two"},
+		{"new\x1b[A\x1b[B\r", "new"},
+		{"\x1bOA!\r", "two!"},
+	}
+
+	for _, tc := range cases {
+		result, err := readlineEdit(
+			strings.NewReader(tc.Input), new(bytes.Buffer), "> ", history)
+		if err != nil {
+			t.Fatalf("%q: err: %s", tc.Input, err)
+		}
+
+		if result != tc.Output {
+			t.Fatalf("%q: bad: %#v", tc.Input, result)
+		}
+	}
+}
+
+func TestReadlineEdit_render(t *testing.T) {
+	w := new(bytes.Buffer)
+	if _, err := readlineEdit(strings.NewReader("ab\x1b[D\r"), w, "> ", nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := "> " +
+		"\r> a\x1b[K" +
+		"\r> ab\x1b[K" +
+		"\r> ab\x1b[K\x1b[1D" +
+		"\n"
+	if w.String() != expected {
+		t.Fatalf("bad: %#v", w.String())
+	}
+}
+
+func TestReadlineEdit_interrupt(t *testing.T) {
+	if _, err := readlineEdit(strings.NewReader("ab\x03"), new(bytes.Buffer), "> ", nil); err == nil || err.Error() != "interrupted" {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	if _, err := readlineEdit(strings.NewReader("\x04"), new(bytes.Buffer), "> ", nil); err != io.EOF {
+		t.Fatalf("bad: %#v", err)
+	}
+}
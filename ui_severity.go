@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"strings"
+)
+
+var (
+	// DefaultErrorPrefixes are the prefixes of messages that a
+	// SeverityRoutingUi routes to Error if ErrorPrefixes isn't set.
+	DefaultErrorPrefixes = []string{"ERROR:"}
+
+	// DefaultWarnPrefixes are the prefixes of messages that a
+	// SeverityRoutingUi routes to Warn if WarnPrefixes isn't set.
+	DefaultWarnPrefixes = []string{"WARNING:", "WARN:"}
+)
+
+// SeverityRoutingUi is a wrapper around a Ui (and implements that
+// interface) that routes messages given to Output and Info to Error or
+// Warn based on their prefix, such as "ERROR: disk full". This eases the
+// migration of code that printed everything to standard output. Messages
+// are passed on unchanged, prefix included.
+type SeverityRoutingUi struct {
+	// ErrorPrefixes and WarnPrefixes are the prefixes of the messages
+	// routed to Error and Warn. They default to DefaultErrorPrefixes and
+	// DefaultWarnPrefixes.
+	ErrorPrefixes []string
+	WarnPrefixes  []string
+
+	Ui Ui
+}
+
+func (u *SeverityRoutingUi) Ask(query string) (string, error) {
+	return u.Ui.Ask(query)
+}
+
+func (u *SeverityRoutingUi) AskSecret(query string) (string, error) {
+	return u.Ui.AskSecret(query)
+}
+
+func (u *SeverityRoutingUi) Error(message string) {
+	u.Ui.Error(message)
+}
+
+func (u *SeverityRoutingUi) Info(message string) {
+	if !u.route(message) {
+		u.Ui.Info(message)
+	}
+}
+
+func (u *SeverityRoutingUi) Output(message string) {
+	if !u.route(message) {
+		u.Ui.Output(message)
+	}
+}
+
+func (u *SeverityRoutingUi) Warn(message string) {
+	u.Ui.Warn(message)
+}
+
+// route sends the message to Error or Warn if it has one of their
+// prefixes, and returns whether it did.
+func (u *SeverityRoutingUi) route(message string) bool {
+	errorPrefixes := u.ErrorPrefixes
+	if errorPrefixes == nil {
+		errorPrefixes = DefaultErrorPrefixes
+	}
+	warnPrefixes := u.WarnPrefixes
+	if warnPrefixes == nil {
+		warnPrefixes = DefaultWarnPrefixes
+	}
+
+	if hasAnyPrefix(message, errorPrefixes) {
+		u.Ui.Error(message)
+		return true
+	}
+	if hasAnyPrefix(message, warnPrefixes) {
+		u.Ui.Warn(message)
+		return true
+	}
+
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
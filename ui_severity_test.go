@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestSeverityRoutingUi_impl(t *testing.T) {
+	var _ Ui = new(SeverityRoutingUi)
+}
+
+func TestSeverityRoutingUi(t *testing.T) {
+	testCases := []struct {
+		method  func(Ui, string)
+		message string
+		stdout  string
+		stderr  string
+	}{
+		{Ui.Output, "hello", "hello\n", ""},
+		{Ui.Output, "ERROR: disk full", "", "ERROR: disk full\n"},
+		{Ui.Output, "WARNING: low memory", "", "WARNING: low memory\n"},
+		{Ui.Output, "WARN: low memory", "", "WARN: low memory\n"},
+		{Ui.Output, "no ERROR: here", "no ERROR: here\n", ""},
+		{Ui.Output, "error: lower case", "error: lower case\n", ""},
+		{Ui.Info, "ERROR: disk full", "", "ERROR: disk full\n"},
+		{Ui.Info, "info", "info\n", ""},
+		{Ui.Error, "plain error", "", "plain error\n"},
+	}
+
+	for _, tc := range testCases {
+		ui := NewMockUi()
+		tc.method(&SeverityRoutingUi{Ui: ui}, tc.message)
+
+		if ui.OutputWriter.String() != tc.stdout {
+			t.Fatalf("%q: bad stdout: %#v", tc.message, ui.OutputWriter.String())
+		}
+		if ui.ErrorWriter.String() != tc.stderr {
+			t.Fatalf("%q: bad stderr: %#v", tc.message, ui.ErrorWriter.String())
+		}
+	}
+}
+
+func TestSeverityRoutingUi_prefixes(t *testing.T) {
+	mock := NewMockUi()
+	ui := &SeverityRoutingUi{
+		ErrorPrefixes: []string{"E "},
+		WarnPrefixes:  []string{"W "},
+		Ui:            mock,
+	}
+
+	ui.Output("E failed")
+	ui.Output("W careful")
+	ui.Output("ERROR: not routed")
+
+	if mock.ErrorWriter.String() != "E failed\nW careful\n" {
+		t.Fatalf("bad: %#v", mock.ErrorWriter.String())
+	}
+	if mock.OutputWriter.String() != "ERROR: not routed\n" {
+		t.Fatalf("bad: %#v", mock.OutputWriter.String())
+	}
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// StepUi renders multi-step task output such as "Creating network... done",
+// where the status of a step is appended to the line that started it.
+//
+// When InPlace is true the status is written on the same line as the step
+// message, which is what you want on a terminal. Otherwise the step message
+// and its final status are written as separate lines so that log files and
+// pipes stay readable.
+type StepUi struct {
+	Writer  io.Writer
+	InPlace bool
+
+	l sync.Mutex
+}
+
+// NewStepUi returns a StepUi writing to w that renders steps in place if w
+// is a terminal.
+func NewStepUi(w io.Writer) *StepUi {
+	return &StepUi{
+		Writer:  w,
+		InPlace: isTerminalWriter(w),
+	}
+}
+
+// StartStep writes the message for a new step and returns a handle that
+// must be used to report its final status.
+func (u *StepUi) StartStep(msg string) *Step {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	if u.InPlace {
+		fmt.Fprintf(u.Writer, "%s... ", msg)
+	} else {
+		fmt.Fprintf(u.Writer, "%s...\n", msg)
+	}
+
+	return &Step{ui: u, msg: msg}
+}
+
+// Step is a single step started with StepUi.StartStep.
+type Step struct {
+	ui       *StepUi
+	msg      string
+	finished bool
+}
+
+// Done marks the step as successfully completed.
+func (s *Step) Done() {
+	s.finish(NewColor(ColorFgGreen).Sprint("done"))
+}
+
+// Fail marks the step as failed. If err is non-nil it is included in the
+// status.
+func (s *Step) Fail(err error) {
+	status := "failed"
+	if err != nil {
+		status = fmt.Sprintf("failed: %s", err)
+	}
+
+	s.finish(NewColor(ColorFgRed).Sprint(status))
+}
+
+// Skip marks the step as skipped.
+func (s *Step) Skip() {
+	s.finish(NewColor(ColorFgYellow).Sprint("skipped"))
+}
+
+func (s *Step) finish(status string) {
+	s.ui.l.Lock()
+	defer s.ui.l.Unlock()
+
+	// A step only has one final status, ignore any further calls.
+	if s.finished {
+		return
+	}
+	s.finished = true
+
+	if s.ui.InPlace {
+		fmt.Fprintf(s.ui.Writer, "\r%s... %s\n", s.msg, status)
+	} else {
+		fmt.Fprintf(s.ui.Writer, "%s... %s\n", s.msg, status)
+	}
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStepUi_inPlace(t *testing.T) {
+	old := NoColor
+	NoColor = true
+	defer func() { NoColor = old }()
+
+	buf := new(bytes.Buffer)
+	ui := &StepUi{Writer: buf, InPlace: true}
+
+	ui.StartStep("Creating network").Done()
+	step := ui.StartStep("Creating volume")
+	step.Fail(errors.New("disk full"))
+	step.Done()
+	ui.StartStep("Creating cache").Skip()
+
+	expected := "Creating network... \rCreating network... done\n" +
+		"Creating volume... \rCreating volume... failed: disk full\n" +
+		"Creating cache... \rCreating cache... skipped\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestStepUi_lines(t *testing.T) {
+	old := NoColor
+	NoColor = true
+	defer func() { NoColor = old }()
+
+	buf := new(bytes.Buffer)
+	ui := NewStepUi(buf)
+	if ui.InPlace {
+		t.Fatal("buffer should not render in place")
+	}
+
+	ui.StartStep("Creating network").Done()
+	ui.StartStep("Creating volume").Fail(nil)
+
+	expected := "Creating network...\nCreating network... done\n" +
+		"Creating volume...\nCreating volume... failed\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestStepUi_color(t *testing.T) {
+	withColor(t)
+
+	buf := new(bytes.Buffer)
+	ui := &StepUi{Writer: buf}
+	ui.StartStep("Creating network").Done()
+
+	expected := "Creating network...\nCreating network... \x1b[32mdone\x1b[0m\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
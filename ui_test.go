@@ -3,6 +3,7 @@ package cli
 import (
 	"bytes"
 	"io"
+	"os"
 	"testing"
 )
 
@@ -77,6 +78,41 @@ func TestBasicUi_AskSecret(t *testing.T) {
 	}
 }
 
+func TestBasicUi_AskSecret_notTerminal(t *testing.T) {
+	// Even when stdin is a terminal, a Reader that isn't one is read as is.
+	old := isTerminalFile
+	defer func() { isTerminalFile = old }()
+	isTerminalFile = func(f *os.File) bool { return f == os.Stdin }
+
+	in_r, in_w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer in_r.Close()
+	defer in_w.Close()
+
+	writer := new(bytes.Buffer)
+	ui := &BasicUi{
+		Reader: in_r,
+		Writer: writer,
+	}
+
+	go in_w.Write([]byte("hunter2\n"))
+
+	result, err := ui.AskSecret("Password?")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if writer.String() != "Password? " {
+		t.Fatalf("bad: %#v", writer.String())
+	}
+
+	if result != "hunter2" {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
 func TestBasicUi_Error(t *testing.T) {
 	writer := new(bytes.Buffer)
 	ui := &BasicUi{Writer: writer}
@@ -122,6 +158,26 @@ func TestPrefixedUi_implements(t *testing.T) {
 	var _ Ui = new(PrefixedUi)
 }
 
+func TestPrefixedUi_multiline(t *testing.T) {
+	ui := new(MockUi)
+	p := &PrefixedUi{
+		OutputPrefix: "[db] ",
+		ErrorPrefix:  "[db] ",
+		Ui:           ui,
+	}
+
+	p.Output("migrating...\n\ndone\n")
+	p.Output("")
+	p.Error("failed\nrolled back")
+
+	if ui.OutputWriter.String() != "[db] migrating...\n[db] \n[db] done\n\n\n" {
+		t.Fatalf("bad: %#v", ui.OutputWriter.String())
+	}
+	if ui.ErrorWriter.String() != "[db] failed\n[db] rolled back\n" {
+		t.Fatalf("bad: %#v", ui.ErrorWriter.String())
+	}
+}
+
 func TestPrefixedUiError(t *testing.T) {
 	ui := new(MockUi)
 	p := &PrefixedUi{
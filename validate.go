@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// validateCommandName is the name of the built-in command enabled with
+// CLI.ValidateCommand.
+const validateCommandName = "__validate"
+
+// Validate checks the configuration of the CLI without running any
+// command: that the aliases are valid, that every command factory returns
+// a command, and that HiddenCommands, HelpCommand and VersionCommand name
+// registered commands. It returns an error listing all problems found, or
+// nil if there are none.
+func (c *CLI) Validate() error {
+	problems := c.validationProblems()
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d problem(s) found:\n  %s",
+		len(problems), strings.Join(problems, "\n  "))
+}
+
+// validationProblems returns a description of each problem Validate finds.
+func (c *CLI) validationProblems() []string {
+	c.once.Do(c.init)
+
+	var problems []string
+	if c.initErr != nil {
+		problems = append(problems, c.initErr.Error())
+	}
+
+	c.commandTree.Walk(func(k string, raw interface{}) bool {
+		f, _ := raw.(CommandFactory)
+		if f == nil {
+			problems = append(problems, fmt.Sprintf("command %q has no factory", k))
+			return false
+		}
+
+		command, err := f()
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("command %q failed to load: %s", k, err))
+		case command == nil:
+			problems = append(problems, fmt.Sprintf("command %q factory returned no command", k))
+		}
+
+		return false
+	})
+
+	for _, k := range c.HiddenCommands {
+		if c.isAlias(k) {
+			// Reported by Lint
+			continue
+		}
+		if _, ok := c.commandTree.Get(k); !ok {
+			problems = append(problems, fmt.Sprintf("hidden command %q is not registered", k))
+		}
+	}
+
+	for _, named := range []struct{ field, k string }{
+		{"HelpCommand", c.HelpCommand},
+		{"VersionCommand", c.VersionCommand},
+	} {
+		if named.k == "" {
+			continue
+		}
+		if _, ok := c.commandTree.Get(named.k); !ok {
+			problems = append(problems, fmt.Sprintf("%s %q is not registered", named.field, named.k))
+		}
+	}
+
+	return problems
+}
+
+// Lint returns human readable findings about configurations that are
+// valid but likely don't behave as intended: an alias that refers to a
+// hidden command, which makes the command reachable under a name that is
+// just as undocumented, and an alias listed in HiddenCommands, which has
+// no effect since aliases only appear in the help with ShowAliasesInHelp.
+// The built-in command enabled with ValidateCommand prints them as
+// warnings.
+func (c *CLI) Lint() []string {
+	c.once.Do(c.init)
+
+	aliases := make([]string, 0, len(c.Aliases))
+	for k := range c.Aliases {
+		aliases = append(aliases, k)
+	}
+	sort.Strings(aliases)
+
+	var findings []string
+	for _, alias := range aliases {
+		command := strings.Join(strings.Fields(c.Aliases[alias]), " ")
+		if _, ok := c.commandHidden[command]; ok {
+			findings = append(findings, fmt.Sprintf(
+				"alias %q refers to hidden command %q", alias, command))
+		}
+	}
+
+	for _, k := range c.HiddenCommands {
+		if c.isAlias(k) && !c.ShowAliasesInHelp {
+			findings = append(findings, fmt.Sprintf(
+				"hidden command %q is an alias, aliases are never shown in the help", k))
+		}
+	}
+
+	return findings
+}
+
+// isAlias returns true if k is the name of an alias.
+func (c *CLI) isAlias(k string) bool {
+	k = strings.Join(strings.Fields(k), " ")
+	for alias := range c.Aliases {
+		if strings.Join(strings.Fields(alias), " ") == k {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newValidateCommand is the factory of the built-in command enabled with
+// CLI.ValidateCommand.
+func (c *CLI) newValidateCommand() (Command, error) {
+	return &validateCommand{cli: c}, nil
+}
+
+// validateCommand prints the problems found by CLI.Validate. See
+// CLI.ValidateCommand.
+type validateCommand struct {
+	cli *CLI
+}
+
+func (v *validateCommand) Help() string {
+	return strings.TrimSpace(fmt.Sprintf(`
+Usage: %s
+
+  Checks the configuration of the application, such as that every command
+  can be loaded, and prints any problems found. Exits with 1 if there are
+  any problems. Likely mistakes that are still valid are printed as
+  warnings.
+`, strings.TrimSpace(v.cli.Name+" "+validateCommandName)))
+}
+
+func (v *validateCommand) Run(args []string) int {
+	for _, f := range v.cli.Lint() {
+		v.cli.Ui.Warn("Warning: " + f)
+	}
+
+	problems := v.cli.validationProblems()
+	for _, p := range problems {
+		v.cli.Ui.Error(p)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+
+	v.cli.Ui.Output("No problems found.")
+	return 0
+}
+
+func (v *validateCommand) Builtin() bool {
+	return true
+}
+
+func (v *validateCommand) Synopsis() string {
+	return "Checks the configuration of the application"
+}
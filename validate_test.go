@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCLIValidate(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"foo bar": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		HiddenCommands: []string{"foo bar"},
+		HelpCommand:    "foo",
+	}
+
+	if err := cli.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestCLIValidate_problems(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"broken": func() (Command, error) {
+				return nil, errors.New("no config")
+			},
+			"empty": func() (Command, error) {
+				return nil, nil
+			},
+		},
+		HiddenCommands: []string{"ghost"},
+		VersionCommand: "version",
+		Aliases:        map[string]string{"b": "missing"},
+	}
+
+	err := cli.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	expected := `5 problem(s) found:
+  alias "b" refers to unknown command "missing"
+  command "broken" failed to load: no config
+  command "empty" factory returned no command
+  hidden command "ghost" is not registered
+  VersionCommand "version" is not registered`
+	if err.Error() != expected {
+		t.Fatalf("bad:\n%s", err)
+	}
+}
+
+func TestCLIRun_validateCommand(t *testing.T) {
+	ui := NewMockUi()
+	cli := &CLI{
+		Args: []string{"__validate"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		ValidateCommand: true,
+		Ui:              ui,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if ui.OutputWriter.String() != "No problems found.\n" {
+		t.Fatalf("bad: %#v", ui.OutputWriter.String())
+	}
+	if ui.ErrorWriter.String() != "" {
+		t.Fatalf("bad: %#v", ui.ErrorWriter.String())
+	}
+}
+
+func TestCLIRun_validateCommandProblems(t *testing.T) {
+	ui := NewMockUi()
+	cli := &CLI{
+		Args: []string{"__validate"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return nil, errors.New("no config")
+			},
+		},
+		Aliases:         map[string]string{"f": "fo"},
+		ValidateCommand: true,
+		Ui:              ui,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	expected := "alias \"f\" refers to unknown command \"fo\"\n" +
+		"command \"foo\" failed to load: no config\n"
+	if ui.ErrorWriter.String() != expected {
+		t.Fatalf("bad: %#v", ui.ErrorWriter.String())
+	}
+}
+
+func TestCLIRun_validateCommandHidden(t *testing.T) {
+	buf := new(strings.Builder)
+	cli := &CLI{
+		Args: []string{"--help"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		ValidateCommand: true,
+		HelpWriter:      buf,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if strings.Contains(buf.String(), validateCommandName) {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+}
+
+func TestCLILint(t *testing.T) {
+	factory := func() (Command, error) {
+		return new(MockCommand), nil
+	}
+
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo":    factory,
+			"secret": factory,
+		},
+		HiddenCommands: []string{"secret", "f"},
+		Aliases: map[string]string{
+			"f": "foo",
+			"s": "secret",
+		},
+	}
+
+	expected := []string{
+		`alias "s" refers to hidden command "secret"`,
+		`hidden command "f" is an alias, aliases are never shown in the help`,
+	}
+	if findings := cli.Lint(); !reflect.DeepEqual(findings, expected) {
+		t.Fatalf("bad: %#v", findings)
+	}
+
+	// Lint findings aren't problems
+	if err := cli.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestCLIRun_validateCommandLint(t *testing.T) {
+	ui := NewMockUi()
+	cli := &CLI{
+		Args: []string{"__validate"},
+		Commands: map[string]CommandFactory{
+			"secret": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		HiddenCommands:  []string{"secret"},
+		Aliases:         map[string]string{"s": "secret"},
+		ValidateCommand: true,
+		Ui:              ui,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	expected := "Warning: alias \"s\" refers to hidden command \"secret\"\n"
+	if ui.ErrorWriter.String() != expected {
+		t.Fatalf("bad: %#v", ui.ErrorWriter.String())
+	}
+}
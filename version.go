@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"strconv"
+	"strings"
+)
+
+// compareVersions compares two semantic versions such as "1.2" and
+// "v2.0.1", returning -1, 0 or 1 like strings.Compare. Missing components
+// are treated as zero. A pre-release such as "2.0.0-rc1" comes before the
+// release itself and pre-releases are ordered as semver defines, while
+// build metadata after a "+" is ignored. The second return value is false
+// if either version can't be parsed.
+func compareVersions(a, b string) (int, bool) {
+	pa, preA, ok := parseVersion(a)
+	if !ok {
+		return 0, false
+	}
+	pb, preB, ok := parseVersion(b)
+	if !ok {
+		return 0, false
+	}
+
+	for len(pa) < len(pb) {
+		pa = append(pa, 0)
+	}
+	for len(pb) < len(pa) {
+		pb = append(pb, 0)
+	}
+
+	for i := range pa {
+		switch {
+		case pa[i] < pb[i]:
+			return -1, true
+		case pa[i] > pb[i]:
+			return 1, true
+		}
+	}
+
+	return comparePrerelease(preA, preB), true
+}
+
+// parseVersion returns the numeric components of the version v and its
+// pre-release, if any.
+func parseVersion(v string) ([]int, string, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if idx := strings.IndexByte(v, '+'); idx > -1 {
+		v = v[:idx]
+	}
+
+	var pre string
+	if idx := strings.IndexByte(v, '-'); idx > -1 {
+		v, pre = v[:idx], v[idx+1:]
+		if pre == "" {
+			return nil, "", false
+		}
+	}
+	if v == "" {
+		return nil, "", false
+	}
+
+	parts := strings.Split(v, ".")
+	result := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, "", false
+		}
+
+		result[i] = n
+	}
+
+	return result, pre, true
+}
+
+// comparePrerelease compares the pre-releases of two versions with the
+// same numeric components. No pre-release comes after any pre-release.
+// Otherwise the dot separated identifiers are compared in turn: numeric
+// ones numerically and before alphanumeric ones, which are compared in
+// ASCII order. If all of them are equal, the longer pre-release comes
+// last.
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	ia, ib := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(ia) && i < len(ib); i++ {
+		na, errA := strconv.ParseUint(ia[i], 10, 64)
+		nb, errB := strconv.ParseUint(ib[i], 10, 64)
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1
+			}
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			if c := strings.Compare(ia[i], ib[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	switch {
+	case len(ia) < len(ib):
+		return -1
+	case len(ia) > len(ib):
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+		ok       bool
+	}{
+		{"1.2", "1.2.0", 0, true},
+		{"v1.2.3", "1.2.4", -1, true},
+		{"2.0", "1.10", 1, true},
+		{"1.10", "1.9", 1, true},
+		{"2.0.0-rc1", "2.0.0", -1, true},
+		{"2.0.0", "2.0.0-rc1", 1, true},
+		{"2.0.0-rc1", "2.0.0-rc2", -1, true},
+		{"2.0.0-beta.1", "2.0", -1, true},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1, true},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1, true},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1, true},
+		{"1.0.0-rc.1", "1.0.0-rc.1+build.5", 0, true},
+		{"1.0.0+build.5", "1.0.0", 0, true},
+		{"2.0.0-rc1", "1.9", 1, true},
+		{"", "1.0", 0, false},
+		{"1.x", "1.0", 0, false},
+		{"1.0-", "1.0", 0, false},
+	}
+
+	for _, tc := range testCases {
+		result, ok := compareVersions(tc.a, tc.b)
+		if result != tc.expected || ok != tc.ok {
+			t.Errorf("%q vs %q: got %d/%v", tc.a, tc.b, result, ok)
+		}
+	}
+}
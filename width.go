@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"unicode"
+)
+
+const (
+	zeroWidthJoiner = '\u200d'
+
+	regionalIndicatorA = 0x1f1e6
+	regionalIndicatorZ = 0x1f1ff
+)
+
+// wideRanges are the rune ranges that take up two columns in a terminal:
+// the East Asian wide and fullwidth blocks and the emoji blocks.
+var wideRanges = []struct{ lo, hi rune }{
+	{0x1100, 0x115f},   // Hangul Jamo
+	{0x231a, 0x231b},   // watch, hourglass
+	{0x23e9, 0x23ec},   // media controls
+	{0x23f0, 0x23f3},   // alarm clock, stopwatch
+	{0x25fd, 0x25fe},   // small squares
+	{0x2614, 0x2615},   // umbrella, hot beverage
+	{0x2648, 0x2653},   // zodiac
+	{0x26a1, 0x26a1},   // high voltage
+	{0x26bd, 0x26be},   // soccer, baseball
+	{0x26c4, 0x26c5},   // snowman, sun behind cloud
+	{0x26d4, 0x26d4},   // no entry
+	{0x26ea, 0x26ea},   // church
+	{0x26f2, 0x26f5},   // fountain, golf, sailboat
+	{0x26fa, 0x26fd},   // tent, fuel pump
+	{0x2705, 0x2705},   // check mark
+	{0x270a, 0x270b},   // fists
+	{0x2728, 0x2728},   // sparkles
+	{0x274c, 0x274c},   // cross mark
+	{0x2753, 0x2755},   // question marks
+	{0x2757, 0x2757},   // exclamation mark
+	{0x2795, 0x2797},   // math symbols
+	{0x27b0, 0x27b0},   // curly loop
+	{0x27bf, 0x27bf},   // double curly loop
+	{0x2b1b, 0x2b1c},   // large squares
+	{0x2b50, 0x2b50},   // star
+	{0x2b55, 0x2b55},   // circle
+	{0x2e80, 0x303e},   // CJK radicals, punctuation
+	{0x3041, 0x33ff},   // Hiragana, Katakana, CJK compatibility
+	{0x3400, 0x4dbf},   // CJK extension A
+	{0x4e00, 0x9fff},   // CJK unified ideographs
+	{0xa000, 0xa4cf},   // Yi
+	{0xa960, 0xa97f},   // Hangul Jamo extended A
+	{0xac00, 0xd7a3},   // Hangul syllables
+	{0xf900, 0xfaff},   // CJK compatibility ideographs
+	{0xfe10, 0xfe19},   // vertical forms
+	{0xfe30, 0xfe6f},   // CJK compatibility forms, small forms
+	{0xff00, 0xff60},   // fullwidth forms
+	{0xffe0, 0xffe6},   // fullwidth signs
+	{0x16fe0, 0x18aff}, // Tangut, Khitan
+	{0x1b000, 0x1b2ff}, // Kana supplement and extensions
+	{0x1f004, 0x1f004}, // mahjong tile
+	{0x1f0cf, 0x1f0cf}, // joker
+	{0x1f18e, 0x1f18e}, // AB button
+	{0x1f191, 0x1f19a}, // squared words
+	{0x1f1e6, 0x1f1ff}, // regional indicators
+	{0x1f200, 0x1f2ff}, // enclosed ideographic supplement
+	{0x1f300, 0x1f64f}, // symbols, pictographs and emoticons
+	{0x1f680, 0x1f6ff}, // transport and map symbols
+	{0x1f7e0, 0x1f7eb}, // colored circles and squares
+	{0x1f90c, 0x1f9ff}, // supplemental symbols and pictographs
+	{0x1fa70, 0x1faff}, // symbols and pictographs extended A
+	{0x20000, 0x2fffd}, // CJK extensions B to F
+	{0x30000, 0x3fffd}, // CJK extension G
+}
+
+// VisibleWidth returns the number of terminal columns s takes up when it
+// is printed. ANSI color sequences take up no columns, combining marks and
+// other zero width runes add nothing to the character they follow, and
+// East Asian wide characters and emoji take up two columns. Sequences
+// joined with a zero width joiner and flags made of two regional
+// indicators count as a single character.
+func VisibleWidth(s string) int {
+	s = StripColor(s)
+
+	width := 0
+	joined := false
+	regional := false
+	for _, r := range s {
+		switch {
+		case r == zeroWidthJoiner:
+			// The next rune is part of the same cluster.
+			joined = true
+			continue
+		case isZeroWidth(r):
+			continue
+		case joined:
+			joined = false
+			continue
+		case r >= regionalIndicatorA && r <= regionalIndicatorZ:
+			// Regional indicators come in pairs that form a single flag.
+			regional = !regional
+			if !regional {
+				continue
+			}
+		default:
+			regional = false
+		}
+
+		width += runeWidth(r)
+	}
+
+	return width
+}
+
+// isZeroWidth returns true for runes that take up no column of their own,
+// such as combining marks, variation selectors and control characters.
+func isZeroWidth(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Cc) ||
+		(r >= 0x1f3fb && r <= 0x1f3ff) // skin tone modifiers
+}
+
+// runeWidth returns the number of columns a single visible rune takes up.
+func runeWidth(r rune) int {
+	for _, wr := range wideRanges {
+		if r < wr.lo {
+			break
+		}
+		if r <= wr.hi {
+			return 2
+		}
+	}
+
+	return 1
+}
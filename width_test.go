@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestVisibleWidth(t *testing.T) {
+	cases := []struct {
+		Input string
+		Width int
+	}{
+		{"", 0},
+		{"foo", 3},
+		{"\x1b[1;31mfoo\x1b[0m", 3},
+
+		// Combining diacritics
+		{"cafe\u0301", 4},
+		{"caf\u00e9", 4},
+		{"n\u0303o\u0308", 2},
+
+		// CJK
+		{"日本語", 6},
+		{"\x1b[32m한국\x1b[0m", 4},
+		{"ａｂ", 4},
+
+		// Emoji
+		{"🚀", 2},
+		{"ok ✅", 5},
+		{"\U0001f44d\U0001f3fd", 2},
+		{"\U0001f469\u200d\U0001f4bb", 2},
+		{"🇩🇪🇫🇷", 4},
+		{"\u2764\ufe0f", 1},
+	}
+
+	for _, tc := range cases {
+		if actual := VisibleWidth(tc.Input); actual != tc.Width {
+			t.Fatalf("%q: bad: %d", tc.Input, actual)
+		}
+	}
+}
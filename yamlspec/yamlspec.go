@@ -0,0 +1,36 @@
+// Package yamlspec registers help-only commands with a cli.CLI from a YAML
+// document. It is kept apart from package cli so that only programs that
+// use it depend on a YAML parser.
+package yamlspec
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+	"mlib.com/cli"
+)
+
+// Load registers the commands listed in the YAML document read from r
+// with c, as cli.CLI.AddCommandSpec does. The document lists the commands
+// with their full name, synopsis, help and whether they are hidden:
+//
+//	commands:
+//	  - name: foo bar
+//	    synopsis: Bars the foo
+//	    help: |
+//	      Usage: app foo bar
+//	    hidden: false
+//
+// An invalid document, including one with unknown keys, returns an error
+// and registers nothing.
+func Load(c *cli.CLI, r io.Reader) error {
+	var spec cli.CommandSpec
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil && err != io.EOF {
+		return fmt.Errorf("error parsing command spec: %s", err)
+	}
+
+	return c.AddCommandSpec(&spec)
+}
@@ -0,0 +1,65 @@
+package yamlspec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mlib.com/cli"
+)
+
+const testSpec = `
+commands:
+  - name: deploy
+    synopsis: Deploys the application
+    help: |
+      Usage: app deploy [options]
+
+        Deploys the application.
+  - name: deploy rollback
+    synopsis: Rolls back a deployment
+  - name: debug
+    synopsis: Internal debugging
+    hidden: true
+`
+
+func TestLoad(t *testing.T) {
+	buf := new(bytes.Buffer)
+	c := &cli.CLI{
+		Args:              []string{"deploy"},
+		CommandHelpWriter: buf,
+	}
+
+	if err := Load(c, strings.NewReader(testSpec)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := c.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "Usage: app deploy [options]\n\n  Deploys the application.\n") {
+		t.Fatalf("bad:\n%s", buf.String())
+	}
+	if len(c.Commands) != 3 || len(c.HiddenCommands) != 1 {
+		t.Fatalf("bad: %#v %#v", c.Commands, c.HiddenCommands)
+	}
+}
+
+func TestLoad_invalid(t *testing.T) {
+	testCases := []string{
+		"commands: [",
+		"commands:\n  - synopsis: No name\n",
+		"commands:\n  - name: foo\n    aliases: [f]\n",
+	}
+
+	for _, tc := range testCases {
+		c := new(cli.CLI)
+		if err := Load(c, strings.NewReader(tc)); err == nil {
+			t.Fatalf("expected error for %q", tc)
+		}
+		if len(c.Commands) != 0 {
+			t.Fatalf("bad: %#v", c.Commands)
+		}
+	}
+}